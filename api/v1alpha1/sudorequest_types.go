@@ -20,6 +20,35 @@ import (
 
 const (
 	SudoRequestResourcePath = "sudorequests"
+
+	RoleKindClusterRole = "ClusterRole"
+	RoleKindRole        = "Role"
+)
+
+// Labels and annotations set on the bindings created for a request
+const (
+	// ManagedByLabel marks the bindings created by k8sudo, with the
+	// value ManagedByValue
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "k8sudo"
+
+	// SudoRequestAnnotation is the name of the request that the
+	// binding was created for
+	SudoRequestAnnotation = "k8sudo.jetstack.io/sudorequest"
+
+	// UserAnnotation, GroupAnnotation and RoleAnnotation are the
+	// subject and role that the binding grants, as binding names are
+	// shortened and hashed. The same keys are set as labels so that
+	// bindings can be selected, with values that aren't valid label
+	// values made DNS-safe.
+	UserAnnotation  = "k8sudo.jetstack.io/user"
+	GroupAnnotation = "k8sudo.jetstack.io/group"
+	RoleAnnotation  = "k8sudo.jetstack.io/role"
+
+	// ExpiresAnnotation is when the access granted by the binding
+	// expires, in RFC 3339 format, so that it can be removed without
+	// the request
+	ExpiresAnnotation = "k8sudo.jetstack.io/expires"
 )
 
 // SudoRequestSpec defines the desired state of SudoRequest
@@ -27,14 +56,76 @@ type SudoRequestSpec struct {
 	// The user to grant permissions to
 	User string `json:"user,omitempty"`
 
+	// The group to grant permissions to, instead of a user. Only a
+	// SudoSchedule can create a request for a group.
+	Group string `json:"group,omitempty"`
+
 	// The Role to give the user access to
 	Role string `json:"role,omitempty"`
 
+	// The kind of Role to give the user access to, either ClusterRole
+	// or Role. A Role can only be granted within a namespace.
+	// Defaults to ClusterRole.
+	RoleKind string `json:"roleKind,omitempty"`
+
+	// The namespace to grant access in. If set the access is granted
+	// with a RoleBinding in this namespace rather than a
+	// ClusterRoleBinding.
+	Namespace string `json:"namespace,omitempty"`
+
+	// The namespaces to grant access in. If set the access is granted
+	// with a RoleBinding to the ClusterRole in each of the namespaces
+	// that the user is authorized to assume it in.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// A label selector for the namespaces to grant access in. If set
+	// the access is granted with a RoleBinding to the ClusterRole in
+	// each matching namespace that the user is authorized to assume it
+	// in. Namespaces that match the selector while the request is
+	// Ready are granted access, and those that stop matching have it
+	// revoked.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
 	// A description of why the escalation is needed
 	Reason string `json:"reason,omitempty"`
 
 	// When the request should expire and access should be revoked
 	Expires *metav1.Time `json:"expires,omitempty"`
+
+	// When access should be granted from. The request is authorized
+	// and approved ahead of time, and access is granted once this time
+	// is reached.
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+
+	// How long access should be granted for, measured from when it is
+	// granted. If expires is also set access is revoked at whichever
+	// is sooner.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// Set to revoke access before the request expires
+	Revoked *SudoRequestRevocation `json:"revoked,omitempty"`
+
+	// Requests for more time once access has been granted. Extensions
+	// can only be added, and are reviewed in order.
+	Extensions []SudoRequestExtension `json:"extensions,omitempty"`
+}
+
+// SudoRequestExtension asks for access to be granted for longer
+type SudoRequestExtension struct {
+	// How much longer access should be granted for
+	Duration metav1.Duration `json:"duration"`
+
+	// A description of why more time is needed
+	Reason string `json:"reason,omitempty"`
+}
+
+// SudoRequestRevocation records who revoked a request and why
+type SudoRequestRevocation struct {
+	// The user revoking the request
+	User string `json:"user"`
+
+	// A description of why the request was revoked
+	Reason string `json:"reason,omitempty"`
 }
 
 type SudoRequestStatusStatus string
@@ -45,8 +136,179 @@ const (
 	SudoRequestStatusError   SudoRequestStatusStatus = "Error"
 	SudoRequestStatusReady   SudoRequestStatusStatus = "Ready"
 	SudoRequestStatusExpired SudoRequestStatusStatus = "Expired"
+
+	SudoRequestStatusAwaitingApproval SudoRequestStatusStatus = "AwaitingApproval"
+	SudoRequestStatusRejected         SudoRequestStatusStatus = "Rejected"
+	SudoRequestStatusRevoked          SudoRequestStatusStatus = "Revoked"
+	SudoRequestStatusScheduled        SudoRequestStatusStatus = "Scheduled"
+)
+
+type SudoRequestExtensionStatusStatus string
+
+const (
+	SudoRequestExtensionStatusGranted          SudoRequestExtensionStatusStatus = "Granted"
+	SudoRequestExtensionStatusDenied           SudoRequestExtensionStatusStatus = "Denied"
+	SudoRequestExtensionStatusAwaitingApproval SudoRequestExtensionStatusStatus = "AwaitingApproval"
+)
+
+// SudoRequestExtensionStatus is the result of reviewing an extension
+type SudoRequestExtensionStatus struct {
+	// The duration that was asked for
+	Duration metav1.Duration `json:"duration"`
+
+	// Whether the extension was granted
+	Status SudoRequestExtensionStatusStatus `json:"status,omitempty"`
+
+	// The reason for the status if known
+	Reason string `json:"reason,omitempty"`
+}
+
+type SudoRequestNamespaceStatusStatus string
+
+const (
+	SudoRequestNamespaceStatusGranted SudoRequestNamespaceStatusStatus = "Granted"
+	SudoRequestNamespaceStatusDenied  SudoRequestNamespaceStatusStatus = "Denied"
+)
+
+// SudoRequestNamespaceStatus defines the observed state of the request
+// in one of the requested namespaces
+type SudoRequestNamespaceStatus struct {
+	// The namespace
+	Namespace string `json:"namespace"`
+
+	// Whether access was granted in the namespace
+	Status SudoRequestNamespaceStatusStatus `json:"status,omitempty"`
+
+	// The reason for the status if known
+	Reason string `json:"reason,omitempty"`
+
+	// The RoleBinding granting access in the namespace
+	RoleBinding string `json:"roleBinding,omitempty"`
+}
+
+type SudoRequestConditionType string
+
+const (
+	// Whether the subject is authorized to assume the role
+	SudoRequestConditionAuthorized SudoRequestConditionType = "Authorized"
+	// Whether the request has the approvals required by the policy
+	SudoRequestConditionApproved SudoRequestConditionType = "Approved"
+	// Whether the bindings granting the role exist
+	SudoRequestConditionGranted SudoRequestConditionType = "Granted"
+	// Whether access has ended, either by expiring or being revoked
+	SudoRequestConditionExpired SudoRequestConditionType = "Expired"
+	// Whether a binding granting the role was deleted or changed by
+	// something other than the controller
+	SudoRequestConditionTampered SudoRequestConditionType = "Tampered"
 )
 
+// SudoRequestCondition describes one aspect of the state of the request.
+// It has the same fields as the standard Condition type, so that it can
+// be used by tools such as kubectl wait.
+type SudoRequestCondition struct {
+	// The type of the condition
+	Type SudoRequestConditionType `json:"type"`
+
+	// Either True, False or Unknown
+	Status metav1.ConditionStatus `json:"status"`
+
+	// The generation of the request that the condition was set from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// When the status of the condition last changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+
+	// A CamelCase reason for the status of the condition
+	Reason string `json:"reason"`
+
+	// A description of the status of the condition
+	Message string `json:"message,omitempty"`
+}
+
+// SudoRequestHistoryEntry records a change to the status of the request
+type SudoRequestHistoryEntry struct {
+	// The status that the request changed to
+	Status SudoRequestStatusStatus `json:"status"`
+
+	// When the status changed
+	Time metav1.Time `json:"time"`
+
+	// Who changed the status: the controller, the approvers or the user
+	// that revoked the request
+	Actor string `json:"actor"`
+
+	// The reason for the status if known
+	Reason string `json:"reason,omitempty"`
+}
+
+// SudoRequestAction is an API request made using the access granted
+// by the request, as reported by the API server's audit log
+type SudoRequestAction struct {
+	// When the API request was received
+	Time metav1.Time `json:"time"`
+
+	// The user that made the API request
+	User string `json:"user"`
+
+	// The verb of the API request, such as get or delete
+	Verb string `json:"verb"`
+
+	// The resource acted on, with its group if it isn't in the core
+	// group, such as deployments.apps
+	Resource string `json:"resource,omitempty"`
+
+	// The subresource acted on, if any
+	Subresource string `json:"subresource,omitempty"`
+
+	// The namespace of the object acted on
+	Namespace string `json:"namespace,omitempty"`
+
+	// The name of the object acted on
+	Name string `json:"name,omitempty"`
+
+	// The path of the API request, for requests that aren't for a
+	// resource
+	RequestURI string `json:"requestURI,omitempty"`
+
+	// The HTTP status code of the response
+	Code int32 `json:"code,omitempty"`
+
+	// The ID of the event in the API server's audit log
+	AuditID string `json:"auditID,omitempty"`
+}
+
+// SudoRequestActions summarises the API requests made using the access
+// granted by the request
+type SudoRequestActions struct {
+	// The number of API requests made
+	Count int64 `json:"count"`
+
+	// The most recent API requests, oldest first. Only the most recent
+	// requests are kept.
+	Recent []SudoRequestAction `json:"recent,omitempty"`
+}
+
+// SudoRequestGrant is the role and subject that the request was
+// authorized for. The bindings are created and restored from it rather
+// than from the spec.
+type SudoRequestGrant struct {
+	// The kind of subject the role is granted to, either User or Group
+	SubjectKind string `json:"subjectKind"`
+
+	// The name of the user or group the role is granted to
+	Subject string `json:"subject"`
+
+	// The kind of role granted, either ClusterRole or Role
+	RoleKind string `json:"roleKind"`
+
+	// The name of the role granted
+	Role string `json:"role"`
+
+	// The namespace the role is granted in, if the request was for a
+	// single namespace
+	Namespace string `json:"namespace,omitempty"`
+}
+
 // SudoRequestStatus defines the observed state of SudoRequest
 type SudoRequestStatus struct {
 	// The status of the request
@@ -55,13 +317,48 @@ type SudoRequestStatus struct {
 	// The reason for the status if known
 	Reason string `json:"reason,omitempty"`
 
+	// The generation of the request that the status was last updated from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The conditions describing the state of the request
+	Conditions []SudoRequestCondition `json:"conditions,omitempty"`
+
+	// The changes to the status of the request, oldest first. Only the
+	// most recent changes are kept.
+	History []SudoRequestHistoryEntry `json:"history,omitempty"`
+
+	// The role and subject that the request was authorized for, recorded
+	// when the request is authorized
+	Grant *SudoRequestGrant `json:"grant,omitempty"`
+
 	// The secret holding the credentials if the request has been granted
 	ClusterRoleBinding string `json:"clusterRoleBinding,omitempty"`
 
+	// The RoleBinding granting access if the request was for a namespace
+	RoleBinding string `json:"roleBinding,omitempty"`
+
+	// The status of each of the namespaces if the request was for
+	// a list of namespaces or a namespace selector
+	Namespaces []SudoRequestNamespaceStatus `json:"namespaces,omitempty"`
+
+	// The users that have approved the request, if it requires approval
+	Approvers []string `json:"approvers,omitempty"`
+
+	// When access was granted. The duration of the escalation is
+	// measured from this time.
+	GrantedAt *metav1.Time `json:"grantedAt,omitempty"`
+
+	// The status of each of the extensions in the spec, in the same order
+	Extensions []SudoRequestExtensionStatus `json:"extensions,omitempty"`
+
 	// When the escalation will expire
 	// This applies regardless of what expiration time (if any) is set
 	// in the spec.
 	Expires *metav1.Time `json:"expires,omitempty"`
+
+	// The API requests made using the access granted, if the manager
+	// receives the API server's audit events
+	Actions *SudoRequestActions `json:"actions,omitempty"`
 }
 
 // +kubebuilder:resource:path=sudorequests,scope=Cluster
@@ -0,0 +1,81 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	SudoRequestApprovalResourcePath = "sudorequestapprovals"
+)
+
+type SudoRequestApprovalDecision string
+
+const (
+	SudoRequestApprovalDecisionApprove SudoRequestApprovalDecision = "Approve"
+	SudoRequestApprovalDecisionReject  SudoRequestApprovalDecision = "Reject"
+)
+
+// SudoRequestApprovalSpec defines the desired state of SudoRequestApproval
+type SudoRequestApprovalSpec struct {
+	// The name of the SudoRequest being approved or rejected
+	SudoRequest string `json:"sudoRequest"`
+
+	// The UID of the SudoRequest being approved or rejected, so that the
+	// approval doesn't apply to a later request with the same name
+	SudoRequestUID types.UID `json:"sudoRequestUID"`
+
+	// The user approving or rejecting the request
+	Approver string `json:"approver"`
+
+	// The groups of the user approving or rejecting the request
+	Groups []string `json:"groups,omitempty"`
+
+	// Either Approve or Reject
+	Decision SudoRequestApprovalDecision `json:"decision"`
+
+	// A description of why the request was approved or rejected
+	Reason string `json:"reason,omitempty"`
+
+	// The index of the extension being approved or rejected. If unset
+	// the approval is for the request itself.
+	Extension *int32 `json:"extension,omitempty"`
+}
+
+// +kubebuilder:resource:path=sudorequestapprovals,scope=Cluster
+// +kubebuilder:object:root=true
+
+// SudoRequestApproval is the Schema for the sudorequestapprovals API
+type SudoRequestApproval struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SudoRequestApprovalSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SudoRequestApprovalList contains a list of SudoRequestApproval
+type SudoRequestApprovalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SudoRequestApproval `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SudoRequestApproval{}, &SudoRequestApprovalList{})
+}
@@ -0,0 +1,102 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	SudoScheduleResourcePath = "sudoschedules"
+)
+
+// SudoScheduleSpec defines the desired state of SudoSchedule
+type SudoScheduleSpec struct {
+	// The user to grant the role to during each window
+	User string `json:"user,omitempty"`
+
+	// The group to grant the role to during each window, instead of
+	// a user
+	Group string `json:"group,omitempty"`
+
+	// The name of the role to grant
+	Role string `json:"role"`
+
+	// The user creating the schedule. It must be set to the user that
+	// creates it, who can't approve the SudoRequests it creates.
+	Requester string `json:"requester,omitempty"`
+
+	// The kind of the role, either ClusterRole or Role. Defaults to ClusterRole.
+	RoleKind string `json:"roleKind,omitempty"`
+
+	// The namespace to grant access in. If set the access is granted
+	// with a RoleBinding in this namespace rather than a ClusterRoleBinding.
+	Namespace string `json:"namespace,omitempty"`
+
+	// A description of why the escalation is needed
+	Reason string `json:"reason,omitempty"`
+
+	// The days of the week that the window starts on, such as Tuesday.
+	// If empty the window starts every day.
+	Days []string `json:"days,omitempty"`
+
+	// The time of day that the window starts, as HH:MM
+	Start string `json:"start"`
+
+	// How long the window lasts
+	Duration metav1.Duration `json:"duration"`
+
+	// The IANA time zone that the start time is in, such as
+	// Europe/London. Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// SudoScheduleStatus defines the observed state of SudoSchedule
+type SudoScheduleStatus struct {
+	// The start of the latest window that a SudoRequest was created for
+	LastScheduled *metav1.Time `json:"lastScheduled,omitempty"`
+
+	// The name of the SudoRequest for the latest window
+	SudoRequest string `json:"sudoRequest,omitempty"`
+
+	// Why the schedule can't be used, if it is invalid
+	Reason string `json:"reason,omitempty"`
+}
+
+// +kubebuilder:resource:path=sudoschedules,scope=Cluster
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// SudoSchedule is the Schema for the sudoschedules API
+type SudoSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SudoScheduleSpec   `json:"spec,omitempty"`
+	Status SudoScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SudoScheduleList contains a list of SudoSchedule
+type SudoScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SudoSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SudoSchedule{}, &SudoScheduleList{})
+}
@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -51,6 +52,206 @@ func (in *SudoRequest) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestAction) DeepCopyInto(out *SudoRequestAction) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestAction.
+func (in *SudoRequestAction) DeepCopy() *SudoRequestAction {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestActions) DeepCopyInto(out *SudoRequestActions) {
+	*out = *in
+	if in.Recent != nil {
+		in, out := &in.Recent, &out.Recent
+		*out = make([]SudoRequestAction, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestActions.
+func (in *SudoRequestActions) DeepCopy() *SudoRequestActions {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestActions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestApproval) DeepCopyInto(out *SudoRequestApproval) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestApproval.
+func (in *SudoRequestApproval) DeepCopy() *SudoRequestApproval {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestApproval)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SudoRequestApproval) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestApprovalList) DeepCopyInto(out *SudoRequestApprovalList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SudoRequestApproval, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestApprovalList.
+func (in *SudoRequestApprovalList) DeepCopy() *SudoRequestApprovalList {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestApprovalList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SudoRequestApprovalList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestApprovalSpec) DeepCopyInto(out *SudoRequestApprovalSpec) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Extension != nil {
+		in, out := &in.Extension, &out.Extension
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestApprovalSpec.
+func (in *SudoRequestApprovalSpec) DeepCopy() *SudoRequestApprovalSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestApprovalSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestCondition) DeepCopyInto(out *SudoRequestCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestCondition.
+func (in *SudoRequestCondition) DeepCopy() *SudoRequestCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestExtension) DeepCopyInto(out *SudoRequestExtension) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestExtension.
+func (in *SudoRequestExtension) DeepCopy() *SudoRequestExtension {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestExtension)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestExtensionStatus) DeepCopyInto(out *SudoRequestExtensionStatus) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestExtensionStatus.
+func (in *SudoRequestExtensionStatus) DeepCopy() *SudoRequestExtensionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestExtensionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestGrant) DeepCopyInto(out *SudoRequestGrant) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestGrant.
+func (in *SudoRequestGrant) DeepCopy() *SudoRequestGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestHistoryEntry) DeepCopyInto(out *SudoRequestHistoryEntry) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestHistoryEntry.
+func (in *SudoRequestHistoryEntry) DeepCopy() *SudoRequestHistoryEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestHistoryEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SudoRequestList) DeepCopyInto(out *SudoRequestList) {
 	*out = *in
@@ -83,13 +284,72 @@ func (in *SudoRequestList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestNamespaceStatus) DeepCopyInto(out *SudoRequestNamespaceStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestNamespaceStatus.
+func (in *SudoRequestNamespaceStatus) DeepCopy() *SudoRequestNamespaceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestNamespaceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoRequestRevocation) DeepCopyInto(out *SudoRequestRevocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestRevocation.
+func (in *SudoRequestRevocation) DeepCopy() *SudoRequestRevocation {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoRequestRevocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SudoRequestSpec) DeepCopyInto(out *SudoRequestSpec) {
 	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Expires != nil {
 		in, out := &in.Expires, &out.Expires
 		*out = (*in).DeepCopy()
 	}
+	if in.NotBefore != nil {
+		in, out := &in.NotBefore, &out.NotBefore
+		*out = (*in).DeepCopy()
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Revoked != nil {
+		in, out := &in.Revoked, &out.Revoked
+		*out = new(SudoRequestRevocation)
+		**out = **in
+	}
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make([]SudoRequestExtension, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestSpec.
@@ -105,10 +365,53 @@ func (in *SudoRequestSpec) DeepCopy() *SudoRequestSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SudoRequestStatus) DeepCopyInto(out *SudoRequestStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]SudoRequestCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]SudoRequestHistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Grant != nil {
+		in, out := &in.Grant, &out.Grant
+		*out = new(SudoRequestGrant)
+		**out = **in
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]SudoRequestNamespaceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Approvers != nil {
+		in, out := &in.Approvers, &out.Approvers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.GrantedAt != nil {
+		in, out := &in.GrantedAt, &out.GrantedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make([]SudoRequestExtensionStatus, len(*in))
+		copy(*out, *in)
+	}
 	if in.Expires != nil {
 		in, out := &in.Expires, &out.Expires
 		*out = (*in).DeepCopy()
 	}
+	if in.Actions != nil {
+		in, out := &in.Actions, &out.Actions
+		*out = new(SudoRequestActions)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoRequestStatus.
@@ -120,3 +423,102 @@ func (in *SudoRequestStatus) DeepCopy() *SudoRequestStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoSchedule) DeepCopyInto(out *SudoSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoSchedule.
+func (in *SudoSchedule) DeepCopy() *SudoSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SudoSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoScheduleList) DeepCopyInto(out *SudoScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SudoSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoScheduleList.
+func (in *SudoScheduleList) DeepCopy() *SudoScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SudoScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoScheduleSpec) DeepCopyInto(out *SudoScheduleSpec) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoScheduleSpec.
+func (in *SudoScheduleSpec) DeepCopy() *SudoScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SudoScheduleStatus) DeepCopyInto(out *SudoScheduleStatus) {
+	*out = *in
+	if in.LastScheduled != nil {
+		in, out := &in.LastScheduled, &out.LastScheduled
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SudoScheduleStatus.
+func (in *SudoScheduleStatus) DeepCopy() *SudoScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SudoScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
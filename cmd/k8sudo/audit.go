@@ -0,0 +1,95 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"jetstack.io/k8sudo/pkg/audit"
+)
+
+// auditVerify walks the chain of records in the given files, which must
+// be in the order they were written, oldest first, and reports any
+// records that are missing or have been modified
+func auditVerify(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	hmacKeyFile := flags.String("hmac-key-file", "", "The file holding the key the records were signed with using HMAC-SHA256.")
+	publicKeyFile := flags.String("public-key-file", "", "The file holding the PEM encoded Ed25519 public key the records were signed with.")
+	flags.Usage = func() {
+		fmt.Fprintf(stdout, "Usage: k8sudo audit verify [flags] FILE...\n\n"+
+			"Files are checked as a single chain, so rotated files should be given oldest first.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError{code: 2}
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitError{code: 2}
+	}
+	if *hmacKeyFile != "" && *publicKeyFile != "" {
+		return fmt.Errorf("only one of --hmac-key-file and --public-key-file can be set")
+	}
+
+	verifier := &audit.Verifier{}
+	if *hmacKeyFile != "" {
+		signer, err := audit.LoadHMACKey(*hmacKeyFile)
+		if err != nil {
+			return err
+		}
+		verifier.Signer = signer
+	}
+	if *publicKeyFile != "" {
+		signer, err := audit.LoadEd25519Key(*publicKeyFile)
+		if err != nil {
+			return err
+		}
+		verifier.Signer = signer
+	}
+
+	for _, filename := range flags.Args() {
+		if err := verifyFile(verifier, filename); err != nil {
+			return err
+		}
+	}
+
+	for _, problem := range verifier.Problems {
+		fmt.Fprintln(stdout, problem)
+	}
+	if verifier.Restarts > 0 {
+		fmt.Fprintf(stdout, "Chain started again by the manager restarting: %d\n", verifier.Restarts)
+	}
+	fmt.Fprintf(stdout, "Checked %d records starting at record %d: %d problems found\n", verifier.Records, verifier.First, len(verifier.Problems))
+	if len(verifier.Problems) > 0 {
+		return exitError{code: 1}
+	}
+	return nil
+}
+
+func verifyFile(verifier *audit.Verifier, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := verifier.Verify(filename, file); err != nil {
+		return fmt.Errorf("unable to read %s: %v", filename, err)
+	}
+	return nil
+}
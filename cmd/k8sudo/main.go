@@ -0,0 +1,78 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// k8sudo is a command line tool for working with the records kept by
+// the k8sudo manager and the API server, and for removing expired access
+// when the manager isn't running.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand, run with the remaining arguments
+type command func(args []string, stdout io.Writer) error
+
+// commands are the subcommands, keyed by their full name
+var commands = map[string]command{
+	"audit verify": auditVerify,
+	"reaper":       reaper,
+	"report":       report,
+}
+
+const usage = `Usage: k8sudo <command> [flags]
+
+Commands:
+  audit verify  Check that audit log files haven't been modified
+  reaper        Delete bindings that have expired, without the manager
+  report        Show the API requests made while each SudoRequest granted access
+`
+
+// exitError is returned by a command to exit with a given code without
+// printing an error, as the command has already reported the problem
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+// run finds the command named by the first one or two arguments and
+// runs it
+func run(args []string, stdout io.Writer) error {
+	if len(args) >= 2 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd(args[2:], stdout)
+		}
+	}
+	if len(args) >= 1 {
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd(args[1:], stdout)
+		}
+	}
+	return fmt.Errorf("unknown command\n\n%s", usage)
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if exit, ok := err.(exitError); ok {
+			os.Exit(exit.code)
+		}
+		fmt.Fprintf(os.Stderr, "k8sudo: %v\n", err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+// reaper deletes the bindings created by k8sudo whose expiry annotation
+// has passed. It only needs to list and delete bindings, so it can run
+// as a CronJob that removes expired access even when the manager isn't
+// running.
+func reaper(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("reaper", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	kubeconfig := flags.String("kubeconfig", "", "The kubeconfig file to use. Defaults to $KUBECONFIG, then ~/.kube/config, then the in-cluster config.")
+	gracePeriod := flags.Duration("grace-period", 0, "How long after a binding expires to leave it for the manager to delete before deleting it.")
+	dryRun := flags.Bool("dry-run", false, "Print the bindings that would be deleted without deleting them.")
+	flags.Usage = func() {
+		fmt.Fprintf(stdout, "Usage: k8sudo reaper [flags]\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError{code: 2}
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitError{code: 2}
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("unable to load kubeconfig: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("unable to create client: %v", err)
+	}
+
+	r := &bindingReaper{
+		client:      clientset.RbacV1(),
+		gracePeriod: *gracePeriod,
+		dryRun:      *dryRun,
+		out:         stdout,
+	}
+	return r.reap(context.Background(), time.Now())
+}
+
+// bindingReaper deletes expired bindings
+type bindingReaper struct {
+	client      rbacv1client.RbacV1Interface
+	gracePeriod time.Duration
+	dryRun      bool
+	out         io.Writer
+}
+
+// reap deletes the ClusterRoleBindings and RoleBindings created by
+// k8sudo that expired before now, less the grace period. Bindings that
+// can't be deleted are reported and the rest are still deleted.
+func (r *bindingReaper) reap(ctx context.Context, now time.Time) error {
+	opts := metav1.ListOptions{
+		LabelSelector: labels.Set{k8sudov1alpha1.ManagedByLabel: k8sudov1alpha1.ManagedByValue}.String(),
+	}
+	crbs, err := r.client.ClusterRoleBindings().List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("unable to list ClusterRoleBindings: %v", err)
+	}
+	rbs, err := r.client.RoleBindings(metav1.NamespaceAll).List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("unable to list RoleBindings: %v", err)
+	}
+
+	deleted, failed := 0, 0
+	reap := func(kind string, obj metav1.Object, del func(metav1.DeleteOptions) error) {
+		expires, ok := bindingExpiry(obj)
+		if !ok || now.Before(expires.Add(r.gracePeriod)) {
+			return
+		}
+		name := obj.GetName()
+		if obj.GetNamespace() != "" {
+			name = obj.GetNamespace() + "/" + name
+		}
+		if r.dryRun {
+			fmt.Fprintf(r.out, "Would delete %s %s, expired at %s\n", kind, name, expires.Format(time.RFC3339))
+			deleted++
+			return
+		}
+		// The binding is only deleted if it hasn't changed since it was
+		// listed, in case the request has just been extended
+		uid, resourceVersion := obj.GetUID(), obj.GetResourceVersion()
+		err := del(metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion},
+		})
+		switch {
+		case err == nil:
+			fmt.Fprintf(r.out, "Deleted %s %s, expired at %s\n", kind, name, expires.Format(time.RFC3339))
+			deleted++
+		case apierrors.IsNotFound(err), apierrors.IsConflict(err):
+		default:
+			fmt.Fprintf(r.out, "Unable to delete %s %s: %v\n", kind, name, err)
+			failed++
+		}
+	}
+	for i := range crbs.Items {
+		crb := &crbs.Items[i]
+		reap("ClusterRoleBinding", crb, func(opts metav1.DeleteOptions) error {
+			return r.client.ClusterRoleBindings().Delete(ctx, crb.Name, opts)
+		})
+	}
+	for i := range rbs.Items {
+		rb := &rbs.Items[i]
+		reap("RoleBinding", rb, func(opts metav1.DeleteOptions) error {
+			return r.client.RoleBindings(rb.Namespace).Delete(ctx, rb.Name, opts)
+		})
+	}
+
+	verb := "Deleted"
+	if r.dryRun {
+		verb = "Would delete"
+	}
+	fmt.Fprintf(r.out, "%s %d expired bindings\n", verb, deleted)
+	if failed > 0 {
+		return fmt.Errorf("unable to delete %d bindings", failed)
+	}
+	return nil
+}
+
+// bindingExpiry returns when the binding expires, and false if it
+// doesn't have a valid expiry annotation, such as bindings created by
+// earlier versions of the manager
+func bindingExpiry(obj metav1.Object) (time.Time, bool) {
+	value, ok := obj.GetAnnotations()[k8sudov1alpha1.ExpiresAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expires, true
+}
@@ -0,0 +1,134 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+func TestReap(t *testing.T) {
+	now := time.Date(2020, time.June, 2, 3, 0, 0, 0, time.UTC)
+	meta := func(name, namespace, expires string) metav1.ObjectMeta {
+		meta := metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{k8sudov1alpha1.ManagedByLabel: k8sudov1alpha1.ManagedByValue},
+		}
+		if expires != "" {
+			meta.Annotations = map[string]string{k8sudov1alpha1.ExpiresAnnotation: expires}
+		}
+		return meta
+	}
+	unmanaged := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{
+		Name:        "unmanaged",
+		Annotations: map[string]string{k8sudov1alpha1.ExpiresAnnotation: "2020-06-02T01:00:00Z"},
+	}}
+	objects := []runtime.Object{
+		&rbacv1.ClusterRoleBinding{ObjectMeta: meta("expired", "", "2020-06-02T02:00:00Z")},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: meta("just-expired", "", "2020-06-02T02:59:00Z")},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: meta("active", "", "2020-06-02T04:00:00Z")},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: meta("no-expiry", "", "")},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: meta("invalid-expiry", "", "tomorrow")},
+		&rbacv1.RoleBinding{ObjectMeta: meta("expired", "ns", "2020-06-02T02:00:00Z")},
+		&rbacv1.RoleBinding{ObjectMeta: meta("active", "ns", "2020-06-02T04:00:00Z")},
+		unmanaged,
+	}
+	tests := []struct {
+		name            string
+		gracePeriod     time.Duration
+		dryRun          bool
+		expectedCRBs    []string
+		expectedRBs     []string
+		expectedSummary string
+	}{
+		{
+			name:            "expired",
+			expectedCRBs:    []string{"active", "invalid-expiry", "no-expiry", "unmanaged"},
+			expectedRBs:     []string{"active"},
+			expectedSummary: "Deleted 3 expired bindings\n",
+		},
+		{
+			name:            "grace period",
+			gracePeriod:     5 * time.Minute,
+			expectedCRBs:    []string{"active", "invalid-expiry", "just-expired", "no-expiry", "unmanaged"},
+			expectedRBs:     []string{"active"},
+			expectedSummary: "Deleted 2 expired bindings\n",
+		},
+		{
+			name:            "dry run",
+			dryRun:          true,
+			expectedCRBs:    []string{"active", "expired", "invalid-expiry", "just-expired", "no-expiry", "unmanaged"},
+			expectedRBs:     []string{"active", "expired"},
+			expectedSummary: "Would delete 3 expired bindings\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(objects...)
+			var out bytes.Buffer
+			r := &bindingReaper{
+				client:      clientset.RbacV1(),
+				gracePeriod: test.gracePeriod,
+				dryRun:      test.dryRun,
+				out:         &out,
+			}
+			ctx := context.Background()
+			if err := r.reap(ctx, now); err != nil {
+				t.Fatalf("reap returned an error: %v", err)
+			}
+
+			crbs, err := clientset.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("error listing ClusterRoleBindings: %v", err)
+			}
+			var crbNames []string
+			for _, crb := range crbs.Items {
+				crbNames = append(crbNames, crb.Name)
+			}
+			sort.Strings(crbNames)
+			if got, want := crbNames, test.expectedCRBs; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong ClusterRoleBindings: (got != want) %v != %v", got, want)
+			}
+			rbs, err := clientset.RbacV1().RoleBindings("ns").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("error listing RoleBindings: %v", err)
+			}
+			var rbNames []string
+			for _, rb := range rbs.Items {
+				rbNames = append(rbNames, rb.Name)
+			}
+			sort.Strings(rbNames)
+			if got, want := rbNames, test.expectedRBs; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong RoleBindings: (got != want) %v != %v", got, want)
+			}
+			if !bytes.HasSuffix(out.Bytes(), []byte(test.expectedSummary)) {
+				t.Errorf("wrong output, expected it to end with %q:\n%s", test.expectedSummary, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/apiaudit"
+)
+
+// maxEventSize is the longest line read from an audit log, which can
+// include request and response bodies
+const maxEventSize = 16 * 1024 * 1024
+
+// reportAction is an API request made while a request granted access
+type reportAction struct {
+	k8sudov1alpha1.SudoRequestAction `json:",inline"`
+
+	// Whether the API request was only allowed by the binding created
+	// for the request
+	Escalated bool `json:"escalated"`
+}
+
+// requestReport is the timeline of API requests made while a request
+// granted access
+type requestReport struct {
+	SudoRequest string         `json:"sudoRequest"`
+	User        string         `json:"user,omitempty"`
+	Group       string         `json:"group,omitempty"`
+	Role        string         `json:"role"`
+	Reason      string         `json:"reason,omitempty"`
+	GrantedAt   time.Time      `json:"grantedAt"`
+	Until       time.Time      `json:"until"`
+	Actions     []reportAction `json:"actions"`
+
+	sudoReq  *k8sudov1alpha1.SudoRequest
+	bindings map[string]bool
+}
+
+// report reads the API server's audit logs and a list of SudoRequests,
+// as exported with kubectl get sudorequests -o json or -o yaml, and
+// shows the API requests made while each request granted access
+func report(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	sudoRequestsFile := flags.String("sudorequests", "", "The file holding the SudoRequests, as exported by kubectl get sudorequests -o json.")
+	output := flags.String("output", "table", "The output format: table, json or csv.")
+	flags.Usage = func() {
+		fmt.Fprintf(stdout, "Usage: k8sudo report [flags] AUDIT-LOG...\n\n"+
+			"Shows the API requests made by each user while a SudoRequest granted them access.\n"+
+			"Requests only allowed by the binding created for the SudoRequest are marked as escalated.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError{code: 2}
+	}
+	if *sudoRequestsFile == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return exitError{code: 2}
+	}
+	var write func(io.Writer, []*requestReport) error
+	switch *output {
+	case "table":
+		write = writeTable
+	case "json":
+		write = writeJSON
+	case "csv":
+		write = writeCSV
+	default:
+		return fmt.Errorf("unknown output format %q, must be table, json or csv", *output)
+	}
+
+	sudoReqs, err := loadSudoRequests(*sudoRequestsFile)
+	if err != nil {
+		return err
+	}
+	reports := newReports(sudoReqs)
+	for _, filename := range flags.Args() {
+		if err := addAuditLog(reports, filename); err != nil {
+			return err
+		}
+	}
+	for _, r := range reports {
+		sort.SliceStable(r.Actions, func(i, j int) bool {
+			return r.Actions[i].Time.Before(&r.Actions[j].Time)
+		})
+	}
+	return write(stdout, reports)
+}
+
+// loadSudoRequests reads a list of SudoRequests, or a single one, as
+// JSON or YAML
+func loadSudoRequests(filename string) ([]k8sudov1alpha1.SudoRequest, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SudoRequests: %v", err)
+	}
+	var list k8sudov1alpha1.SudoRequestList
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse SudoRequests in %s: %v", filename, err)
+	}
+	if list.Kind == "SudoRequest" {
+		var sudoReq k8sudov1alpha1.SudoRequest
+		if err := yaml.Unmarshal(data, &sudoReq); err != nil {
+			return nil, fmt.Errorf("unable to parse SudoRequest in %s: %v", filename, err)
+		}
+		return []k8sudov1alpha1.SudoRequest{sudoReq}, nil
+	}
+	return list.Items, nil
+}
+
+// newReports returns an empty report for each request that granted
+// access, ordered by when it was granted
+func newReports(sudoReqs []k8sudov1alpha1.SudoRequest) []*requestReport {
+	var reports []*requestReport
+	for i := range sudoReqs {
+		sudoReq := &sudoReqs[i]
+		until, ok := apiaudit.GrantedUntil(sudoReq)
+		if !ok {
+			continue
+		}
+		r := &requestReport{
+			SudoRequest: sudoReq.Name,
+			User:        sudoReq.Spec.User,
+			Group:       sudoReq.Spec.Group,
+			Role:        sudoReq.Spec.Role,
+			Reason:      sudoReq.Spec.Reason,
+			GrantedAt:   sudoReq.Status.GrantedAt.Time,
+			Until:       until,
+			Actions:     []reportAction{},
+			sudoReq:     sudoReq,
+			bindings:    map[string]bool{},
+		}
+		for _, name := range apiaudit.BindingNames(sudoReq) {
+			r.bindings[name] = true
+		}
+		reports = append(reports, r)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].GrantedAt.Before(reports[j].GrantedAt)
+	})
+	return reports
+}
+
+// addAuditLog adds the API requests in an audit log, written by the
+// API server's log backend in JSON, to the reports of the requests
+// that granted access when they were made
+func addAuditLog(reports []*requestReport, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxEventSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event apiaudit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("%s:%d: invalid audit event: %v", filename, lineNo, err)
+		}
+		addEvent(reports, &event)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read %s: %v", filename, err)
+	}
+	return nil
+}
+
+func addEvent(reports []*requestReport, event *apiaudit.Event) {
+	if !event.Complete() {
+		return
+	}
+	user := event.EffectiveUser()
+	binding, _ := event.AllowedBy()
+	for _, r := range reports {
+		if !apiaudit.SubjectMatches(r.sudoReq, user) || !apiaudit.ActiveAt(r.sudoReq, event.RequestReceivedTimestamp.Time) {
+			continue
+		}
+		r.Actions = append(r.Actions, reportAction{
+			SudoRequestAction: event.Action(),
+			Escalated:         binding != "" && r.bindings[binding],
+		})
+	}
+}
+
+func writeTable(w io.Writer, reports []*requestReport) error {
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		subject := r.User
+		if r.Group != "" {
+			subject = "group " + r.Group
+		}
+		fmt.Fprintf(w, "SudoRequest %s: %s as %s from %s until %s\n", r.SudoRequest, subject, r.Role,
+			r.GrantedAt.UTC().Format(time.RFC3339), r.Until.UTC().Format(time.RFC3339))
+		if r.Reason != "" {
+			fmt.Fprintf(w, "Reason: %s\n", r.Reason)
+		}
+		if len(r.Actions) == 0 {
+			fmt.Fprintln(w, "No API requests")
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "\tTIME\tUSER\tVERB\tRESOURCE\tNAMESPACE\tNAME\tCODE")
+		for _, action := range r.Actions {
+			marker := ""
+			if action.Escalated {
+				marker = "*"
+			}
+			resource := action.Resource
+			if action.Subresource != "" {
+				resource += "/" + action.Subresource
+			}
+			if resource == "" {
+				resource = action.RequestURI
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", marker, action.Time.UTC().Format(time.RFC3339),
+				action.User, action.Verb, resource, action.Namespace, action.Name, action.Code)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(w, "\n* only allowed by the access granted by the SudoRequest")
+	return nil
+}
+
+func writeJSON(w io.Writer, reports []*requestReport) error {
+	if reports == nil {
+		reports = []*requestReport{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reports)
+}
+
+func writeCSV(w io.Writer, reports []*requestReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"sudoRequest", "time", "user", "verb", "resource", "subresource", "namespace", "name", "requestURI", "code", "escalated", "auditID"})
+	for _, r := range reports {
+		for _, action := range r.Actions {
+			cw.Write([]string{
+				r.SudoRequest,
+				action.Time.UTC().Format(time.RFC3339Nano),
+				action.User,
+				action.Verb,
+				action.Resource,
+				action.Subresource,
+				action.Namespace,
+				action.Name,
+				action.RequestURI,
+				strconv.Itoa(int(action.Code)),
+				strconv.FormatBool(action.Escalated),
+				action.AuditID,
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
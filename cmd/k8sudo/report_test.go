@@ -0,0 +1,112 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSudoRequests = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: k8sudo.jetstack.io/v1alpha1
+  kind: SudoRequest
+  metadata:
+    name: fix-prod
+  spec:
+    user: dev1
+    role: admin
+    reason: Fixing prod
+  status:
+    status: Expired
+    clusterRoleBinding: sudo-dev1-admin-fix-prod
+    grantedAt: "2020-06-02T02:00:00Z"
+    expires: "2020-06-02T03:00:00Z"
+- apiVersion: k8sudo.jetstack.io/v1alpha1
+  kind: SudoRequest
+  metadata:
+    name: denied
+  spec:
+    user: dev1
+    role: admin
+  status:
+    status: Denied
+`
+
+const testAuditLog = `{"auditID":"1","stage":"ResponseComplete","verb":"delete","user":{"username":"dev1"},"objectRef":{"resource":"pods","namespace":"prod","name":"web-1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2020-06-02T02:10:00.000000Z","annotations":{"authorization.k8s.io/decision":"allow","authorization.k8s.io/reason":"RBAC: allowed by ClusterRoleBinding \"sudo-dev1-admin-fix-prod\" of ClusterRole \"admin\" to User \"dev1\""}}
+{"auditID":"2","stage":"ResponseComplete","verb":"get","user":{"username":"dev1"},"objectRef":{"resource":"pods","namespace":"prod","name":"web-1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2020-06-02T02:05:00.000000Z","annotations":{"authorization.k8s.io/decision":"allow","authorization.k8s.io/reason":"RBAC: allowed by ClusterRoleBinding \"view\" of ClusterRole \"view\" to Group \"devs\""}}
+{"auditID":"3","stage":"RequestReceived","verb":"get","user":{"username":"dev1"},"requestReceivedTimestamp":"2020-06-02T02:05:00.000000Z"}
+{"auditID":"4","stage":"ResponseComplete","verb":"get","user":{"username":"dev2"},"requestReceivedTimestamp":"2020-06-02T02:05:00.000000Z"}
+{"auditID":"5","stage":"ResponseComplete","verb":"get","user":{"username":"dev1"},"requestReceivedTimestamp":"2020-06-02T03:05:00.000000Z"}
+`
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	sudoRequests := filepath.Join(dir, "sudorequests.yaml")
+	auditLog := filepath.Join(dir, "audit.log")
+	if err := ioutil.WriteFile(sudoRequests, []byte(testSudoRequests), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	if err := ioutil.WriteFile(auditLog, []byte(testAuditLog), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"report", "--sudorequests", sudoRequests, "--output", "json", auditLog}, &out); err != nil {
+		t.Fatalf("report returned an error: %v", err)
+	}
+	var reports []requestReport
+	if err := json.Unmarshal(out.Bytes(), &reports); err != nil {
+		t.Fatalf("error decoding report: %v: %s", err, out.String())
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected a report for the granted request only: %s", out.String())
+	}
+	actions := reports[0].Actions
+	if len(actions) != 2 {
+		t.Fatalf("wrong number of actions: %+v", actions)
+	}
+	// The actions are ordered by time
+	if got, want := actions[0].AuditID, "2"; got != want {
+		t.Errorf("wrong first action: (got != want) %q != %q", got, want)
+	}
+	if actions[0].Escalated {
+		t.Errorf("action allowed by another binding is marked as escalated")
+	}
+	if !actions[1].Escalated {
+		t.Errorf("action allowed by the SudoRequest's binding isn't marked as escalated")
+	}
+
+	for _, output := range []string{"table", "csv"} {
+		out.Reset()
+		if err := run([]string{"report", "--sudorequests", sudoRequests, "--output", output, auditLog}, &out); err != nil {
+			t.Fatalf("report returned an error: %v", err)
+		}
+		if !strings.Contains(out.String(), "web-1") {
+			t.Errorf("%s output doesn't include the actions: %s", output, out.String())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// APIAuditServer serves the APIAuditHandler over TLS on its own address,
+// requiring a client certificate signed by the client CA. It is separate
+// from the webhook server as requiring a client certificate there would
+// also require one from the API server's admission webhook calls.
+type APIAuditServer struct {
+	// The address to listen on, such as ":9444"
+	Addr string
+	// The files holding the serving certificate and key. They are read
+	// for each new connection, so that renewed certificates are used.
+	CertFile string
+	KeyFile  string
+	// The file holding the PEM encoded CA certificates that client
+	// certificates must be signed by
+	ClientCAFile string
+	Handler      *APIAuditHandler
+}
+
+func (s *APIAuditServer) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(s)
+}
+
+// NeedLeaderElection returns false, as the events may be sent to any
+// replica of the manager
+func (s *APIAuditServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves until stop is closed
+func (s *APIAuditServer) Start(stop <-chan struct{}) error {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(APIAuditWebhookPath, s.Handler)
+	srv := &http.Server{
+		Addr:      s.Addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServeTLS("", "")
+	}()
+	select {
+	case err := <-errs:
+		return fmt.Errorf("unable to serve audit webhook: %v", err)
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}
+}
+
+// tlsConfig returns the TLS config that requires and verifies client
+// certificates
+func (s *APIAuditServer) tlsConfig() (*tls.Config, error) {
+	caPEM, err := ioutil.ReadFile(s.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read client CA file: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", s.ClientCAFile)
+	}
+	if _, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile); err != nil {
+		return nil, fmt.Errorf("unable to load serving certificate: %v", err)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		},
+	}, nil
+}
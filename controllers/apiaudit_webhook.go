@@ -0,0 +1,196 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/apiaudit"
+)
+
+const (
+	APIAuditWebhookPath = "/audit-k8s-io-v1-eventlist"
+
+	// The number of API requests kept in the status of each request
+	maxRecentActions = 20
+	// The largest batch of events that is read
+	maxEventListSize = 10 * 1024 * 1024
+)
+
+// APIAuditHandler is an audit webhook backend for the API server. It
+// finds the API requests that were made using the access granted by a
+// SudoRequest and records them in its status. It is served by an
+// APIAuditServer, which verifies the API server's client certificate.
+type APIAuditHandler struct {
+	Client client.Client
+	Log    logr.Logger
+	// The common names allowed in the client certificate. If empty any
+	// certificate signed by the client CA is allowed.
+	ClientNames []string
+}
+
+func (h *APIAuditHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := h.authenticate(req); err != nil {
+		h.Log.Info("Rejected audit events", "reason", err.Error(), "remote", req.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var events apiaudit.EventList
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxEventListSize)).Decode(&events); err != nil {
+		http.Error(w, fmt.Sprintf("unable to decode events: %v", err), http.StatusBadRequest)
+		return
+	}
+	if events.APIVersion != apiaudit.APIVersion || events.Kind != apiaudit.EventListKind {
+		http.Error(w, fmt.Sprintf("expected %s %s, got %s %s", apiaudit.APIVersion, apiaudit.EventListKind, events.APIVersion, events.Kind), http.StatusBadRequest)
+		return
+	}
+	if err := h.Attribute(req.Context(), events.Items); err != nil {
+		h.Log.Error(err, "unable to record API requests")
+		http.Error(w, "unable to record API requests", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticate checks that the request was made with a verified client
+// certificate with one of the allowed common names
+func (h *APIAuditHandler) authenticate(req *http.Request) error {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return fmt.Errorf("no verified client certificate")
+	}
+	if len(h.ClientNames) == 0 {
+		return nil
+	}
+	name := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	for _, allowed := range h.ClientNames {
+		if name == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("client certificate common name %q isn't allowed", name)
+}
+
+// Attribute finds the SudoRequest that granted the access used by
+// each event, and records the API requests in their status
+func (h *APIAuditHandler) Attribute(ctx context.Context, events []apiaudit.Event) error {
+	var sudoReqs k8sudov1alpha1.SudoRequestList
+	if err := h.Client.List(ctx, &sudoReqs); err != nil {
+		return err
+	}
+	actions := map[string][]k8sudov1alpha1.SudoRequestAction{}
+	var names []string
+	for i := range events {
+		sudoReq := attributeEvent(&events[i], sudoReqs.Items)
+		if sudoReq == nil {
+			continue
+		}
+		if _, ok := actions[sudoReq.Name]; !ok {
+			names = append(names, sudoReq.Name)
+		}
+		actions[sudoReq.Name] = append(actions[sudoReq.Name], events[i].Action())
+	}
+	for _, name := range names {
+		if err := h.recordActions(ctx, name, actions[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordActions adds the actions to the status of the named request,
+// retrying if the request is changed at the same time
+func (h *APIAuditHandler) recordActions(ctx context.Context, name string, actions []k8sudov1alpha1.SudoRequestAction) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		var sudoReq k8sudov1alpha1.SudoRequest
+		if err := h.Client.Get(ctx, types.NamespacedName{Name: name}, &sudoReq); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		addActions(&sudoReq, actions)
+		return h.Client.Status().Update(ctx, &sudoReq)
+	})
+}
+
+// attributeEvent returns the request that granted the access used by
+// the API request in the event, or nil if it didn't use any. The binding
+// the RBAC authorizer names as allowing the request is used if it gives
+// one, and otherwise any request granting access to the user at the time.
+func attributeEvent(event *apiaudit.Event, sudoReqs []k8sudov1alpha1.SudoRequest) *k8sudov1alpha1.SudoRequest {
+	if !event.Complete() || event.Forbidden() {
+		return nil
+	}
+	user := event.EffectiveUser()
+	if binding, ok := event.AllowedBy(); ok {
+		if binding == "" {
+			return nil
+		}
+		for i := range sudoReqs {
+			if isBindingFor(&sudoReqs[i], binding) && apiaudit.SubjectMatches(&sudoReqs[i], user) {
+				return &sudoReqs[i]
+			}
+		}
+		return nil
+	}
+	for i := range sudoReqs {
+		if apiaudit.SubjectMatches(&sudoReqs[i], user) && apiaudit.ActiveAt(&sudoReqs[i], event.RequestReceivedTimestamp.Time) {
+			return &sudoReqs[i]
+		}
+	}
+	return nil
+}
+
+// isBindingFor returns whether the named binding was created for the
+// request. The name is checked against the one the controller creates
+// as well as those in the status, as the API request may be made
+// before the status is updated.
+func isBindingFor(sudoReq *k8sudov1alpha1.SudoRequest, name string) bool {
+	if name == crbName(sudoReq) {
+		return true
+	}
+	for _, binding := range apiaudit.BindingNames(sudoReq) {
+		if binding == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addActions counts the actions and adds them to the recent actions of
+// the request, dropping the oldest to keep the list bounded
+func addActions(sudoReq *k8sudov1alpha1.SudoRequest, actions []k8sudov1alpha1.SudoRequestAction) {
+	if sudoReq.Status.Actions == nil {
+		sudoReq.Status.Actions = &k8sudov1alpha1.SudoRequestActions{}
+	}
+	status := sudoReq.Status.Actions
+	status.Count += int64(len(actions))
+	recent := append(status.Recent, actions...)
+	if len(recent) > maxRecentActions {
+		recent = append([]k8sudov1alpha1.SudoRequestAction(nil), recent[len(recent)-maxRecentActions:]...)
+	}
+	status.Recent = recent
+}
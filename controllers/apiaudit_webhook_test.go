@@ -0,0 +1,306 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/apiaudit"
+)
+
+func TestAttributeEvent(t *testing.T) {
+	grantedAt := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)
+	sudoReqs := []k8sudov1alpha1.SudoRequest{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "user-request"},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{User: "dev1", Role: "admin"},
+			Status: k8sudov1alpha1.SudoRequestStatus{
+				GrantedAt: &metav1.Time{Time: grantedAt},
+				Expires:   &metav1.Time{Time: grantedAt.Add(time.Hour)},
+				History: []k8sudov1alpha1.SudoRequestHistoryEntry{{
+					Status: k8sudov1alpha1.SudoRequestStatusRevoked,
+					Time:   metav1.Time{Time: grantedAt.Add(30 * time.Minute)},
+				}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "group-request"},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{Group: "sre", Role: "edit"},
+			Status: k8sudov1alpha1.SudoRequestStatus{
+				GrantedAt: &metav1.Time{Time: grantedAt},
+				Expires:   &metav1.Time{Time: grantedAt.Add(time.Hour)},
+			},
+		},
+	}
+	event := func(user string, groups []string, at time.Duration, annotations map[string]string) *apiaudit.Event {
+		return &apiaudit.Event{
+			Stage:                    apiaudit.StageResponseComplete,
+			Verb:                     "delete",
+			User:                     authnv1.UserInfo{Username: user, Groups: groups},
+			RequestReceivedTimestamp: metav1.MicroTime{Time: grantedAt.Add(at)},
+			Annotations:              annotations,
+		}
+	}
+	allowedBy := func(binding string) map[string]string {
+		return map[string]string{
+			apiaudit.DecisionAnnotation: apiaudit.DecisionAllow,
+			apiaudit.ReasonAnnotation:   fmt.Sprintf(`RBAC: allowed by ClusterRoleBinding %q of ClusterRole "admin" to User "dev1"`, binding),
+		}
+	}
+
+	tests := []struct {
+		name            string
+		event           *apiaudit.Event
+		expectedRequest string
+	}{
+		{
+			name:            "user while granted",
+			event:           event("dev1", nil, time.Minute, nil),
+			expectedRequest: "user-request",
+		},
+		{
+			name:  "user before granted",
+			event: event("dev1", nil, -time.Minute, nil),
+		},
+		{
+			name:  "user after revoked",
+			event: event("dev1", nil, 45*time.Minute, nil),
+		},
+		{
+			name:            "group member while granted",
+			event:           event("dev2", []string{"sre"}, 45*time.Minute, nil),
+			expectedRequest: "group-request",
+		},
+		{
+			name:  "other user",
+			event: event("dev2", nil, time.Minute, nil),
+		},
+		{
+			name:            "allowed by the binding",
+			event:           event("dev1", nil, 45*time.Minute, allowedBy(crbName(&sudoReqs[0]))),
+			expectedRequest: "user-request",
+		},
+		{
+			name:  "allowed by another binding",
+			event: event("dev1", nil, time.Minute, allowedBy("cluster-admins")),
+		},
+		{
+			name: "forbidden",
+			event: event("dev1", nil, time.Minute, map[string]string{
+				apiaudit.DecisionAnnotation: "forbid",
+			}),
+		},
+		{
+			name: "not complete",
+			event: func() *apiaudit.Event {
+				e := event("dev1", nil, time.Minute, nil)
+				e.Stage = apiaudit.StageRequestReceived
+				return e
+			}(),
+		},
+		{
+			name: "impersonating the user",
+			event: func() *apiaudit.Event {
+				e := event("admin", nil, time.Minute, nil)
+				e.ImpersonatedUser = &authnv1.UserInfo{Username: "dev1"}
+				return e
+			}(),
+			expectedRequest: "user-request",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sudoReq := attributeEvent(test.event, sudoReqs)
+			got := ""
+			if sudoReq != nil {
+				got = sudoReq.Name
+			}
+			if want := test.expectedRequest; got != want {
+				t.Errorf("wrong SudoRequest: (got != want) %q != %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAddActions(t *testing.T) {
+	sudoReq := &k8sudov1alpha1.SudoRequest{}
+	for i := 0; i < maxRecentActions+5; i++ {
+		addActions(sudoReq, []k8sudov1alpha1.SudoRequestAction{{Verb: "get", Name: fmt.Sprintf("pod-%d", i)}})
+	}
+	if got, want := sudoReq.Status.Actions.Count, int64(maxRecentActions+5); got != want {
+		t.Errorf("wrong Count: (got != want) %d != %d", got, want)
+	}
+	if got, want := len(sudoReq.Status.Actions.Recent), maxRecentActions; got != want {
+		t.Fatalf("wrong number of recent actions: (got != want) %d != %d", got, want)
+	}
+	if got, want := sudoReq.Status.Actions.Recent[0].Name, "pod-5"; got != want {
+		t.Errorf("wrong oldest action: (got != want) %q != %q", got, want)
+	}
+}
+
+func TestAPIAuditHandler(t *testing.T) {
+	grantedAt := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "request"},
+		Spec:       k8sudov1alpha1.SudoRequestSpec{User: "dev1", Role: "admin"},
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			Status:    k8sudov1alpha1.SudoRequestStatusReady,
+			GrantedAt: &metav1.Time{Time: grantedAt},
+			Expires:   &metav1.Time{Time: grantedAt.Add(time.Hour)},
+		},
+	}
+	client := fake.NewFakeClientWithScheme(scheme, sudoReq)
+	h := &APIAuditHandler{Client: client, Log: testinglogr.TestLogger{T: t}, ClientNames: []string{"kube-apiserver"}}
+
+	events := apiaudit.EventList{
+		TypeMeta: metav1.TypeMeta{APIVersion: apiaudit.APIVersion, Kind: apiaudit.EventListKind},
+		Items: []apiaudit.Event{
+			{
+				AuditID:                  "1",
+				Stage:                    apiaudit.StageResponseComplete,
+				Verb:                     "delete",
+				User:                     authnv1.UserInfo{Username: "dev1"},
+				ObjectRef:                &apiaudit.ObjectReference{Resource: "deployments", APIGroup: "apps", Namespace: "prod", Name: "web"},
+				ResponseStatus:           &metav1.Status{Code: http.StatusOK},
+				RequestReceivedTimestamp: metav1.MicroTime{Time: grantedAt.Add(time.Minute)},
+			},
+			{
+				AuditID:                  "2",
+				Stage:                    apiaudit.StageResponseComplete,
+				Verb:                     "get",
+				User:                     authnv1.UserInfo{Username: "dev2"},
+				RequestReceivedTimestamp: metav1.MicroTime{Time: grantedAt.Add(time.Minute)},
+			},
+		},
+	}
+	body, err := json.Marshal(events)
+	if err != nil {
+		t.Fatalf("error encoding events: %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, apiAuditRequest(body, "kube-apiserver"))
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code: (got != want) %d != %d: %s", got, want, w.Body.String())
+	}
+
+	var updated k8sudov1alpha1.SudoRequest
+	if err := client.Get(context.Background(), types.NamespacedName{Name: sudoReq.Name}, &updated); err != nil {
+		t.Fatalf("error getting SudoRequest: %v", err)
+	}
+	if updated.Status.Actions == nil || updated.Status.Actions.Count != 1 {
+		t.Fatalf("expected one action to be recorded: %+v", updated.Status.Actions)
+	}
+	action := updated.Status.Actions.Recent[0]
+	if got, want := action.Resource, "deployments.apps"; got != want {
+		t.Errorf("wrong Resource: (got != want) %q != %q", got, want)
+	}
+	if got, want := action.AuditID, "1"; got != want {
+		t.Errorf("wrong AuditID: (got != want) %q != %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, apiAuditRequest([]byte(`{"apiVersion":"v1","kind":"List"}`), "kube-apiserver"))
+	if got, want := w.Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code for the wrong kind: (got != want) %d != %d", got, want)
+	}
+}
+
+func TestAPIAuditHandlerAuthentication(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	body := []byte(`{"apiVersion":"audit.k8s.io/v1","kind":"EventList","items":[]}`)
+	unverified := httptest.NewRequest(http.MethodPost, APIAuditWebhookPath, bytes.NewReader(body))
+	unverified.TLS = &tls.ConnectionState{}
+	tests := []struct {
+		name         string
+		clientNames  []string
+		req          *http.Request
+		expectedCode int
+	}{
+		{
+			name:         "no TLS",
+			req:          httptest.NewRequest(http.MethodPost, APIAuditWebhookPath, bytes.NewReader(body)),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "no verified certificate",
+			req:          unverified,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "any verified certificate",
+			req:          apiAuditRequest(body, "someone"),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "allowed name",
+			clientNames:  []string{"kube-apiserver"},
+			req:          apiAuditRequest(body, "kube-apiserver"),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "name not allowed",
+			clientNames:  []string{"kube-apiserver"},
+			req:          apiAuditRequest(body, "someone"),
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &APIAuditHandler{
+				Client:      fake.NewFakeClientWithScheme(scheme),
+				Log:         testinglogr.TestLogger{T: t},
+				ClientNames: test.clientNames,
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, test.req)
+			if got, want := w.Code, test.expectedCode; got != want {
+				t.Errorf("wrong status code: (got != want) %d != %d: %s", got, want, w.Body.String())
+			}
+		})
+	}
+}
+
+// apiAuditRequest returns a request to the audit webhook made with a
+// verified client certificate with the common name
+func apiAuditRequest(body []byte, commonName string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, APIAuditWebhookPath, bytes.NewReader(body))
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}},
+	}
+	return req
+}
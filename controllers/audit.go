@@ -0,0 +1,209 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/audit"
+)
+
+// auditRecord returns an audit record describing the request
+func auditRecord(sudoReq *k8sudov1alpha1.SudoRequest, event audit.Event, decision string) audit.Record {
+	record := audit.Record{
+		Event:              event,
+		Decision:           decision,
+		SudoRequest:        sudoReq.Name,
+		Requester:          requesterOf(sudoReq),
+		User:               sudoReq.Spec.User,
+		Group:              sudoReq.Spec.Group,
+		Role:               roleName(sudoReq),
+		RoleKind:           roleKind(sudoReq),
+		Namespace:          grantedNamespace(sudoReq),
+		Reason:             sudoReq.Spec.Reason,
+		ClusterRoleBinding: sudoReq.Status.ClusterRoleBinding,
+		RoleBinding:        sudoReq.Status.RoleBinding,
+	}
+	for _, nsStatus := range sudoReq.Status.Namespaces {
+		if nsStatus.Status == k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			record.Namespaces = append(record.Namespaces, nsStatus.Namespace)
+		}
+	}
+	expires := sudoReq.Status.Expires
+	if expires == nil {
+		expires = sudoReq.Spec.Expires
+	}
+	if expires != nil {
+		t := expires.Time
+		record.Expires = &t
+	}
+	return record
+}
+
+// requesterOf returns who the request was made by. The webhook only
+// allows users to request access for themselves, unless the request
+// was created by a SudoSchedule.
+func requesterOf(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	if sched := scheduleOf(sudoReq); sched != "" {
+		return fmt.Sprintf("%s/%s", sudoScheduleKind, sched)
+	}
+	return sudoReq.Spec.User
+}
+
+// authorizedCondition returns the Authorized condition of the request,
+// or nil if it hasn't been checked
+func authorizedCondition(sudoReq *k8sudov1alpha1.SudoRequest) *k8sudov1alpha1.SudoRequestCondition {
+	for i := range sudoReq.Status.Conditions {
+		if sudoReq.Status.Conditions[i].Type == k8sudov1alpha1.SudoRequestConditionAuthorized {
+			return &sudoReq.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// auditState is the part of the status of a request that changes are
+// audited from
+type auditState struct {
+	status     k8sudov1alpha1.SudoRequestStatusStatus
+	authorized metav1.ConditionStatus
+	extensions []k8sudov1alpha1.SudoRequestExtensionStatusStatus
+}
+
+func auditStateOf(sudoReq *k8sudov1alpha1.SudoRequest) auditState {
+	state := auditState{status: sudoReq.Status.Status}
+	if condition := authorizedCondition(sudoReq); condition != nil {
+		state.authorized = condition.Status
+	}
+	for _, extStatus := range sudoReq.Status.Extensions {
+		state.extensions = append(state.extensions, extStatus.Status)
+	}
+	return state
+}
+
+// auditChanges records the decisions made since the request was in the
+// previous state: the result of the access review, approval or
+// rejection, the review of any extensions, and revocation or expiry.
+// Access being granted is recorded as each binding is created.
+func (r *SudoRequestReconciler) auditChanges(sudoReq *k8sudov1alpha1.SudoRequest, previous auditState) {
+	if condition := authorizedCondition(sudoReq); condition != nil && condition.Status != previous.authorized {
+		decision := audit.DecisionDenied
+		if condition.Status == metav1.ConditionTrue {
+			decision = audit.DecisionAllowed
+		}
+		r.audit(sudoReq, audit.EventAccessReview, decision, condition.Message)
+	}
+
+	for i, extStatus := range sudoReq.Status.Extensions {
+		switch extStatus.Status {
+		case k8sudov1alpha1.SudoRequestExtensionStatusGranted, k8sudov1alpha1.SudoRequestExtensionStatusDenied:
+		default:
+			continue
+		}
+		if i < len(previous.extensions) && previous.extensions[i] == extStatus.Status {
+			continue
+		}
+		message := extStatus.Reason
+		if message == "" {
+			message = fmt.Sprintf("Extension %d for %s", i, extStatus.Duration.Duration)
+		}
+		r.audit(sudoReq, audit.EventExtension, string(extStatus.Status), message)
+	}
+
+	status := sudoReq.Status.Status
+	if status == previous.status {
+		return
+	}
+	switch status {
+	case k8sudov1alpha1.SudoRequestStatusRejected:
+		r.audit(sudoReq, audit.EventApproval, string(status), sudoReq.Status.Reason)
+	case k8sudov1alpha1.SudoRequestStatusPending:
+		if previous.status == k8sudov1alpha1.SudoRequestStatusAwaitingApproval {
+			r.audit(sudoReq, audit.EventApproval, "Approved", fmt.Sprintf("Approved by %s", strings.Join(sudoReq.Status.Approvers, ", ")))
+		}
+	case k8sudov1alpha1.SudoRequestStatusRevoked:
+		record := auditRecord(sudoReq, audit.EventRevocation, string(status))
+		if revoked := sudoReq.Spec.Revoked; revoked != nil {
+			record.Requester = revoked.User
+			record.Message = revoked.Reason
+		}
+		record.Time = r.Now()
+		r.Audit.Record(record)
+	case k8sudov1alpha1.SudoRequestStatusExpired:
+		r.audit(sudoReq, audit.EventExpiry, string(status), sudoReq.Status.Reason)
+	}
+}
+
+// audit records a decision about the request
+func (r *SudoRequestReconciler) audit(sudoReq *k8sudov1alpha1.SudoRequest, event audit.Event, decision, message string) {
+	record := auditRecord(sudoReq, event, decision)
+	record.Time = r.Now()
+	record.Message = message
+	r.Audit.Record(record)
+}
+
+// auditGranted records a binding being created to grant access, in the
+// given namespace or cluster-wide
+func (r *SudoRequestReconciler) auditGranted(sudoReq *k8sudov1alpha1.SudoRequest, namespace string) {
+	record := auditRecord(sudoReq, audit.EventGrant, audit.DecisionGranted)
+	record.Time = r.Now()
+	if namespace == "" {
+		record.ClusterRoleBinding = bindingName(sudoReq, "")
+	} else {
+		record.Namespace = namespace
+		record.RoleBinding = bindingName(sudoReq, namespace)
+	}
+	r.Audit.Record(record)
+}
+
+// auditRemoved records the bindings of an expired or revoked request
+// being deleted
+func (r *SudoRequestReconciler) auditRemoved(sudoReq *k8sudov1alpha1.SudoRequest) {
+	event := audit.EventExpiry
+	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusRevoked {
+		event = audit.EventRevocation
+	}
+	r.audit(sudoReq, event, audit.DecisionRemoved, fmt.Sprintf("Removed access to %s", sudoReq.Spec.Role))
+}
+
+// auditDeleted records a request being deleted, and whether that
+// removed any access it still granted
+func (r *SudoRequestReconciler) auditDeleted(sudoReq *k8sudov1alpha1.SudoRequest, removed bool) {
+	if removed {
+		r.audit(sudoReq, audit.EventDeletion, audit.DecisionRemoved, fmt.Sprintf("Deleted, removed access to %s", sudoReq.Spec.Role))
+		return
+	}
+	r.audit(sudoReq, audit.EventDeletion, audit.DecisionDeleted, "Deleted")
+}
+
+// auditAdmission records the webhook's decision on a change to the
+// request
+func (h *SudoReqHandler) auditAdmission(sudoReq *k8sudov1alpha1.SudoRequest, req admission.Request, resp admission.Response) {
+	decision := audit.DecisionAllowed
+	if !resp.Allowed {
+		decision = audit.DecisionDenied
+	}
+	record := auditRecord(sudoReq, audit.EventAdmission, decision)
+	record.Operation = string(req.Operation)
+	record.Requester = req.UserInfo.Username
+	if resp.Result != nil {
+		record.Message = resp.Result.Message
+	}
+	h.Audit.Record(record)
+}
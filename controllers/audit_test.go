@@ -0,0 +1,241 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/audit"
+)
+
+// auditRecords decodes the records written to buf
+func auditRecords(t *testing.T, buf *bytes.Buffer) []audit.Record {
+	var records []audit.Record
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		var record audit.Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("error decoding audit record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditChanges(t *testing.T) {
+	authorized := func(status metav1.ConditionStatus) []k8sudov1alpha1.SudoRequestCondition {
+		return []k8sudov1alpha1.SudoRequestCondition{{
+			Type:   k8sudov1alpha1.SudoRequestConditionAuthorized,
+			Status: status,
+		}}
+	}
+	tests := []struct {
+		name              string
+		previous          auditState
+		spec              k8sudov1alpha1.SudoRequestSpec
+		status            k8sudov1alpha1.SudoRequestStatus
+		expectedEvents    []audit.Event
+		expectedDecisions []string
+		expectedRequester string
+	}{
+		{
+			name: "authorized",
+			status: k8sudov1alpha1.SudoRequestStatus{
+				Status:     k8sudov1alpha1.SudoRequestStatusPending,
+				Conditions: authorized(metav1.ConditionTrue),
+			},
+			expectedEvents:    []audit.Event{audit.EventAccessReview},
+			expectedDecisions: []string{audit.DecisionAllowed},
+			expectedRequester: "user",
+		},
+		{
+			name: "not authorized",
+			status: k8sudov1alpha1.SudoRequestStatus{
+				Status:     k8sudov1alpha1.SudoRequestStatusDenied,
+				Conditions: authorized(metav1.ConditionFalse),
+			},
+			expectedEvents:    []audit.Event{audit.EventAccessReview},
+			expectedDecisions: []string{audit.DecisionDenied},
+			expectedRequester: "user",
+		},
+		{
+			name: "approved",
+			previous: auditState{
+				status:     k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+				authorized: metav1.ConditionTrue,
+			},
+			status: k8sudov1alpha1.SudoRequestStatus{
+				Status:     k8sudov1alpha1.SudoRequestStatusPending,
+				Conditions: authorized(metav1.ConditionTrue),
+				Approvers:  []string{"approver"},
+			},
+			expectedEvents:    []audit.Event{audit.EventApproval},
+			expectedDecisions: []string{"Approved"},
+			expectedRequester: "user",
+		},
+		{
+			name: "extension granted",
+			previous: auditState{
+				status:     k8sudov1alpha1.SudoRequestStatusReady,
+				authorized: metav1.ConditionTrue,
+			},
+			status: k8sudov1alpha1.SudoRequestStatus{
+				Status:     k8sudov1alpha1.SudoRequestStatusReady,
+				Conditions: authorized(metav1.ConditionTrue),
+				Extensions: []k8sudov1alpha1.SudoRequestExtensionStatus{{
+					Duration: metav1.Duration{Duration: time.Hour},
+					Status:   k8sudov1alpha1.SudoRequestExtensionStatusGranted,
+				}},
+			},
+			expectedEvents:    []audit.Event{audit.EventExtension},
+			expectedDecisions: []string{string(k8sudov1alpha1.SudoRequestExtensionStatusGranted)},
+			expectedRequester: "user",
+		},
+		{
+			name: "extension already reviewed",
+			previous: auditState{
+				status:     k8sudov1alpha1.SudoRequestStatusReady,
+				authorized: metav1.ConditionTrue,
+				extensions: []k8sudov1alpha1.SudoRequestExtensionStatusStatus{k8sudov1alpha1.SudoRequestExtensionStatusGranted},
+			},
+			status: k8sudov1alpha1.SudoRequestStatus{
+				Status:     k8sudov1alpha1.SudoRequestStatusReady,
+				Conditions: authorized(metav1.ConditionTrue),
+				Extensions: []k8sudov1alpha1.SudoRequestExtensionStatus{{
+					Duration: metav1.Duration{Duration: time.Hour},
+					Status:   k8sudov1alpha1.SudoRequestExtensionStatusGranted,
+				}},
+			},
+		},
+		{
+			name: "revoked",
+			previous: auditState{
+				status:     k8sudov1alpha1.SudoRequestStatusReady,
+				authorized: metav1.ConditionTrue,
+			},
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				Revoked: &k8sudov1alpha1.SudoRequestRevocation{User: "admin", Reason: "Done"},
+			},
+			status: k8sudov1alpha1.SudoRequestStatus{
+				Status:     k8sudov1alpha1.SudoRequestStatusRevoked,
+				Conditions: authorized(metav1.ConditionTrue),
+			},
+			expectedEvents:    []audit.Event{audit.EventRevocation},
+			expectedDecisions: []string{string(k8sudov1alpha1.SudoRequestStatusRevoked)},
+			expectedRequester: "admin",
+		},
+		{
+			name: "expired",
+			previous: auditState{
+				status:     k8sudov1alpha1.SudoRequestStatusReady,
+				authorized: metav1.ConditionTrue,
+			},
+			status: k8sudov1alpha1.SudoRequestStatus{
+				Status:     k8sudov1alpha1.SudoRequestStatusExpired,
+				Conditions: authorized(metav1.ConditionTrue),
+			},
+			expectedEvents:    []audit.Event{audit.EventExpiry},
+			expectedDecisions: []string{string(k8sudov1alpha1.SudoRequestStatusExpired)},
+			expectedRequester: "user",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			now := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)
+			r := &SudoRequestReconciler{
+				Log:   testinglogr.TestLogger{T: t},
+				Clock: FakeClock{CurrentTime: now},
+				Audit: audit.NewLogger(testinglogr.TestLogger{T: t}, nil, audit.NewWriterSink("test", &buf)),
+			}
+			sudoReq := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "request"},
+				Spec:       test.spec,
+				Status:     test.status,
+			}
+			sudoReq.Spec.User = "user"
+			sudoReq.Spec.Role = "role"
+			r.auditChanges(sudoReq, test.previous)
+
+			records := auditRecords(t, &buf)
+			if got, want := len(records), len(test.expectedEvents); got != want {
+				t.Fatalf("wrong number of records: (got != want) %d != %d: %+v", got, want, records)
+			}
+			for i, record := range records {
+				if got, want := record.Event, test.expectedEvents[i]; got != want {
+					t.Errorf("wrong Event: (got != want) %q != %q", got, want)
+				}
+				if got, want := record.Decision, test.expectedDecisions[i]; got != want {
+					t.Errorf("wrong Decision: (got != want) %q != %q", got, want)
+				}
+				if got, want := record.Requester, test.expectedRequester; got != want {
+					t.Errorf("wrong Requester: (got != want) %q != %q", got, want)
+				}
+				if got, want := record.Time, now; !got.Equal(want) {
+					t.Errorf("wrong Time: (got != want) %s != %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditGranted(t *testing.T) {
+	var buf bytes.Buffer
+	r := &SudoRequestReconciler{
+		Log:   testinglogr.TestLogger{T: t},
+		Clock: FakeClock{CurrentTime: time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)},
+		Audit: audit.NewLogger(testinglogr.TestLogger{T: t}, nil, audit.NewWriterSink("test", &buf)),
+	}
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "request"},
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User:   "user",
+			Role:   "role",
+			Reason: "Fixing prod",
+		},
+	}
+	r.auditGranted(sudoReq, "")
+	r.auditGranted(sudoReq, "ns1")
+
+	records := auditRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("wrong number of records: %+v", records)
+	}
+	if got, want := records[0].ClusterRoleBinding, crbName(sudoReq); got != want {
+		t.Errorf("wrong ClusterRoleBinding: (got != want) %q != %q", got, want)
+	}
+	if got, want := records[1].RoleBinding, crbName(sudoReq); got != want {
+		t.Errorf("wrong RoleBinding: (got != want) %q != %q", got, want)
+	}
+	if got, want := records[1].Namespace, "ns1"; got != want {
+		t.Errorf("wrong Namespace: (got != want) %q != %q", got, want)
+	}
+	for _, record := range records {
+		if got, want := record.Reason, "Fixing prod"; got != want {
+			t.Errorf("wrong Reason: (got != want) %q != %q", got, want)
+		}
+	}
+}
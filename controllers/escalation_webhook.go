@@ -0,0 +1,114 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	authv1 "k8s.io/api/authentication/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/apiaudit"
+)
+
+const (
+	EscalationAnnotationWebhookPath = "/annotate-escalated-requests"
+
+	// The keys of the audit annotations. The API server prefixes them
+	// with the name of the webhook, k8sudo.jetstack.io.
+	requestAuditAnnotation = "request"
+	reasonAuditAnnotation  = "reason"
+)
+
+func (h *EscalationAnnotationHandler) SetupWithManager(mgr ctrl.Manager) error {
+	if h.Clock == nil {
+		h.Clock = realClock{}
+	}
+	mgr.GetWebhookServer().Register(EscalationAnnotationWebhookPath, &webhook.Admission{Handler: h})
+	return nil
+}
+
+// EscalationAnnotationHandler is a validating webhook for any API
+// request. It always allows the request, but when the user has been
+// granted access by a SudoRequest it adds audit annotations naming the
+// request and its reason, so that the API server's audit log records
+// why the user had access alongside what they did with it.
+type EscalationAnnotationHandler struct {
+	Client client.Client
+	Log    logr.Logger
+	Clock
+}
+
+func (h *EscalationAnnotationHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	resp := admission.Allowed("")
+	var sudoReqs k8sudov1alpha1.SudoRequestList
+	if err := h.Client.List(ctx, &sudoReqs); err != nil {
+		// The request is allowed regardless, as this webhook only
+		// adds to the audit log
+		h.Log.Error(err, "unable to list SudoRequests", "user", req.UserInfo.Username)
+		return resp
+	}
+	resp.AuditAnnotations = escalationAnnotations(activeRequestsFor(sudoReqs.Items, req.UserInfo, h.Now()))
+	return resp
+}
+
+// activeRequestsFor returns the requests that currently grant access to
+// the user, sorted by name
+func activeRequestsFor(sudoReqs []k8sudov1alpha1.SudoRequest, user authv1.UserInfo, now time.Time) []k8sudov1alpha1.SudoRequest {
+	var active []k8sudov1alpha1.SudoRequest
+	for i := range sudoReqs {
+		sudoReq := &sudoReqs[i]
+		if sudoReq.Status.Status != k8sudov1alpha1.SudoRequestStatusReady {
+			continue
+		}
+		if apiaudit.SubjectMatches(sudoReq, user) && apiaudit.ActiveAt(sudoReq, now) {
+			active = append(active, *sudoReq)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Name < active[j].Name })
+	return active
+}
+
+// escalationAnnotations returns the audit annotations for an API request
+// made while the requests granted access, or nil if there are none. If
+// more than one request is active their names are separated by commas
+// and their reasons by semicolons.
+func escalationAnnotations(active []k8sudov1alpha1.SudoRequest) map[string]string {
+	if len(active) == 0 {
+		return nil
+	}
+	var names, reasons []string
+	for _, sudoReq := range active {
+		names = append(names, sudoReq.Name)
+		if sudoReq.Spec.Reason != "" {
+			reasons = append(reasons, sudoReq.Spec.Reason)
+		}
+	}
+	annotations := map[string]string{
+		requestAuditAnnotation: strings.Join(names, ","),
+	}
+	if len(reasons) > 0 {
+		annotations[reasonAuditAnnotation] = strings.Join(reasons, "; ")
+	}
+	return annotations
+}
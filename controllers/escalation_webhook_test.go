@@ -0,0 +1,124 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+func TestEscalationAnnotationHandler(t *testing.T) {
+	now := time.Date(2020, time.June, 2, 2, 30, 0, 0, time.UTC)
+	granted := func(name, user, group, reason string, expires time.Time) *k8sudov1alpha1.SudoRequest {
+		return &k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{User: user, Group: group, Role: "admin", Reason: reason},
+			Status: k8sudov1alpha1.SudoRequestStatus{
+				Status:    k8sudov1alpha1.SudoRequestStatusReady,
+				GrantedAt: &metav1.Time{Time: now.Add(-30 * time.Minute)},
+				Expires:   &metav1.Time{Time: expires},
+			},
+		}
+	}
+	expired := granted("expired", "dev1", "", "Old fix", now.Add(-time.Minute))
+	expired.Status.Status = k8sudov1alpha1.SudoRequestStatusExpired
+	tests := []struct {
+		name     string
+		sudoReqs []runtime.Object
+		user     authv1.UserInfo
+		expected map[string]string
+	}{
+		{
+			name:     "no requests",
+			user:     authv1.UserInfo{Username: "dev1"},
+			expected: nil,
+		},
+		{
+			name: "active request for the user",
+			sudoReqs: []runtime.Object{
+				granted("fix-prod", "dev1", "", "Fixing prod", now.Add(time.Hour)),
+			},
+			user: authv1.UserInfo{Username: "dev1"},
+			expected: map[string]string{
+				requestAuditAnnotation: "fix-prod",
+				reasonAuditAnnotation:  "Fixing prod",
+			},
+		},
+		{
+			name: "request for another user",
+			sudoReqs: []runtime.Object{
+				granted("fix-prod", "dev2", "", "Fixing prod", now.Add(time.Hour)),
+			},
+			user:     authv1.UserInfo{Username: "dev1"},
+			expected: nil,
+		},
+		{
+			name: "expired request",
+			sudoReqs: []runtime.Object{
+				expired,
+			},
+			user:     authv1.UserInfo{Username: "dev1"},
+			expected: nil,
+		},
+		{
+			name: "requests for the user and their group",
+			sudoReqs: []runtime.Object{
+				granted("maintenance", "", "sre", "Weekly maintenance", now.Add(time.Hour)),
+				granted("fix-prod", "dev1", "", "Fixing prod", now.Add(time.Hour)),
+				granted("no-reason", "dev1", "", "", now.Add(time.Hour)),
+			},
+			user: authv1.UserInfo{Username: "dev1", Groups: []string{"sre"}},
+			expected: map[string]string{
+				requestAuditAnnotation: "fix-prod,maintenance,no-reason",
+				reasonAuditAnnotation:  "Fixing prod; Weekly maintenance",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			h := &EscalationAnnotationHandler{
+				Client: fake.NewFakeClientWithScheme(scheme, test.sudoReqs...),
+				Log:    testinglogr.TestLogger{T: t},
+				Clock:  FakeClock{CurrentTime: now},
+			}
+			req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: admissionv1beta1.Delete,
+				UserInfo:  test.user,
+			}}
+			resp := h.Handle(context.Background(), req)
+			if !resp.Allowed {
+				t.Errorf("request was not allowed: %v", resp.Result)
+			}
+			if got, want := resp.AuditAnnotations, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong audit annotations: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
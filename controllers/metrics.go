@@ -0,0 +1,134 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+const (
+	outcomeGranted  = "granted"
+	outcomeDenied   = "denied"
+	outcomeRejected = "rejected"
+	outcomeError    = "error"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8sudo_requests_total",
+		Help: "The number of SudoRequests by outcome",
+	}, []string{"outcome"})
+
+	grantedDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "k8sudo_granted_duration_seconds",
+		Help:    "How long SudoRequests were granted access for when they were granted",
+		Buckets: prometheus.ExponentialBuckets(60, 2, 10),
+	})
+
+	revocationLateness = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "k8sudo_revocation_lateness_seconds",
+		Help:    "How long after a SudoRequest expired its bindings were deleted",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	})
+
+	webhookDenials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8sudo_webhook_denials_total",
+		Help: "The number of SudoRequests denied by the webhook, by the check that denied them",
+	}, []string{"reason"})
+
+	sweptBindings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8sudo_swept_bindings_total",
+		Help: "The number of bindings deleted by the sweeper, by why they were deleted",
+	}, []string{"reason"})
+
+	activeEscalationsDesc = prometheus.NewDesc(
+		"k8sudo_active_escalations",
+		"The number of SudoRequests that are currently granted, by role",
+		[]string{"role"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(requestsTotal, grantedDuration, revocationLateness, webhookDenials, sweptBindings)
+}
+
+// observeStatusChange records the outcome of a request when its status
+// changes, and how long access was granted for when it becomes Ready
+func observeStatusChange(sudoReq *k8sudov1alpha1.SudoRequest, previous k8sudov1alpha1.SudoRequestStatusStatus) {
+	status := sudoReq.Status.Status
+	if status == previous {
+		return
+	}
+	switch status {
+	case k8sudov1alpha1.SudoRequestStatusReady:
+		requestsTotal.WithLabelValues(outcomeGranted).Inc()
+		if sudoReq.Status.GrantedAt != nil && sudoReq.Status.Expires != nil {
+			grantedDuration.Observe(sudoReq.Status.Expires.Sub(sudoReq.Status.GrantedAt.Time).Seconds())
+		}
+	case k8sudov1alpha1.SudoRequestStatusDenied:
+		requestsTotal.WithLabelValues(outcomeDenied).Inc()
+	case k8sudov1alpha1.SudoRequestStatusRejected:
+		requestsTotal.WithLabelValues(outcomeRejected).Inc()
+	case k8sudov1alpha1.SudoRequestStatusError:
+		requestsTotal.WithLabelValues(outcomeError).Inc()
+	}
+}
+
+// observeRevocation records how long after the request expired its
+// bindings were deleted. Revoked requests are ignored, as they are
+// deleted before they expire.
+func observeRevocation(sudoReq *k8sudov1alpha1.SudoRequest, now time.Time) {
+	if sudoReq.Status.Status != k8sudov1alpha1.SudoRequestStatusExpired || sudoReq.Status.Expires == nil {
+		return
+	}
+	revocationLateness.Observe(now.Sub(sudoReq.Status.Expires.Time).Seconds())
+}
+
+// activeEscalationsCollector counts the Ready SudoRequests by role each
+// time the metrics are collected, so that the count is correct after
+// the controller restarts.
+type activeEscalationsCollector struct {
+	client client.Client
+	log    logr.Logger
+}
+
+func (c *activeEscalationsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeEscalationsDesc
+}
+
+func (c *activeEscalationsCollector) Collect(ch chan<- prometheus.Metric) {
+	var sudoReqs k8sudov1alpha1.SudoRequestList
+	if err := c.client.List(context.Background(), &sudoReqs); err != nil {
+		c.log.Error(err, "unable to list SudoRequests")
+		return
+	}
+	active := map[string]int{}
+	for _, sudoReq := range sudoReqs.Items {
+		if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusReady {
+			active[sudoReq.Spec.Role]++
+		}
+	}
+	for role, count := range active {
+		ch <- prometheus.MustNewConstMetric(activeEscalationsDesc, prometheus.GaugeValue, float64(count), role)
+	}
+}
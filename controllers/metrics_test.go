@@ -0,0 +1,120 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+func TestObserveStatusChange(t *testing.T) {
+	tests := []struct {
+		name            string
+		previous        k8sudov1alpha1.SudoRequestStatusStatus
+		status          k8sudov1alpha1.SudoRequestStatusStatus
+		expectedOutcome string
+	}{
+		{
+			name:            "granted",
+			previous:        k8sudov1alpha1.SudoRequestStatusPending,
+			status:          k8sudov1alpha1.SudoRequestStatusReady,
+			expectedOutcome: outcomeGranted,
+		},
+		{
+			name:            "denied",
+			status:          k8sudov1alpha1.SudoRequestStatusDenied,
+			expectedOutcome: outcomeDenied,
+		},
+		{
+			name:            "rejected",
+			previous:        k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+			status:          k8sudov1alpha1.SudoRequestStatusRejected,
+			expectedOutcome: outcomeRejected,
+		},
+		{
+			name:            "error",
+			status:          k8sudov1alpha1.SudoRequestStatusError,
+			expectedOutcome: outcomeError,
+		},
+		{
+			name:     "unchanged",
+			previous: k8sudov1alpha1.SudoRequestStatusReady,
+			status:   k8sudov1alpha1.SudoRequestStatusReady,
+		},
+		{
+			name:     "expired",
+			previous: k8sudov1alpha1.SudoRequestStatusReady,
+			status:   k8sudov1alpha1.SudoRequestStatusExpired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := map[string]float64{}
+			for _, outcome := range []string{outcomeGranted, outcomeDenied, outcomeRejected, outcomeError} {
+				before[outcome] = testutil.ToFloat64(requestsTotal.WithLabelValues(outcome))
+			}
+			sudoReq := &k8sudov1alpha1.SudoRequest{
+				Status: k8sudov1alpha1.SudoRequestStatus{Status: test.status},
+			}
+			observeStatusChange(sudoReq, test.previous)
+			for outcome, count := range before {
+				expected := count
+				if outcome == test.expectedOutcome {
+					expected++
+				}
+				if got, want := testutil.ToFloat64(requestsTotal.WithLabelValues(outcome)), expected; got != want {
+					t.Errorf("wrong count of %s requests: (got != want) %v != %v", outcome, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestActiveEscalationsCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	sudoReq := func(name, role string, status k8sudov1alpha1.SudoRequestStatusStatus) *k8sudov1alpha1.SudoRequest {
+		return &k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{User: "user", Role: role},
+			Status:     k8sudov1alpha1.SudoRequestStatus{Status: status},
+		}
+	}
+	client := fake.NewFakeClientWithScheme(scheme,
+		sudoReq("one", "admin", k8sudov1alpha1.SudoRequestStatusReady),
+		sudoReq("two", "admin", k8sudov1alpha1.SudoRequestStatusReady),
+		sudoReq("three", "view", k8sudov1alpha1.SudoRequestStatusReady),
+		sudoReq("four", "edit", k8sudov1alpha1.SudoRequestStatusExpired),
+	)
+	collector := &activeEscalationsCollector{client: client, log: testinglogr.TestLogger{T: t}}
+	expected := `
+# HELP k8sudo_active_escalations The number of SudoRequests that are currently granted, by role
+# TYPE k8sudo_active_escalations gauge
+k8sudo_active_escalations{role="admin"} 2
+k8sudo_active_escalations{role="view"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
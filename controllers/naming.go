@@ -0,0 +1,111 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+const (
+	bindingNamePrefix = "sudo-"
+	// The number of hex characters of the hash kept in binding names
+	bindingNameHashLength = 10
+)
+
+// crbName returns the name given to the bindings created for the
+// request. The subject, role and request name are made DNS-safe and
+// shortened so that the name is a valid DNS label, and end with a hash
+// of them and the request's creation time so that names don't collide.
+// The exact values are kept in the binding's labels and annotations.
+func crbName(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		subjectKind(sudoReq),
+		subjectName(sudoReq),
+		roleName(sudoReq),
+		sudoReq.Name,
+		sudoReq.CreationTimestamp.UTC().Format(time.RFC3339),
+	}, "\x00")))
+	suffix := hex.EncodeToString(hash[:])[:bindingNameHashLength]
+
+	readable := dnsSafe(subjectName(sudoReq) + "-" + roleName(sudoReq) + "-" + sudoReq.Name)
+	if max := validation.DNS1123LabelMaxLength - len(bindingNamePrefix) - len(suffix) - 1; len(readable) > max {
+		readable = strings.TrimRight(readable[:max], "-")
+	}
+	if readable == "" {
+		return bindingNamePrefix + suffix
+	}
+	return bindingNamePrefix + readable + "-" + suffix
+}
+
+// bindingName returns the name of the request's ClusterRoleBinding, or
+// of its RoleBinding in the namespace. The name recorded in the status
+// is used if there is one, so that bindings created before the naming
+// scheme changed are still found.
+func bindingName(sudoReq *k8sudov1alpha1.SudoRequest, namespace string) string {
+	switch {
+	case namespace == "" && sudoReq.Status.ClusterRoleBinding != "":
+		return sudoReq.Status.ClusterRoleBinding
+	case namespace != "" && namespace == grantedNamespace(sudoReq) && sudoReq.Status.RoleBinding != "":
+		return sudoReq.Status.RoleBinding
+	}
+	if namespace != "" {
+		for _, nsStatus := range sudoReq.Status.Namespaces {
+			if nsStatus.Namespace == namespace && nsStatus.RoleBinding != "" {
+				return nsStatus.RoleBinding
+			}
+		}
+	}
+	return crbName(sudoReq)
+}
+
+// labelValue returns the value as it is if it is a valid label value,
+// and otherwise made DNS-safe and shortened, such as for email
+// addresses and OIDC usernames
+func labelValue(value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+	value = dnsSafe(value)
+	if len(value) > validation.LabelValueMaxLength {
+		value = strings.TrimRight(value[:validation.LabelValueMaxLength], "-")
+	}
+	return value
+}
+
+// dnsSafe lowercases the value and replaces each run of characters other
+// than letters and digits with a single "-", without any at either end
+func dnsSafe(value string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(value) {
+		if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
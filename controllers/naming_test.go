@@ -0,0 +1,157 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+func TestCrbName(t *testing.T) {
+	created := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)
+	sudoReq := func(user, group, role, name string, created time.Time) *k8sudov1alpha1.SudoRequest {
+		return &k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Time{Time: created}},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{User: user, Group: group, Role: role},
+		}
+	}
+	tests := []struct {
+		name           string
+		sudoReq        *k8sudov1alpha1.SudoRequest
+		expectedPrefix string
+	}{
+		{
+			name:           "simple",
+			sudoReq:        sudoReq("dev1", "", "cluster-admin", "fix-prod", created),
+			expectedPrefix: "sudo-dev1-cluster-admin-fix-prod-",
+		},
+		{
+			name:           "email",
+			sudoReq:        sudoReq("alice@example.com", "", "cluster-admin", "fix-prod", created),
+			expectedPrefix: "sudo-alice-example-com-cluster-admin-fix-prod-",
+		},
+		{
+			name:           "OIDC username",
+			sudoReq:        sudoReq("https://issuer#Alice@example.com", "", "cluster-admin", "fix-prod", created),
+			expectedPrefix: "sudo-https-issuer-alice-example-com-cluster-admin-",
+		},
+		{
+			name:           "system role",
+			sudoReq:        sudoReq("", "oidc:sre", "system:controller:namespace-controller", "fix-prod", created),
+			expectedPrefix: "sudo-oidc-sre-system-controller-namespace-controller-",
+		},
+		{
+			name:           "long request name",
+			sudoReq:        sudoReq("dev1", "", "admin", strings.Repeat("a", 253), created),
+			expectedPrefix: "sudo-dev1-admin-aaaa",
+		},
+		{
+			name:           "nothing readable",
+			sudoReq:        sudoReq("@", "", "", "", created),
+			expectedPrefix: "sudo-",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := crbName(test.sudoReq)
+			if !strings.HasPrefix(name, test.expectedPrefix) {
+				t.Errorf("wrong name, expected prefix %q: %s", test.expectedPrefix, name)
+			}
+			if errs := validation.IsDNS1123Label(name); len(errs) != 0 {
+				t.Errorf("invalid name %q: %v", name, errs)
+			}
+			if got, want := crbName(test.sudoReq), name; got != want {
+				t.Errorf("name isn't deterministic: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+
+	// Names that would be the same once shortened or made DNS-safe, and
+	// requests created again with the same name, don't collide
+	names := map[string]bool{}
+	for _, sudoReq := range []*k8sudov1alpha1.SudoRequest{
+		sudoReq("alice@example.com", "", "admin", "fix-prod", created),
+		sudoReq("alice.example.com", "", "admin", "fix-prod", created),
+		sudoReq("", "alice@example.com", "admin", "fix-prod", created),
+		sudoReq("alice@example.com", "", "admin", "fix-prod", created.Add(time.Second)),
+		sudoReq("dev1", "", "admin", strings.Repeat("a", 100)+"1", created),
+		sudoReq("dev1", "", "admin", strings.Repeat("a", 100)+"2", created),
+	} {
+		name := crbName(sudoReq)
+		if names[name] {
+			t.Errorf("name collides: %s", name)
+		}
+		names[name] = true
+	}
+}
+
+func TestBindingName(t *testing.T) {
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "fix-prod"},
+		Spec:       k8sudov1alpha1.SudoRequestSpec{User: "dev1", Role: "admin"},
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			ClusterRoleBinding: "sudo-dev1-admin-fix-prod-2020.06.02.02.00.00",
+			Namespaces: []k8sudov1alpha1.SudoRequestNamespaceStatus{
+				{Namespace: "a", RoleBinding: "sudo-dev1-admin-fix-prod-2020.06.02.02.00.00"},
+				{Namespace: "b"},
+			},
+		},
+	}
+	tests := []struct {
+		namespace string
+		expected  string
+	}{
+		{namespace: "", expected: "sudo-dev1-admin-fix-prod-2020.06.02.02.00.00"},
+		{namespace: "a", expected: "sudo-dev1-admin-fix-prod-2020.06.02.02.00.00"},
+		{namespace: "b", expected: crbName(sudoReq)},
+		{namespace: "c", expected: crbName(sudoReq)},
+	}
+
+	for _, test := range tests {
+		if got, want := bindingName(sudoReq, test.namespace), test.expected; got != want {
+			t.Errorf("wrong name in namespace %q: (got != want) %s != %s", test.namespace, got, want)
+		}
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "dev1", expected: "dev1"},
+		{value: "cluster-admin", expected: "cluster-admin"},
+		{value: "alice@example.com", expected: "alice-example-com"},
+		{value: "system:masters", expected: "system-masters"},
+		{value: strings.Repeat("a", 64), expected: strings.Repeat("a", 63)},
+	}
+
+	for _, test := range tests {
+		got := labelValue(test.value)
+		if got != test.expected {
+			t.Errorf("wrong label value for %q: (got != want) %s != %s", test.value, got, test.expected)
+		}
+		if errs := validation.IsValidLabelValue(got); len(errs) != 0 {
+			t.Errorf("invalid label value %q: %v", got, errs)
+		}
+	}
+}
@@ -17,26 +17,56 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/audit"
+	"jetstack.io/k8sudo/pkg/policy"
 )
 
 const (
 	crbOwnerKey     = ".metadata.controller"
-	defaultDuration = 10 * time.Minute
-	maxDuration     = 1 * time.Hour
+	approvalKey     = ".spec.sudoRequest"
 	sudoRequestKind = "SudoRequest"
+
+	// sudoRequestFinalizer is added to a request before access is
+	// granted, so that deleting the request always revokes access
+	// rather than relying on garbage collection of its bindings
+	sudoRequestFinalizer = "k8sudo.jetstack.io/revoke-access"
+
+	// Event reasons, in addition to the status of the request when it
+	// changes
+	eventReasonGranted      = "Granted"
+	eventReasonDeleteFailed = "DeleteFailed"
+	eventReasonTampered     = "Tampered"
+
+	// The actor recorded in the history for changes made by the controller
+	historyActorController = "sudorequest-controller"
+	// The number of changes to the status that are kept in the history
+	maxHistory = 20
 )
 
 var (
@@ -58,6 +88,15 @@ type SudoRequestReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 	Clock
+	// The policy to apply to requests. If nil the built-in defaults
+	// are used.
+	Policy *policy.Store
+	// Records Events on SudoRequests and their bindings as access is
+	// granted and removed. If nil one is created by SetupWithManager.
+	Recorder record.EventRecorder
+	// Records each decision made about a request. If nil nothing is
+	// recorded.
+	Audit *audit.Logger
 }
 
 type realClock struct{}
@@ -83,16 +122,116 @@ func expiryTime(start, requested time.Time, def, max time.Duration) time.Time {
 	return start.Add(duration)
 }
 
-func expiryTimeForRequest(req *k8sudov1alpha1.SudoRequest) time.Time {
+// expiryTimeForRequest measures the duration of the request from when
+// it was granted, so that time spent waiting isn't lost. Until then it
+// is measured from when the request was created, which bounds how long
+// the request can wait to be granted. The requested expiry time is
+// an upper bound, and a requested duration replaces the default. Granted
+// extensions are added on top.
+func expiryTimeForRequest(req *k8sudov1alpha1.SudoRequest, settings policy.Settings) time.Time {
 	requested := time.Time{}
 	if req.Spec.Expires != nil {
 		requested = req.Spec.Expires.Time
 	}
-	return expiryTime(req.GetCreationTimestamp().Time, requested, defaultDuration, maxDuration)
+	start := grantedAt(req)
+	var expires time.Time
+	if req.Spec.Duration != nil {
+		expires = expiryTime(start, time.Time{}, req.Spec.Duration.Duration, settings.MaxDuration)
+		if requested != (time.Time{}) && requested.Before(expires) {
+			expires = requested
+		}
+	} else {
+		expires = expiryTime(start, requested, settings.DefaultDuration, settings.MaxDuration)
+	}
+	for _, extStatus := range req.Status.Extensions {
+		if extStatus.Status == k8sudov1alpha1.SudoRequestExtensionStatusGranted {
+			expires = expires.Add(extStatus.Duration.Duration)
+		}
+	}
+	return expires
+}
+
+// grantedAt returns when the request was granted. If it hasn't been
+// granted yet it is when the request was created, or when it is
+// scheduled to start if that is later.
+func grantedAt(req *k8sudov1alpha1.SudoRequest) time.Time {
+	if req.Status.GrantedAt != nil {
+		return req.Status.GrantedAt.Time
+	}
+	created := req.GetCreationTimestamp().Time
+	if req.Spec.NotBefore != nil && req.Spec.NotBefore.After(created) {
+		return req.Spec.NotBefore.Time
+	}
+	return created
 }
 
 // +kubebuilder:rbac:groups=k8sudo.jetstack.io,resources=sudorequests,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=k8sudo.jetstack.io,resources=sudorequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=k8sudo.jetstack.io,resources=sudorequestapprovals,verbs=get;list;watch
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterrolebindings,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles;roles,verbs=bind
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// setCondition sets the condition of the given type, only changing
+// its transition time if its status has changed
+func (r *SudoRequestReconciler) setCondition(sudoReq *k8sudov1alpha1.SudoRequest, conditionType k8sudov1alpha1.SudoRequestConditionType, status metav1.ConditionStatus, reason, message string) {
+	condition := k8sudov1alpha1.SudoRequestCondition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: sudoReq.Generation,
+		LastTransitionTime: metav1.Time{Time: r.Now()},
+		Reason:             reason,
+		Message:            message,
+	}
+	for i := range sudoReq.Status.Conditions {
+		existing := &sudoReq.Status.Conditions[i]
+		if existing.Type != conditionType {
+			continue
+		}
+		if existing.Status == status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = condition
+		return
+	}
+	sudoReq.Status.Conditions = append(sudoReq.Status.Conditions, condition)
+}
+
+// addHistory records a change to the status of the request, made by
+// actor, in its history. Nothing is recorded if the status is the same
+// as the latest entry. The oldest entries are dropped to keep the
+// history bounded.
+func (r *SudoRequestReconciler) addHistory(sudoReq *k8sudov1alpha1.SudoRequest, actor string) {
+	status := sudoReq.Status.Status
+	history := sudoReq.Status.History
+	if status == "" || len(history) > 0 && history[len(history)-1].Status == status {
+		return
+	}
+	history = append(history, k8sudov1alpha1.SudoRequestHistoryEntry{
+		Status: status,
+		Time:   metav1.Time{Time: r.Now()},
+		Actor:  actor,
+		Reason: sudoReq.Status.Reason,
+	})
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	sudoReq.Status.History = history
+}
+
+// updateGrantedAt records when access was first granted, which is when
+// the oldest of the child bindings was created.
+func (r *SudoRequestReconciler) updateGrantedAt(sudoReq *k8sudov1alpha1.SudoRequest, created metav1.Time) {
+	if created.IsZero() {
+		created = metav1.Time{Time: r.Now()}
+	}
+	if sudoReq.Status.GrantedAt == nil || created.Before(sudoReq.Status.GrantedAt) {
+		sudoReq.Status.GrantedAt = &created
+	}
+}
 
 func (r *SudoRequestReconciler) updateStatusFromChild(sudoReq *k8sudov1alpha1.SudoRequest, childCRB *rbacv1.ClusterRoleBinding) {
 	if childCRB != nil {
@@ -100,47 +239,308 @@ func (r *SudoRequestReconciler) updateStatusFromChild(sudoReq *k8sudov1alpha1.Su
 		sudoReq.Status.Reason = ""
 		// Is this the correct way to reference another object?
 		sudoReq.Status.ClusterRoleBinding = childCRB.GetName()
+		r.updateGrantedAt(sudoReq, childCRB.GetCreationTimestamp())
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionGranted, metav1.ConditionTrue, "BindingCreated",
+			fmt.Sprintf("ClusterRoleBinding %s grants %s", childCRB.GetName(), roleName(sudoReq)))
+	}
+
+	r.updateStatusFromSpec(sudoReq)
+}
+
+func (r *SudoRequestReconciler) updateStatusFromChildRoleBinding(sudoReq *k8sudov1alpha1.SudoRequest, childRB *rbacv1.RoleBinding) {
+	if childRB != nil {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusReady
+		sudoReq.Status.Reason = ""
+		sudoReq.Status.RoleBinding = childRB.GetName()
+		r.updateGrantedAt(sudoReq, childRB.GetCreationTimestamp())
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionGranted, metav1.ConditionTrue, "BindingCreated",
+			fmt.Sprintf("RoleBinding %s grants %s in %s", childRB.GetName(), roleName(sudoReq), childRB.GetNamespace()))
+	}
+
+	r.updateStatusFromSpec(sudoReq)
+}
+
+func (r *SudoRequestReconciler) updateStatusFromChildRoleBindings(sudoReq *k8sudov1alpha1.SudoRequest, childRBs map[string]*rbacv1.RoleBinding) {
+	granted := 0
+	for i := range sudoReq.Status.Namespaces {
+		nsStatus := &sudoReq.Status.Namespaces[i]
+		if nsStatus.Status != k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			continue
+		}
+		granted++
+		if childRB, ok := childRBs[nsStatus.Namespace]; ok {
+			nsStatus.RoleBinding = childRB.GetName()
+		}
 	}
 
-	sudoReq.Status.Expires = &metav1.Time{Time: expiryTimeForRequest(sudoReq)}
+	// Only Ready once the RoleBinding exists in every namespace that
+	// access was granted in
+	if granted > 0 && len(childRBs) == granted {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusReady
+		sudoReq.Status.Reason = ""
+		for _, childRB := range childRBs {
+			r.updateGrantedAt(sudoReq, childRB.GetCreationTimestamp())
+		}
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionGranted, metav1.ConditionTrue, "BindingCreated",
+			fmt.Sprintf("RoleBindings grant %s in %d namespaces", roleName(sudoReq), granted))
+	}
+
+	r.updateStatusFromSpec(sudoReq)
+}
+
+func (r *SudoRequestReconciler) updateStatusFromSpec(sudoReq *k8sudov1alpha1.SudoRequest) {
+	sudoReq.Status.Expires = &metav1.Time{Time: expiryTimeForRequest(sudoReq, r.Policy.ForRole(sudoReq.Spec.Role))}
+
+	// A request that has already expired stays expired, even if it is
+	// revoked afterwards
+	if sudoReq.Spec.Revoked != nil && sudoReq.Status.Status != k8sudov1alpha1.SudoRequestStatusExpired {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusRevoked
+		sudoReq.Status.Reason = fmt.Sprintf("Revoked by %s", sudoReq.Spec.Revoked.User)
+		if sudoReq.Spec.Revoked.Reason != "" {
+			sudoReq.Status.Reason = fmt.Sprintf("Revoked by %s: %s", sudoReq.Spec.Revoked.User, sudoReq.Spec.Revoked.Reason)
+		}
+		r.addHistory(sudoReq, sudoReq.Spec.Revoked.User)
+	}
 
-	if r.Now().After(sudoReq.Status.Expires.Time) {
+	if sudoReq.Status.Status != k8sudov1alpha1.SudoRequestStatusRevoked &&
+		r.Now().After(sudoReq.Status.Expires.Time) {
 		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusExpired
 		sudoReq.Status.Reason = ""
 	}
 
+	switch sudoReq.Status.Status {
+	case k8sudov1alpha1.SudoRequestStatusExpired:
+		message := fmt.Sprintf("Expired at %s", sudoReq.Status.Expires.UTC().Format(time.RFC3339))
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionExpired, metav1.ConditionTrue, "Expired", message)
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionGranted, metav1.ConditionFalse, "Expired", message)
+	case k8sudov1alpha1.SudoRequestStatusRevoked:
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionExpired, metav1.ConditionTrue, "Revoked", sudoReq.Status.Reason)
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionGranted, metav1.ConditionFalse, "Revoked", sudoReq.Status.Reason)
+	default:
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionExpired, metav1.ConditionFalse, "NotExpired",
+			fmt.Sprintf("Expires at %s", sudoReq.Status.Expires.UTC().Format(time.RFC3339)))
+	}
+
 	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusExpired ||
+		sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusRevoked ||
 		sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusReady {
 		return
 	}
 
-	if sudoReq.Spec.User == "" {
+	if sudoReq.Spec.User == "" && sudoReq.Spec.Group == "" {
 		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
 		sudoReq.Status.Reason = "User must be specified"
 		return
 	}
 
+	if sudoReq.Spec.User != "" && sudoReq.Spec.Group != "" {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
+		sudoReq.Status.Reason = "Only one of user and group can be specified"
+		return
+	}
+
 	if sudoReq.Spec.Role == "" {
 		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
 		sudoReq.Status.Reason = "Target role must be specified"
 		return
 	}
+
+	if isNamespaced(sudoReq) && isMultiNamespace(sudoReq) ||
+		len(sudoReq.Spec.Namespaces) > 0 && sudoReq.Spec.NamespaceSelector != nil {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
+		sudoReq.Status.Reason = "Only one of namespace, namespaces and namespaceSelector can be specified"
+		return
+	}
+
+	if sudoReq.Spec.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(sudoReq.Spec.NamespaceSelector); err != nil {
+			sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
+			sudoReq.Status.Reason = fmt.Sprintf("Invalid namespace selector: %s", err)
+			return
+		}
+	}
+
+	switch roleKind(sudoReq) {
+	case k8sudov1alpha1.RoleKindClusterRole:
+	case k8sudov1alpha1.RoleKindRole:
+		if isMultiNamespace(sudoReq) {
+			sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
+			sudoReq.Status.Reason = "A Role can only be granted in a single namespace"
+			return
+		}
+		if sudoReq.Spec.Namespace == "" {
+			sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
+			sudoReq.Status.Reason = "Namespace must be specified for a Role"
+			return
+		}
+	default:
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusError
+		sudoReq.Status.Reason = fmt.Sprintf("Unknown role kind %s", sudoReq.Spec.RoleKind)
+		return
+	}
 }
 
 func (r *SudoRequestReconciler) updateStatusFromAccessReview(sudoReq *k8sudov1alpha1.SudoRequest, sar *authv1.SubjectAccessReview) {
 	if !sar.Status.Allowed || sar.Status.Denied {
 		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusDenied
 		sudoReq.Status.Reason = fmt.Sprintf("Failed to authorize: %s", sar.Status.Reason)
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionFalse, "Denied", sudoReq.Status.Reason)
 		return
 	}
 
 	sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusPending
 	sudoReq.Status.Reason = ""
+	r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionTrue, "Authorized",
+		fmt.Sprintf("%s is allowed to assume %s", subjectName(sudoReq), sudoReq.Spec.Role))
+}
+
+func (r *SudoRequestReconciler) updateStatusFromNamespaces(sudoReq *k8sudov1alpha1.SudoRequest, namespaces []k8sudov1alpha1.SudoRequestNamespaceStatus) {
+	sudoReq.Status.Namespaces = namespaces
+	if len(namespaces) == 0 {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusDenied
+		sudoReq.Status.Reason = "No namespaces matched the request"
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionFalse, "NoNamespaces", sudoReq.Status.Reason)
+		return
+	}
+	granted := 0
+	for _, nsStatus := range namespaces {
+		if nsStatus.Status == k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			granted++
+		}
+	}
+	if granted > 0 {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusPending
+		sudoReq.Status.Reason = ""
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionTrue, "Authorized",
+			fmt.Sprintf("%s is allowed to assume %s in %d of %d namespaces", subjectName(sudoReq), sudoReq.Spec.Role, granted, len(namespaces)))
+		return
+	}
+
+	sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusDenied
+	sudoReq.Status.Reason = "Failed to authorize in any namespace"
+	r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionFalse, "Denied", sudoReq.Status.Reason)
+}
+
+// isOwnApproval returns whether the approval is by someone who may not
+// approve the request: the user it grants access to, a member of the
+// group it grants access to, or the user that created the SudoSchedule
+// that created it. The approver's groups are those recorded in the
+// approval, which the webhook checks.
+func isOwnApproval(sudoReq *k8sudov1alpha1.SudoRequest, scheduleRequester string, approval k8sudov1alpha1.SudoRequestApprovalSpec) bool {
+	if user := subjectUser(sudoReq); user != "" && approval.Approver == user {
+		return true
+	}
+	if scheduleRequester != "" && approval.Approver == scheduleRequester {
+		return true
+	}
+	for _, group := range subjectGroups(sudoReq) {
+		for _, approverGroup := range approval.Groups {
+			if approverGroup == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scheduleRequester returns the user that created the SudoSchedule that
+// created the request, if any
+func scheduleRequester(ctx context.Context, c client.Reader, sudoReq *k8sudov1alpha1.SudoRequest) (string, error) {
+	name := scheduleOf(sudoReq)
+	if name == "" {
+		return "", nil
+	}
+	var sched k8sudov1alpha1.SudoSchedule
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, &sched); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	return sched.Spec.Requester, nil
+}
+
+// approvalDecisions returns the sorted approvers from the approvals of
+// approvers that are authorized to approve the request, or who rejected
+// it and why. Approvals by the requester, members of the requested group
+// and the creator of the request's SudoSchedule are ignored, as is any
+// approver after their first decision. A single rejection rejects the
+// request.
+func approvalDecisions(sudoReq *k8sudov1alpha1.SudoRequest, scheduleRequester string, approvals []k8sudov1alpha1.SudoRequestApproval) ([]string, string, string) {
+	seen := map[string]bool{}
+	approvers := []string{}
+	for _, approval := range approvals {
+		approver := approval.Spec.Approver
+		if isOwnApproval(sudoReq, scheduleRequester, approval.Spec) || seen[approver] {
+			continue
+		}
+		seen[approver] = true
+		if approval.Spec.Decision == k8sudov1alpha1.SudoRequestApprovalDecisionReject {
+			if approval.Spec.Reason != "" {
+				return nil, approver, fmt.Sprintf("Rejected by %s: %s", approver, approval.Spec.Reason)
+			}
+			return nil, approver, fmt.Sprintf("Rejected by %s", approver)
+		}
+		if approval.Spec.Decision == k8sudov1alpha1.SudoRequestApprovalDecisionApprove {
+			approvers = append(approvers, approver)
+		}
+	}
+	sort.Strings(approvers)
+	return approvers, "", ""
+}
+
+// updateStatusFromApprovalDecisions sets the status from the approvals
+// of approvers that are authorized to approve the request.
+func (r *SudoRequestReconciler) updateStatusFromApprovalDecisions(sudoReq *k8sudov1alpha1.SudoRequest, scheduleRequester string, approvals []k8sudov1alpha1.SudoRequestApproval, required int) {
+	approvers, rejecter, rejection := approvalDecisions(sudoReq, scheduleRequester, approvals)
+	if rejection != "" {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusRejected
+		sudoReq.Status.Reason = rejection
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionApproved, metav1.ConditionFalse, "Rejected", rejection)
+		r.addHistory(sudoReq, rejecter)
+		return
+	}
+	sudoReq.Status.Approvers = approvers
+
+	if len(approvers) >= required {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusPending
+		sudoReq.Status.Reason = ""
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionApproved, metav1.ConditionTrue, "Approved",
+			fmt.Sprintf("Approved by %s", strings.Join(approvers, ", ")))
+		r.addHistory(sudoReq, strings.Join(approvers, ","))
+		return
+	}
+	sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusAwaitingApproval
+	sudoReq.Status.Reason = fmt.Sprintf("Approved by %d of %d required approvers", len(approvers), required)
+	r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionApproved, metav1.ConditionFalse, "AwaitingApproval", sudoReq.Status.Reason)
+}
+
+// updateStatusFromSchedule holds a request that is ready to be granted
+// until the time it is scheduled to start.
+func (r *SudoRequestReconciler) updateStatusFromSchedule(sudoReq *k8sudov1alpha1.SudoRequest) {
+	if sudoReq.Status.Status != k8sudov1alpha1.SudoRequestStatusPending || sudoReq.Spec.NotBefore == nil {
+		return
+	}
+	if r.Now().Before(sudoReq.Spec.NotBefore.Time) {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusScheduled
+		sudoReq.Status.Reason = fmt.Sprintf("Scheduled to start at %s", sudoReq.Spec.NotBefore.UTC().Format(time.RFC3339))
+	}
+}
+
+func namespaceStatusFromAccessReview(namespace string, sar *authv1.SubjectAccessReview) k8sudov1alpha1.SudoRequestNamespaceStatus {
+	if !sar.Status.Allowed || sar.Status.Denied {
+		return k8sudov1alpha1.SudoRequestNamespaceStatus{
+			Namespace: namespace,
+			Status:    k8sudov1alpha1.SudoRequestNamespaceStatusDenied,
+			Reason:    fmt.Sprintf("Failed to authorize: %s", sar.Status.Reason),
+		}
+	}
+	return k8sudov1alpha1.SudoRequestNamespaceStatus{
+		Namespace: namespace,
+		Status:    k8sudov1alpha1.SudoRequestNamespaceStatusGranted,
+	}
 }
 
 func (r *SudoRequestReconciler) findChildCRB(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (*rbacv1.ClusterRoleBinding, error) {
 	childCRB := &rbacv1.ClusterRoleBinding{}
-	if err := r.Get(ctx, types.NamespacedName{Name: crbName(sudoReq)}, childCRB); err != nil {
+	if err := r.Get(ctx, types.NamespacedName{Name: bindingName(sudoReq, "")}, childCRB); err != nil {
 		if apierrors.IsNotFound(err) {
 			return nil, nil
 		}
@@ -150,17 +550,183 @@ func (r *SudoRequestReconciler) findChildCRB(ctx context.Context, sudoReq *k8sud
 	return childCRB, nil
 }
 
+func (r *SudoRequestReconciler) findChildRB(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, namespace string, log logr.Logger) (*rbacv1.RoleBinding, error) {
+	childRB := &rbacv1.RoleBinding{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: bindingName(sudoReq, namespace)}, childRB); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		log.Error(err, "unable to get child RoleBinding")
+		return nil, err
+	}
+	return childRB, nil
+}
+
+// findChildRBs returns the child RoleBindings in the namespaces that access
+// was granted in, keyed by namespace.
+func (r *SudoRequestReconciler) findChildRBs(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (map[string]*rbacv1.RoleBinding, error) {
+	childRBs := map[string]*rbacv1.RoleBinding{}
+	for _, nsStatus := range sudoReq.Status.Namespaces {
+		if nsStatus.Status != k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			continue
+		}
+		childRB, err := r.findChildRB(ctx, sudoReq, nsStatus.Namespace, log)
+		if err != nil {
+			return nil, err
+		}
+		if childRB != nil {
+			childRBs[nsStatus.Namespace] = childRB
+		}
+	}
+	return childRBs, nil
+}
+
 func (r *SudoRequestReconciler) checkAccess(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (*authv1.SubjectAccessReview, error) {
+	return r.checkAccessInNamespace(ctx, sudoReq, grantedNamespace(sudoReq), log)
+}
+
+// checkNamespacesAccess checks whether the user is authorized to assume
+// the role in each of the requested namespaces.
+func (r *SudoRequestReconciler) checkNamespacesAccess(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) ([]k8sudov1alpha1.SudoRequestNamespaceStatus, error) {
+	namespaces := requestedNamespaces(sudoReq)
+	if sudoReq.Spec.NamespaceSelector != nil {
+		var err error
+		namespaces, err = r.selectedNamespaces(ctx, sudoReq, log)
+		if err != nil {
+			return nil, err
+		}
+	}
+	statuses := make([]k8sudov1alpha1.SudoRequestNamespaceStatus, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		var ns corev1.Namespace
+		if err := r.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Error(err, "unable to get Namespace", "namespace", namespace)
+				return nil, err
+			}
+			statuses = append(statuses, k8sudov1alpha1.SudoRequestNamespaceStatus{
+				Namespace: namespace,
+				Status:    k8sudov1alpha1.SudoRequestNamespaceStatusDenied,
+				Reason:    "Namespace not found",
+			})
+			continue
+		}
+		sar, err := r.checkAccessInNamespace(ctx, sudoReq, namespace, log)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, namespaceStatusFromAccessReview(namespace, sar))
+	}
+	return statuses, nil
+}
+
+// selectedNamespaces returns the sorted list of namespaces that match
+// the request's namespace selector.
+func (r *SudoRequestReconciler) selectedNamespaces(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(sudoReq.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	var nsList corev1.NamespaceList
+	if err := r.List(ctx, &nsList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.Error(err, "unable to list Namespaces")
+		return nil, err
+	}
+	namespaces := make([]string, 0, len(nsList.Items))
+	for _, ns := range nsList.Items {
+		if ns.DeletionTimestamp != nil {
+			continue
+		}
+		namespaces = append(namespaces, ns.Name)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// syncSelectedNamespaces grants access in namespaces that have started
+// matching the namespace selector since the request was granted, and
+// revokes it in those that no longer match. It returns whether the
+// namespaces in the status changed.
+func (r *SudoRequestReconciler) syncSelectedNamespaces(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (bool, error) {
+	selected, err := r.selectedNamespaces(ctx, sudoReq, log)
+	if err != nil {
+		return false, err
+	}
+	isSelected := map[string]bool{}
+	for _, namespace := range selected {
+		isSelected[namespace] = true
+	}
+
+	changed := false
+	known := map[string]bool{}
+	statuses := make([]k8sudov1alpha1.SudoRequestNamespaceStatus, 0, len(selected))
+	for _, nsStatus := range sudoReq.Status.Namespaces {
+		known[nsStatus.Namespace] = true
+		if isSelected[nsStatus.Namespace] {
+			statuses = append(statuses, nsStatus)
+			continue
+		}
+		changed = true
+		if nsStatus.Status != k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			continue
+		}
+		log.Info("Revoking access in Namespace that no longer matches", "namespace", nsStatus.Namespace)
+		rb := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      bindingName(sudoReq, nsStatus.Namespace),
+				Namespace: nsStatus.Namespace,
+			},
+		}
+		if err := r.Delete(ctx, rb); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "failed to delete RoleBinding", "namespace", nsStatus.Namespace)
+			return false, err
+		}
+	}
+
+	for _, namespace := range selected {
+		if known[namespace] {
+			continue
+		}
+		changed = true
+		sar, err := r.checkAccessInNamespace(ctx, sudoReq, namespace, log)
+		if err != nil {
+			return false, err
+		}
+		nsStatus := namespaceStatusFromAccessReview(namespace, sar)
+		if nsStatus.Status == k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			log.Info("Granting access in newly matching Namespace", "namespace", namespace)
+			rb, err := r.createRoleBinding(sudoReq, namespace, log)
+			if err != nil {
+				return false, err
+			}
+			if err := r.Create(ctx, rb); IgnoreAlreadyExists(err) != nil {
+				log.Error(err, "unable to create RoleBinding", "namespace", namespace)
+				return false, err
+			}
+			nsStatus.RoleBinding = rb.GetName()
+		}
+		statuses = append(statuses, nsStatus)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Namespace < statuses[j].Namespace
+	})
+	sudoReq.Status.Namespaces = statuses
+	return changed, nil
+}
+
+func (r *SudoRequestReconciler) checkAccessInNamespace(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, namespace string, log logr.Logger) (*authv1.SubjectAccessReview, error) {
 	sar := &authv1.SubjectAccessReview{
 		Spec: authv1.SubjectAccessReviewSpec{
-			User: sudoReq.Spec.User,
+			User:   subjectUser(sudoReq),
+			Groups: subjectGroups(sudoReq),
 			ResourceAttributes: &authv1.ResourceAttributes{
-				Namespace: "",
+				Namespace: namespace,
 				Verb:      "sudo",
 				Group:     "rbac.authorization.k8s.io",
 				Version:   "v1",
-				Resource:  "clusterroles",
-				Name:      sudoReq.Spec.Role,
+				Resource:  roleResource(sudoReq),
+				Name:      roleName(sudoReq),
 			},
 		},
 	}
@@ -172,50 +738,442 @@ func (r *SudoRequestReconciler) checkAccess(ctx context.Context, sudoReq *k8sudo
 	return sar, nil
 }
 
-func (r *SudoRequestReconciler) updateStatus(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) error {
+// findApprovals returns the approvals for the request, or for one of its
+// extensions, whose approver is authorized to approve it, oldest first.
+func (r *SudoRequestReconciler) findApprovals(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, scheduleRequester string, extension *int32, log logr.Logger) ([]k8sudov1alpha1.SudoRequestApproval, error) {
+	var approvalList k8sudov1alpha1.SudoRequestApprovalList
+	if err := r.List(ctx, &approvalList, client.MatchingFields{approvalKey: sudoReq.Name}); err != nil {
+		log.Error(err, "unable to list SudoRequestApprovals")
+		return nil, err
+	}
+	sort.SliceStable(approvalList.Items, func(i, j int) bool {
+		return approvalList.Items[i].CreationTimestamp.Before(&approvalList.Items[j].CreationTimestamp)
+	})
+	approvals := []k8sudov1alpha1.SudoRequestApproval{}
+	for _, approval := range approvalList.Items {
+		if approval.Spec.SudoRequest != sudoReq.Name || approval.Spec.SudoRequestUID != sudoReq.UID ||
+			isOwnApproval(sudoReq, scheduleRequester, approval.Spec) {
+			continue
+		}
+		if (approval.Spec.Extension == nil) != (extension == nil) ||
+			extension != nil && *approval.Spec.Extension != *extension {
+			continue
+		}
+		sar, err := r.checkApproverAccess(ctx, sudoReq, &approval, log)
+		if err != nil {
+			return nil, err
+		}
+		if !sar.Status.Allowed || sar.Status.Denied {
+			log.Info("Ignoring approval by unauthorized approver", "approval", approval.Name, "approver", approval.Spec.Approver)
+			continue
+		}
+		approvals = append(approvals, approval)
+	}
+	return approvals, nil
+}
+
+// checkApproverAccess checks whether the approver is authorized to
+// approve the request.
+func (r *SudoRequestReconciler) checkApproverAccess(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, approval *k8sudov1alpha1.SudoRequestApproval, log logr.Logger) (*authv1.SubjectAccessReview, error) {
+	sar := &authv1.SubjectAccessReview{
+		Spec: authv1.SubjectAccessReviewSpec{
+			User:   approval.Spec.Approver,
+			Groups: approval.Spec.Groups,
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Verb:     "approve",
+				Group:    k8sudov1alpha1.GroupVersion.Group,
+				Version:  k8sudov1alpha1.GroupVersion.Version,
+				Resource: k8sudov1alpha1.SudoRequestResourcePath,
+				Name:     sudoReq.Name,
+			},
+		},
+	}
+	err := r.Create(ctx, sar)
+	if err != nil {
+		log.Error(err, "unable to create SubjectAccessReview", "approver", approval.Spec.Approver)
+		return sar, nil
+	}
+	return sar, nil
+}
 
-	childCRB, err := r.findChildCRB(ctx, sudoReq, log)
+// updateStatusFromApprovals holds a request that the requester is
+// authorized for until it has the approvals the policy requires.
+func (r *SudoRequestReconciler) updateStatusFromApprovals(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) error {
+	required := r.Policy.ForRole(sudoReq.Spec.Role).RequiredApprovals
+	if required == 0 {
+		sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusPending
+		sudoReq.Status.Reason = ""
+		r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionApproved, metav1.ConditionTrue, "NotRequired",
+			fmt.Sprintf("Approval is not required for %s", sudoReq.Spec.Role))
+		return nil
+	}
+	requester, err := scheduleRequester(ctx, r, sudoReq)
 	if err != nil {
+		log.Error(err, "unable to get SudoSchedule")
 		return err
 	}
-	r.updateStatusFromChild(sudoReq, childCRB)
+	approvals, err := r.findApprovals(ctx, sudoReq, requester, nil, log)
+	if err != nil {
+		return err
+	}
+	r.updateStatusFromApprovalDecisions(sudoReq, requester, approvals, required)
+	return nil
+}
+
+// reauthorize checks that the user is still authorized to assume the
+// role everywhere that it was granted.
+func (r *SudoRequestReconciler) reauthorize(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (*authv1.SubjectAccessReview, error) {
+	if !isMultiNamespace(sudoReq) {
+		return r.checkAccess(ctx, sudoReq, log)
+	}
+	var sar *authv1.SubjectAccessReview
+	for _, nsStatus := range sudoReq.Status.Namespaces {
+		if nsStatus.Status != k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			continue
+		}
+		var err error
+		sar, err = r.checkAccessInNamespace(ctx, sudoReq, nsStatus.Namespace, log)
+		if err != nil {
+			return nil, err
+		}
+		if !sar.Status.Allowed || sar.Status.Denied {
+			return sar, nil
+		}
+	}
+	if sar == nil {
+		sar = &authv1.SubjectAccessReview{}
+	}
+	return sar, nil
+}
 
-	if sudoReq.Status.Status != "" {
+// extensionStatusFromApprovals sets the status of an extension from the
+// approvals of it, if the policy requires them.
+func (r *SudoRequestReconciler) extensionStatusFromApprovals(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, extension int32, extStatus *k8sudov1alpha1.SudoRequestExtensionStatus, log logr.Logger) error {
+	required := r.Policy.ForRole(sudoReq.Spec.Role).RequiredApprovals
+	if required == 0 {
+		extStatus.Status = k8sudov1alpha1.SudoRequestExtensionStatusGranted
+		extStatus.Reason = ""
 		return nil
 	}
+	requester, err := scheduleRequester(ctx, r, sudoReq)
+	if err != nil {
+		log.Error(err, "unable to get SudoSchedule")
+		return err
+	}
+	approvals, err := r.findApprovals(ctx, sudoReq, requester, &extension, log)
+	if err != nil {
+		return err
+	}
+	approvers, _, rejection := approvalDecisions(sudoReq, requester, approvals)
+	switch {
+	case rejection != "":
+		extStatus.Status = k8sudov1alpha1.SudoRequestExtensionStatusDenied
+		extStatus.Reason = rejection
+	case len(approvers) >= required:
+		extStatus.Status = k8sudov1alpha1.SudoRequestExtensionStatusGranted
+		extStatus.Reason = ""
+	default:
+		extStatus.Status = k8sudov1alpha1.SudoRequestExtensionStatusAwaitingApproval
+		extStatus.Reason = fmt.Sprintf("Approved by %d of %d required approvers", len(approvers), required)
+	}
+	return nil
+}
+
+// reviewExtension decides whether to grant an extension. The user must
+// still be authorized to assume the role, the total time granted must
+// stay within the policy, and it must be approved if the policy
+// requires approvals.
+func (r *SudoRequestReconciler) reviewExtension(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, extension int32, log logr.Logger) (k8sudov1alpha1.SudoRequestExtensionStatus, error) {
+	settings := r.Policy.ForRole(sudoReq.Spec.Role)
+	extStatus := k8sudov1alpha1.SudoRequestExtensionStatus{
+		Duration: sudoReq.Spec.Extensions[extension].Duration,
+	}
 
-	sar, err := r.checkAccess(ctx, sudoReq, log)
+	total := expiryTimeForRequest(sudoReq, settings).Sub(grantedAt(sudoReq)) + extStatus.Duration.Duration
+	if total > settings.MaxTotalDuration {
+		extStatus.Status = k8sudov1alpha1.SudoRequestExtensionStatusDenied
+		extStatus.Reason = fmt.Sprintf("Extension would grant %s in total, more than the maximum of %s", total, settings.MaxTotalDuration)
+		return extStatus, nil
+	}
+
+	sar, err := r.reauthorize(ctx, sudoReq, log)
 	if err != nil {
+		return extStatus, err
+	}
+	if !sar.Status.Allowed || sar.Status.Denied {
+		extStatus.Status = k8sudov1alpha1.SudoRequestExtensionStatusDenied
+		extStatus.Reason = fmt.Sprintf("Failed to authorize: %s", sar.Status.Reason)
+		return extStatus, nil
+	}
+
+	if err := r.extensionStatusFromApprovals(ctx, sudoReq, extension, &extStatus, log); err != nil {
+		return extStatus, err
+	}
+	return extStatus, nil
+}
+
+// updateExtensions reviews the extensions of a Ready request in order,
+// stopping at any that is awaiting approval, and updates when it
+// expires. The existing bindings are left as they are.
+func (r *SudoRequestReconciler) updateExtensions(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) error {
+	for i := range sudoReq.Spec.Extensions {
+		extension := int32(i)
+		if i < len(sudoReq.Status.Extensions) {
+			extStatus := &sudoReq.Status.Extensions[i]
+			if extStatus.Status != k8sudov1alpha1.SudoRequestExtensionStatusAwaitingApproval {
+				continue
+			}
+			if err := r.extensionStatusFromApprovals(ctx, sudoReq, extension, extStatus, log); err != nil {
+				return err
+			}
+		} else {
+			extStatus, err := r.reviewExtension(ctx, sudoReq, extension, log)
+			if err != nil {
+				return err
+			}
+			log.Info("Reviewed extension", "extension", i, "status", extStatus.Status)
+			sudoReq.Status.Extensions = append(sudoReq.Status.Extensions, extStatus)
+		}
+		if sudoReq.Status.Extensions[i].Status == k8sudov1alpha1.SudoRequestExtensionStatusAwaitingApproval {
+			break
+		}
+	}
+	sudoReq.Status.Expires = &metav1.Time{Time: expiryTimeForRequest(sudoReq, r.Policy.ForRole(sudoReq.Spec.Role))}
+	return nil
+}
+
+func (r *SudoRequestReconciler) updateStatus(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) error {
+
+	switch {
+	case isMultiNamespace(sudoReq):
+		childRBs, err := r.findChildRBs(ctx, sudoReq, log)
+		if err != nil {
+			return err
+		}
+		r.updateStatusFromChildRoleBindings(sudoReq, childRBs)
+	case isNamespaced(sudoReq):
+		childRB, err := r.findChildRB(ctx, sudoReq, grantedNamespace(sudoReq), log)
+		if err != nil {
+			return err
+		}
+		r.updateStatusFromChildRoleBinding(sudoReq, childRB)
+	default:
+		childCRB, err := r.findChildCRB(ctx, sudoReq, log)
+		if err != nil {
+			return err
+		}
+		r.updateStatusFromChild(sudoReq, childCRB)
+	}
+
+	switch sudoReq.Status.Status {
+	case "":
+	case k8sudov1alpha1.SudoRequestStatusAwaitingApproval:
+		if err := r.updateStatusFromApprovals(ctx, sudoReq, log); err != nil {
+			return err
+		}
+		r.updateStatusFromSchedule(sudoReq)
+		return nil
+	case k8sudov1alpha1.SudoRequestStatusScheduled:
+		if sudoReq.Spec.NotBefore != nil && r.Now().Before(sudoReq.Spec.NotBefore.Time) {
+			return nil
+		}
+		// Check that the user is still authorized now that the request
+		// is starting
+		sudoReq.Status.Status = ""
+	case k8sudov1alpha1.SudoRequestStatusReady:
+		return r.updateExtensions(ctx, sudoReq, log)
+	default:
+		return nil
+	}
+
+	if isMultiNamespace(sudoReq) {
+		namespaces, err := r.checkNamespacesAccess(ctx, sudoReq, log)
+		if err != nil {
+			return err
+		}
+		r.updateStatusFromNamespaces(sudoReq, namespaces)
+	} else {
+		sar, err := r.checkAccess(ctx, sudoReq, log)
+		if err != nil {
+			return err
+		}
+		r.updateStatusFromAccessReview(sudoReq, sar)
+	}
+
+	if sudoReq.Status.Status != k8sudov1alpha1.SudoRequestStatusPending {
+		return nil
+	}
+	if err := r.updateStatusFromApprovals(ctx, sudoReq, log); err != nil {
 		return err
 	}
-	r.updateStatusFromAccessReview(sudoReq, sar)
+	r.updateStatusFromSchedule(sudoReq)
+	return nil
+}
+
+// isNamespaced returns whether the request grants access within
+// a single namespace rather than cluster-wide.
+func isNamespaced(sudoReq *k8sudov1alpha1.SudoRequest) bool {
+	return grantedNamespace(sudoReq) != ""
+}
+
+// isMultiNamespace returns whether the request grants access within
+// a list of namespaces or the namespaces matching a selector.
+func isMultiNamespace(sudoReq *k8sudov1alpha1.SudoRequest) bool {
+	return len(sudoReq.Spec.Namespaces) > 0 || sudoReq.Spec.NamespaceSelector != nil
+}
+
+// requestedNamespaces returns the sorted, de-duplicated list of
+// namespaces that the request is for.
+func requestedNamespaces(sudoReq *k8sudov1alpha1.SudoRequest) []string {
+	seen := map[string]bool{}
+	namespaces := []string{}
+	for _, namespace := range sudoReq.Spec.Namespaces {
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// grantFor returns the role and subject that the spec asks for, which
+// is recorded in the status once the request is authorized
+func grantFor(sudoReq *k8sudov1alpha1.SudoRequest) *k8sudov1alpha1.SudoRequestGrant {
+	grant := &k8sudov1alpha1.SudoRequestGrant{
+		SubjectKind: rbacv1.UserKind,
+		Subject:     sudoReq.Spec.User,
+		RoleKind:    sudoReq.Spec.RoleKind,
+		Role:        sudoReq.Spec.Role,
+		Namespace:   sudoReq.Spec.Namespace,
+	}
+	if sudoReq.Spec.Group != "" {
+		grant.SubjectKind = rbacv1.GroupKind
+		grant.Subject = sudoReq.Spec.Group
+	}
+	if grant.RoleKind == "" {
+		grant.RoleKind = k8sudov1alpha1.RoleKindClusterRole
+	}
+	return grant
+}
+
+// grantOf returns the role and subject that the request was authorized
+// for. Requests authorized by an earlier version of the controller, or
+// not authorized yet, fall back to the spec.
+func grantOf(sudoReq *k8sudov1alpha1.SudoRequest) *k8sudov1alpha1.SudoRequestGrant {
+	if sudoReq.Status.Grant != nil {
+		return sudoReq.Status.Grant
+	}
+	return grantFor(sudoReq)
+}
+
+// roleName returns the name of the role that is granted.
+func roleName(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	return grantOf(sudoReq).Role
+}
+
+func roleKind(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	if sudoReq.Status.Grant != nil {
+		return sudoReq.Status.Grant.RoleKind
+	}
+	if sudoReq.Spec.RoleKind == "" {
+		return k8sudov1alpha1.RoleKindClusterRole
+	}
+	return sudoReq.Spec.RoleKind
+}
+
+// roleResource returns the resource that the sudo verb is checked against
+// for the requested role.
+func roleResource(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	if roleKind(sudoReq) == k8sudov1alpha1.RoleKindRole {
+		return "roles"
+	}
+	return "clusterroles"
+}
+
+// subjectKind returns the kind of subject that the role is granted to,
+// either a User or a Group.
+func subjectKind(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	return grantOf(sudoReq).SubjectKind
+}
+
+// subjectName returns the name of the user or group that the role is
+// granted to.
+func subjectName(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	return grantOf(sudoReq).Subject
+}
+
+// subjectUser returns the user that access is checked for, which is
+// only set when the role is granted to a user.
+func subjectUser(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	if subjectKind(sudoReq) == rbacv1.UserKind {
+		return subjectName(sudoReq)
+	}
+	return ""
+}
 
+// subjectGroups returns the groups that access is checked for, which is
+// only set when the role is granted to a group.
+func subjectGroups(sudoReq *k8sudov1alpha1.SudoRequest) []string {
+	if subjectKind(sudoReq) == rbacv1.GroupKind {
+		return []string{subjectName(sudoReq)}
+	}
 	return nil
 }
 
-func crbName(sudoReq *k8sudov1alpha1.SudoRequest) string {
-	return fmt.Sprintf("sudo-%s-%s-%s-%s", sudoReq.Spec.User, sudoReq.Spec.Role, sudoReq.Name, sudoReq.CreationTimestamp.Format("2006.01.02.15.04.05"))
+// grantedNamespace returns the namespace that the role is granted in,
+// if the request is for a single namespace.
+func grantedNamespace(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	return grantOf(sudoReq).Namespace
+}
+
+// bindingMeta returns the metadata of a binding created for the
+// request, labelled so that it can be found without the request, and
+// annotated with when it expires so that it can be removed without it
+func bindingMeta(sudoReq *k8sudov1alpha1.SudoRequest, name, namespace string) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			k8sudov1alpha1.ManagedByLabel:        k8sudov1alpha1.ManagedByValue,
+			k8sudov1alpha1.SudoRequestAnnotation: labelValue(sudoReq.Name),
+			k8sudov1alpha1.RoleAnnotation:        labelValue(roleName(sudoReq)),
+		},
+		Annotations: map[string]string{
+			k8sudov1alpha1.SudoRequestAnnotation: sudoReq.Name,
+			k8sudov1alpha1.RoleAnnotation:        roleName(sudoReq),
+		},
+	}
+	subjectKey := k8sudov1alpha1.UserAnnotation
+	if subjectKind(sudoReq) == rbacv1.GroupKind {
+		subjectKey = k8sudov1alpha1.GroupAnnotation
+	}
+	meta.Labels[subjectKey] = labelValue(subjectName(sudoReq))
+	meta.Annotations[subjectKey] = subjectName(sudoReq)
+	if sudoReq.Status.Expires != nil {
+		meta.Annotations[k8sudov1alpha1.ExpiresAnnotation] = sudoReq.Status.Expires.UTC().Format(time.RFC3339)
+	}
+	return meta
 }
 
 func (r *SudoRequestReconciler) createClusterRoleBinding(sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (*rbacv1.ClusterRoleBinding, error) {
-	name := crbName(sudoReq)
+	name := bindingName(sudoReq, "")
 	crb := &rbacv1.ClusterRoleBinding{
 		Subjects: []rbacv1.Subject{
 			{
-				Kind:      "User",
+				Kind:      subjectKind(sudoReq),
 				APIGroup:  "rbac.authorization.k8s.io",
-				Name:      sudoReq.Spec.User,
+				Name:      subjectName(sudoReq),
 				Namespace: "",
 			},
 		},
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
 			Kind:     "ClusterRole",
-			Name:     sudoReq.Spec.Role,
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			Name:     roleName(sudoReq),
 		},
+		ObjectMeta: bindingMeta(sudoReq, name, ""),
 	}
 	if err := ctrl.SetControllerReference(sudoReq, crb, r.Scheme); err != nil {
 		log.Error(err, "Error setting ownerReference")
@@ -224,25 +1182,397 @@ func (r *SudoRequestReconciler) createClusterRoleBinding(sudoReq *k8sudov1alpha1
 	return crb, nil
 }
 
+func (r *SudoRequestReconciler) createRoleBinding(sudoReq *k8sudov1alpha1.SudoRequest, namespace string, log logr.Logger) (*rbacv1.RoleBinding, error) {
+	name := bindingName(sudoReq, namespace)
+	rb := &rbacv1.RoleBinding{
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      subjectKind(sudoReq),
+				APIGroup:  "rbac.authorization.k8s.io",
+				Name:      subjectName(sudoReq),
+				Namespace: "",
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     roleKind(sudoReq),
+			Name:     roleName(sudoReq),
+		},
+		ObjectMeta: bindingMeta(sudoReq, name, namespace),
+	}
+	if err := ctrl.SetControllerReference(sudoReq, rb, r.Scheme); err != nil {
+		log.Error(err, "Error setting ownerReference")
+		return nil, err
+	}
+	return rb, nil
+}
+
+// ownerOf returns the name of the SudoRequest that controls the object,
+// if any
+func ownerOf(obj metav1.Object) string {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil || owner.APIVersion != apiGVStr || owner.Kind != sudoRequestKind {
+		return ""
+	}
+	return owner.Name
+}
+
+// binding is a ClusterRoleBinding or a RoleBinding
+type binding interface {
+	metav1.Object
+	runtime.Object
+}
+
+// bindingKind returns the kind of the binding, for messages
+func bindingKind(obj binding) string {
+	if _, ok := obj.(*rbacv1.RoleBinding); ok {
+		return "RoleBinding"
+	}
+	return "ClusterRoleBinding"
+}
+
+// bindingGrant returns the subjects and role of the binding
+func bindingGrant(obj binding) ([]rbacv1.Subject, rbacv1.RoleRef) {
+	switch b := obj.(type) {
+	case *rbacv1.ClusterRoleBinding:
+		return b.Subjects, b.RoleRef
+	case *rbacv1.RoleBinding:
+		return b.Subjects, b.RoleRef
+	}
+	return nil, rbacv1.RoleRef{}
+}
+
+// setBindingSubjects sets the subjects of the binding
+func setBindingSubjects(obj binding, subjects []rbacv1.Subject) {
+	switch b := obj.(type) {
+	case *rbacv1.ClusterRoleBinding:
+		b.Subjects = subjects
+	case *rbacv1.RoleBinding:
+		b.Subjects = subjects
+	}
+}
+
+// bindingDrift returns the parts of the binding that differ from the
+// one the controller creates for the request. Labels added by others
+// are ignored, as long as the controller's labels are unchanged.
+// Missing labels aren't counted, as bindings created by earlier versions
+// of the controller don't have them.
+func bindingDrift(expected, actual binding) []string {
+	var drift []string
+	expectedSubjects, expectedRoleRef := bindingGrant(expected)
+	actualSubjects, actualRoleRef := bindingGrant(actual)
+	if !reflect.DeepEqual(expectedSubjects, actualSubjects) {
+		drift = append(drift, "subjects")
+	}
+	if expectedRoleRef != actualRoleRef {
+		drift = append(drift, "roleRef")
+	}
+	for key, value := range expected.GetLabels() {
+		if actualValue, ok := actual.GetLabels()[key]; ok && actualValue != value {
+			drift = append(drift, "labels")
+			break
+		}
+	}
+	if ownerOf(actual) != ownerOf(expected) {
+		drift = append(drift, "ownerReferences")
+	}
+	return drift
+}
+
+// hasMetadata returns whether the object has the labels and annotations
+// of the expected object
+func hasMetadata(actual, expected metav1.Object) bool {
+	for key, value := range expected.GetLabels() {
+		if actual.GetLabels()[key] != value {
+			return false
+		}
+	}
+	for key, value := range expected.GetAnnotations() {
+		if actual.GetAnnotations()[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// setMetadata sets the labels and annotations of the expected object on
+// the actual one, keeping any others
+func setMetadata(actual, expected metav1.Object) {
+	labels := actual.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range expected.GetLabels() {
+		labels[key] = value
+	}
+	actual.SetLabels(labels)
+	annotations := actual.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for key, value := range expected.GetAnnotations() {
+		annotations[key] = value
+	}
+	actual.SetAnnotations(annotations)
+}
+
+// findOwnedCRB returns the ClusterRoleBinding controlled by the request
+// with the name the controller gives it, or if no binding is controlled
+// by the request, any binding with that name
+func (r *SudoRequestReconciler) findOwnedCRB(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (*rbacv1.ClusterRoleBinding, error) {
+	var crbs rbacv1.ClusterRoleBindingList
+	if err := r.List(ctx, &crbs, client.MatchingFields{crbOwnerKey: sudoReq.Name}); err != nil {
+		log.Error(err, "unable to list ClusterRoleBindings")
+		return nil, err
+	}
+	name := bindingName(sudoReq, "")
+	for i := range crbs.Items {
+		if crbs.Items[i].Name == name && ownerOf(&crbs.Items[i]) == sudoReq.Name {
+			return &crbs.Items[i], nil
+		}
+	}
+	// The owner reference may have been removed
+	return r.findChildCRB(ctx, sudoReq, log)
+}
+
+// repairClusterRoleBinding recreates the binding of a Ready request if
+// it has been deleted, and reverts any changes to it. It returns whether
+// the Tampered condition was set.
+func (r *SudoRequestReconciler) repairClusterRoleBinding(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (bool, error) {
+	expected, err := r.createClusterRoleBinding(sudoReq, log)
+	if err != nil {
+		return false, err
+	}
+	actual, err := r.findOwnedCRB(ctx, sudoReq, log)
+	if err != nil {
+		return false, err
+	}
+	if actual == nil {
+		return r.recreateBinding(ctx, sudoReq, expected, "", log)
+	}
+	return r.revertBinding(ctx, sudoReq, expected, actual, log)
+}
+
+// repairRoleBindings recreates the RoleBindings of a Ready request in the
+// namespaces that access was granted in if they have been deleted, and
+// reverts any changes to them. It returns whether the Tampered condition
+// was set.
+func (r *SudoRequestReconciler) repairRoleBindings(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (bool, error) {
+	var namespaces []string
+	switch {
+	case isMultiNamespace(sudoReq):
+		for _, nsStatus := range sudoReq.Status.Namespaces {
+			if nsStatus.Status == k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+				namespaces = append(namespaces, nsStatus.Namespace)
+			}
+		}
+	case isNamespaced(sudoReq):
+		namespaces = []string{grantedNamespace(sudoReq)}
+	}
+	tampered := false
+	for _, namespace := range namespaces {
+		expected, err := r.createRoleBinding(sudoReq, namespace, log)
+		if err != nil {
+			return false, err
+		}
+		actual, err := r.findChildRB(ctx, sudoReq, namespace, log)
+		if err != nil {
+			return false, err
+		}
+		var repaired bool
+		if actual == nil {
+			repaired, err = r.recreateBinding(ctx, sudoReq, expected, namespace, log)
+		} else {
+			repaired, err = r.revertBinding(ctx, sudoReq, expected, actual, log)
+		}
+		if err != nil {
+			return false, err
+		}
+		tampered = tampered || repaired
+	}
+	return tampered, nil
+}
+
+// recreateBinding creates the expected binding, which has been deleted.
+// It returns whether the Tampered condition was set, which it isn't if
+// the binding exists and the cache hasn't caught up.
+func (r *SudoRequestReconciler) recreateBinding(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, expected binding, namespace string, log logr.Logger) (bool, error) {
+	if err := r.Create(ctx, expected); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		log.Error(err, "unable to recreate binding", "kind", bindingKind(expected), "namespace", namespace)
+		return false, err
+	}
+	message := fmt.Sprintf("%s %s was deleted and has been recreated", bindingKind(expected), expected.GetName())
+	if namespace != "" {
+		message = fmt.Sprintf("%s %s in %s was deleted and has been recreated", bindingKind(expected), expected.GetName(), namespace)
+	}
+	r.recordTampered(sudoReq, expected, "BindingDeleted", message)
+	r.auditGranted(sudoReq, namespace)
+	return true, nil
+}
+
+// revertBinding reverts any changes to the binding, and brings its
+// labels and annotations up to date, such as the expiry annotation when
+// the request is extended. It returns whether the Tampered condition
+// was set.
+func (r *SudoRequestReconciler) revertBinding(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, expected, actual binding, log logr.Logger) (bool, error) {
+	kind := bindingKind(expected)
+	drift := bindingDrift(expected, actual)
+	if len(drift) == 0 {
+		if !hasMetadata(actual, expected) {
+			setMetadata(actual, expected)
+			if err := r.Update(ctx, actual); err != nil {
+				log.Error(err, "unable to label binding", "kind", kind, "namespace", actual.GetNamespace())
+				return false, err
+			}
+		}
+		return false, nil
+	}
+	log.Info("Reverting changes to binding", "kind", kind, "namespace", actual.GetNamespace(), "changed", drift)
+	_, expectedRoleRef := bindingGrant(expected)
+	_, actualRoleRef := bindingGrant(actual)
+	if expectedRoleRef != actualRoleRef {
+		// The role of a binding can't be changed, so it is replaced
+		if err := r.Delete(ctx, actual); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to delete modified binding", "kind", kind, "namespace", actual.GetNamespace())
+			return false, err
+		}
+		if err := r.Create(ctx, expected); err != nil {
+			log.Error(err, "unable to recreate binding", "kind", kind, "namespace", actual.GetNamespace())
+			return false, err
+		}
+	} else {
+		subjects, _ := bindingGrant(expected)
+		setBindingSubjects(actual, subjects)
+		setMetadata(actual, expected)
+		actual.SetOwnerReferences(expected.GetOwnerReferences())
+		if err := r.Update(ctx, actual); err != nil {
+			log.Error(err, "unable to revert binding", "kind", kind, "namespace", actual.GetNamespace())
+			return false, err
+		}
+	}
+	message := fmt.Sprintf("%s %s was modified (%s) and has been reverted", kind, expected.GetName(), strings.Join(drift, ", "))
+	if actual.GetNamespace() != "" {
+		message = fmt.Sprintf("%s %s in %s was modified (%s) and has been reverted", kind, expected.GetName(), actual.GetNamespace(), strings.Join(drift, ", "))
+	}
+	r.recordTampered(sudoReq, expected, "BindingModified", message)
+	return true, nil
+}
+
+// recordTampered sets the Tampered condition and records an Event on
+// the request and on the binding when a binding is found to have been
+// deleted or changed
+func (r *SudoRequestReconciler) recordTampered(sudoReq *k8sudov1alpha1.SudoRequest, binding runtime.Object, reason, message string) {
+	r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionTampered, metav1.ConditionTrue, reason, message)
+	r.Recorder.Event(sudoReq, corev1.EventTypeWarning, eventReasonTampered, message)
+	r.Recorder.Eventf(binding, corev1.EventTypeWarning, eventReasonTampered, "Changed outside of SudoRequest %s, restored", sudoReq.Name)
+}
+
+// clearTampered sets the Tampered condition to False once the bindings
+// are found to be intact. It returns whether the condition was changed,
+// which it is only if it was True so that the status isn't updated on
+// every reconcile.
+func (r *SudoRequestReconciler) clearTampered(sudoReq *k8sudov1alpha1.SudoRequest) bool {
+	for _, condition := range sudoReq.Status.Conditions {
+		if condition.Type == k8sudov1alpha1.SudoRequestConditionTampered && condition.Status == metav1.ConditionTrue {
+			r.setCondition(sudoReq, k8sudov1alpha1.SudoRequestConditionTampered, metav1.ConditionFalse, "BindingsIntact",
+				"The bindings granting the role match the request")
+			return true
+		}
+	}
+	return false
+}
+
+// recordStatusChange records an Event when the status of the request
+// changes. Becoming Ready isn't recorded, as an Event is recorded for
+// each binding as it is created.
+func (r *SudoRequestReconciler) recordStatusChange(sudoReq *k8sudov1alpha1.SudoRequest, previous k8sudov1alpha1.SudoRequestStatusStatus) {
+	status := sudoReq.Status.Status
+	if status == previous || status == k8sudov1alpha1.SudoRequestStatusReady {
+		return
+	}
+	message := sudoReq.Status.Reason
+	switch status {
+	case k8sudov1alpha1.SudoRequestStatusPending:
+		message = fmt.Sprintf("Authorized to assume %s", sudoReq.Spec.Role)
+	case k8sudov1alpha1.SudoRequestStatusExpired:
+		message = fmt.Sprintf("Access to %s expired", sudoReq.Spec.Role)
+	}
+	if message == "" {
+		message = string(status)
+	}
+	eventType := corev1.EventTypeNormal
+	switch status {
+	case k8sudov1alpha1.SudoRequestStatusDenied,
+		k8sudov1alpha1.SudoRequestStatusError,
+		k8sudov1alpha1.SudoRequestStatusRejected:
+		eventType = corev1.EventTypeWarning
+	}
+	r.Recorder.Event(sudoReq, eventType, string(status), message)
+}
+
+// recordGranted records an Event on the request and on the binding that
+// grants it access
+func (r *SudoRequestReconciler) recordGranted(sudoReq *k8sudov1alpha1.SudoRequest, binding runtime.Object, namespace string) {
+	where := "cluster-wide"
+	if namespace != "" {
+		where = fmt.Sprintf("in %s", namespace)
+	}
+	r.Recorder.Eventf(sudoReq, corev1.EventTypeNormal, eventReasonGranted, "Granted %s %s %s to %s", roleKind(sudoReq), roleName(sudoReq), where, subjectName(sudoReq))
+	r.Recorder.Eventf(binding, corev1.EventTypeNormal, eventReasonGranted, "Created for SudoRequest %s", sudoReq.Name)
+}
+
+// recordDeleteFailed records an Event on the request and on the binding
+// when the binding can't be deleted, as access hasn't been removed
+func (r *SudoRequestReconciler) recordDeleteFailed(sudoReq *k8sudov1alpha1.SudoRequest, binding runtime.Object, err error) {
+	r.Recorder.Eventf(sudoReq, corev1.EventTypeWarning, eventReasonDeleteFailed, "Failed to delete binding: %s", err)
+	r.Recorder.Eventf(binding, corev1.EventTypeWarning, eventReasonDeleteFailed, "Failed to delete binding for SudoRequest %s: %s", sudoReq.Name, err)
+}
+
 func (r *SudoRequestReconciler) OnReady(sudoReq *k8sudov1alpha1.SudoRequest) (ctrl.Result, error) {
 	return ctrl.Result{RequeueAfter: sudoReq.Status.Expires.Sub(r.Now())}, nil
 }
 
+// OnAwaitingApproval requeues the request for when it expires, as it
+// will be reconciled when an approval is made
+func (r *SudoRequestReconciler) OnAwaitingApproval(sudoReq *k8sudov1alpha1.SudoRequest) (ctrl.Result, error) {
+	return ctrl.Result{RequeueAfter: sudoReq.Status.Expires.Sub(r.Now())}, nil
+}
+
+// OnScheduled requeues the request for when it is scheduled to start
+func (r *SudoRequestReconciler) OnScheduled(sudoReq *k8sudov1alpha1.SudoRequest) (ctrl.Result, error) {
+	return ctrl.Result{RequeueAfter: sudoReq.Spec.NotBefore.Sub(r.Now())}, nil
+}
+
 func (r *SudoRequestReconciler) OnPending(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (ctrl.Result, error) {
-	crb, err := r.createClusterRoleBinding(sudoReq, log)
+	if isMultiNamespace(sudoReq) {
+		return r.onPendingNamespaces(ctx, sudoReq, log)
+	}
+
+	var binding runtime.Object
+	var err error
+	if isNamespaced(sudoReq) {
+		binding, err = r.createRoleBinding(sudoReq, grantedNamespace(sudoReq), log)
+	} else {
+		binding, err = r.createClusterRoleBinding(sudoReq, log)
+	}
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if err = r.Create(ctx, crb); err != nil {
+	if err = r.Create(ctx, binding); err != nil {
 		if apierrors.IsAlreadyExists(err) {
 			// Cache is updating, so we haven't realised this is
 			// our child yet, requeue so that we see the child
 			return ctrl.Result{Requeue: true}, nil
 		}
-		log.Error(err, "unable to create ClusterRoleBinding")
+		log.Error(err, "unable to create binding")
 		return ctrl.Result{}, err
 	}
+	r.recordGranted(sudoReq, binding, grantedNamespace(sudoReq))
+	r.auditGranted(sudoReq, grantedNamespace(sudoReq))
 
 	// Requeue to update the Status to include the reference to the created CRB
 	// We wait one second to increase the chance that the CRB will be visible
@@ -250,20 +1580,185 @@ func (r *SudoRequestReconciler) OnPending(ctx context.Context, sudoReq *k8sudov1
 	return ctrl.Result{RequeueAfter: time.Second}, nil
 }
 
+// onPendingNamespaces creates a RoleBinding in each of the namespaces that
+// access was granted in.
+func (r *SudoRequestReconciler) onPendingNamespaces(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (ctrl.Result, error) {
+	for _, nsStatus := range sudoReq.Status.Namespaces {
+		if nsStatus.Status != k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			continue
+		}
+		rb, err := r.createRoleBinding(sudoReq, nsStatus.Namespace, log)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		// The RoleBinding may have been created on a previous attempt
+		err = r.Create(ctx, rb)
+		if IgnoreAlreadyExists(err) != nil {
+			log.Error(err, "unable to create RoleBinding", "namespace", nsStatus.Namespace)
+			return ctrl.Result{}, err
+		}
+		if err == nil {
+			r.recordGranted(sudoReq, rb, nsStatus.Namespace)
+			r.auditGranted(sudoReq, nsStatus.Namespace)
+		}
+	}
+
+	// Requeue to update the Status to include the references to the created RoleBindings
+	return ctrl.Result{RequeueAfter: time.Second}, nil
+}
+
 func (r *SudoRequestReconciler) OnExpired(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (ctrl.Result, error) {
+	deleted := false
 	if sudoReq.Status.ClusterRoleBinding != "" {
 		var crb rbacv1.ClusterRoleBinding
-		if err := r.Get(ctx, types.NamespacedName{Name: sudoReq.Status.ClusterRoleBinding}, &crb); err != nil {
-			return ctrl.Result{}, client.IgnoreNotFound(err)
+		err := r.Get(ctx, types.NamespacedName{Name: sudoReq.Status.ClusterRoleBinding}, &crb)
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		if err == nil {
+			if err := r.Delete(ctx, &crb); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "failed to delete ClusterRoleBinding")
+				r.recordDeleteFailed(sudoReq, &crb, err)
+				return ctrl.Result{}, err
+			}
+			deleted = true
+		}
+	}
+	if sudoReq.Status.RoleBinding != "" {
+		var rb rbacv1.RoleBinding
+		err := r.Get(ctx, types.NamespacedName{Namespace: grantedNamespace(sudoReq), Name: sudoReq.Status.RoleBinding}, &rb)
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		if err == nil {
+			if err := r.Delete(ctx, &rb); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "failed to delete RoleBinding")
+				r.recordDeleteFailed(sudoReq, &rb, err)
+				return ctrl.Result{}, err
+			}
+			deleted = true
+		}
+	}
+	for _, nsStatus := range sudoReq.Status.Namespaces {
+		if nsStatus.Status != k8sudov1alpha1.SudoRequestNamespaceStatusGranted {
+			continue
 		}
-		if err := r.Delete(ctx, &crb); err != nil {
-			log.Error(err, "failed to delete ClusterRoleBinding")
-			return ctrl.Result{}, client.IgnoreNotFound(err)
+		rb := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      bindingName(sudoReq, nsStatus.Namespace),
+				Namespace: nsStatus.Namespace,
+			},
+		}
+		err := r.Delete(ctx, rb)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "failed to delete RoleBinding", "namespace", nsStatus.Namespace)
+			r.recordDeleteFailed(sudoReq, rb, err)
+			return ctrl.Result{}, err
 		}
+		if err == nil {
+			deleted = true
+		}
+	}
+	if deleted {
+		observeRevocation(sudoReq, r.Now())
+		r.auditRemoved(sudoReq)
+	}
+	return ctrl.Result{}, r.releaseFinalizer(ctx, sudoReq, log)
+}
+
+// releaseFinalizer removes the finalizer from a request that no longer
+// grants access, so that it can be deleted without the controller
+// running. Any binding created for it that the status doesn't record is
+// deleted first.
+func (r *SudoRequestReconciler) releaseFinalizer(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) error {
+	if !controllerutil.ContainsFinalizer(sudoReq, sudoRequestFinalizer) {
+		return nil
+	}
+	removed, err := r.deleteBindings(ctx, sudoReq, log)
+	if err != nil {
+		return err
+	}
+	if removed {
+		log.Info("Deleted binding that wasn't recorded in the status")
+	}
+	controllerutil.RemoveFinalizer(sudoReq, sudoRequestFinalizer)
+	if err := r.Update(ctx, sudoReq); err != nil {
+		log.Error(err, "unable to remove finalizer")
+		return client.IgnoreNotFound(err)
+	}
+	return nil
+}
+
+// OnDeleted removes any access still granted by a request that is being
+// deleted and then removes the finalizer, so that the request is only
+// deleted once access has been revoked
+func (r *SudoRequestReconciler) OnDeleted(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(sudoReq, sudoRequestFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	removed, err := r.deleteBindings(ctx, sudoReq, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	r.auditDeleted(sudoReq, removed)
+	controllerutil.RemoveFinalizer(sudoReq, sudoRequestFinalizer)
+	if err := r.Update(ctx, sudoReq); err != nil {
+		log.Error(err, "unable to remove finalizer")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 	return ctrl.Result{}, nil
 }
 
+// addFinalizer adds the finalizer to the request if it doesn't have it
+func (r *SudoRequestReconciler) addFinalizer(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) error {
+	if controllerutil.ContainsFinalizer(sudoReq, sudoRequestFinalizer) {
+		return nil
+	}
+	controllerutil.AddFinalizer(sudoReq, sudoRequestFinalizer)
+	if err := r.Update(ctx, sudoReq); err != nil {
+		log.Error(err, "unable to add finalizer")
+		return err
+	}
+	return nil
+}
+
+// deleteBindings deletes every binding that may have been created for
+// the request, and returns whether any were deleted. The bindings are
+// found by name rather than only from the status, as the request may be
+// deleted before the status records a binding that was just created.
+func (r *SudoRequestReconciler) deleteBindings(ctx context.Context, sudoReq *k8sudov1alpha1.SudoRequest, log logr.Logger) (bool, error) {
+	var bindings []runtime.Object
+	switch {
+	case isMultiNamespace(sudoReq):
+		for _, nsStatus := range sudoReq.Status.Namespaces {
+			bindings = append(bindings, &rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: bindingName(sudoReq, nsStatus.Namespace), Namespace: nsStatus.Namespace},
+			})
+		}
+	case isNamespaced(sudoReq):
+		bindings = append(bindings, &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: bindingName(sudoReq, grantedNamespace(sudoReq)), Namespace: grantedNamespace(sudoReq)},
+		})
+	default:
+		bindings = append(bindings, &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: bindingName(sudoReq, "")},
+		})
+	}
+	deleted := false
+	for _, binding := range bindings {
+		err := r.Delete(ctx, binding)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "failed to delete binding")
+			r.recordDeleteFailed(sudoReq, binding, err)
+			return deleted, err
+		}
+		if err == nil {
+			deleted = true
+		}
+	}
+	return deleted, nil
+}
+
 func (r *SudoRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("sudorequest", req.NamespacedName)
@@ -277,38 +1772,222 @@ func (r *SudoRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	if !sudoReq.DeletionTimestamp.IsZero() {
+		return r.OnDeleted(ctx, &sudoReq, log)
+	}
+
+	previous := sudoReq.Status.Status
+	previousAudit := auditStateOf(&sudoReq)
 	err := r.updateStatus(ctx, &sudoReq, log)
 	if err != nil {
 		log.Error(err, "unable to validate request")
 		return ctrl.Result{}, err
 	}
+	// The bindings are created from the role and subject that were
+	// authorized, so that later changes to the spec can't change them
+	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusPending && sudoReq.Status.Grant == nil {
+		sudoReq.Status.Grant = grantFor(&sudoReq)
+	}
+	sudoReq.Status.ObservedGeneration = sudoReq.Generation
+	if sudoReq.Status.Status != previous {
+		r.addHistory(&sudoReq, historyActorController)
+	}
 
 	if err := r.Status().Update(ctx, &sudoReq); err != nil {
 		log.Error(err, "unable to update SudoRequest status")
 		return ctrl.Result{}, err
 	}
+	r.recordStatusChange(&sudoReq, previous)
+	observeStatusChange(&sudoReq, previous)
+	r.auditChanges(&sudoReq, previousAudit)
 
 	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusPending {
+		// The finalizer is added before any binding is created
+		if err := r.addFinalizer(ctx, &sudoReq, log); err != nil {
+			return ctrl.Result{}, err
+		}
 		return r.OnPending(ctx, &sudoReq, log)
 	}
 
 	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusReady {
+		// Requests granted by an earlier version of the controller
+		// don't have the finalizer
+		if err := r.addFinalizer(ctx, &sudoReq, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		changed := false
+		if sudoReq.Spec.NamespaceSelector != nil {
+			changed, err = r.syncSelectedNamespaces(ctx, &sudoReq, log)
+		}
+		if err == nil {
+			var tampered bool
+			if isNamespaced(&sudoReq) || isMultiNamespace(&sudoReq) {
+				tampered, err = r.repairRoleBindings(ctx, &sudoReq, log)
+			} else {
+				tampered, err = r.repairClusterRoleBinding(ctx, &sudoReq, log)
+			}
+			changed = changed || tampered
+			if err == nil && !tampered && r.clearTampered(&sudoReq) {
+				changed = true
+			}
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if changed {
+			if err := r.Status().Update(ctx, &sudoReq); err != nil {
+				log.Error(err, "unable to update SudoRequest status")
+				return ctrl.Result{}, err
+			}
+		}
 		return r.OnReady(&sudoReq)
 	}
 
-	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusExpired {
+	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusAwaitingApproval {
+		return r.OnAwaitingApproval(&sudoReq)
+	}
+
+	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusScheduled {
+		return r.OnScheduled(&sudoReq)
+	}
+
+	// Access is removed from a revoked request in the same way as an
+	// expired one
+	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusExpired ||
+		sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusRevoked {
 		return r.OnExpired(ctx, &sudoReq, log)
 	}
 
+	// Requests that were never granted don't need the finalizer
+	if sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusDenied ||
+		sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusRejected ||
+		sudoReq.Status.Status == k8sudov1alpha1.SudoRequestStatusError {
+		return ctrl.Result{}, r.releaseFinalizer(ctx, &sudoReq, log)
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// sudoRequestsForNamespace maps a change to a Namespace to the Ready
+// SudoRequests with a namespace selector, so that they can grant or
+// revoke access in it. Every such request is returned as a Namespace
+// that stops matching a selector must still revoke access.
+func (r *SudoRequestReconciler) sudoRequestsForNamespace(obj handler.MapObject) []reconcile.Request {
+	var sudoReqs k8sudov1alpha1.SudoRequestList
+	if err := r.List(context.Background(), &sudoReqs); err != nil {
+		r.Log.Error(err, "unable to list SudoRequests", "namespace", obj.Meta.GetName())
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, sudoReq := range sudoReqs.Items {
+		if sudoReq.Spec.NamespaceSelector == nil ||
+			sudoReq.Status.Status != k8sudov1alpha1.SudoRequestStatusReady {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: sudoReq.Name},
+		})
+	}
+	return requests
+}
+
+// sudoRequestForApproval maps a SudoRequestApproval to the SudoRequest
+// that it is for
+func sudoRequestForApproval(obj handler.MapObject) []reconcile.Request {
+	approval, ok := obj.Object.(*k8sudov1alpha1.SudoRequestApproval)
+	if !ok || approval.Spec.SudoRequest == "" {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: approval.Spec.SudoRequest}},
+	}
+}
+
+// onlyActionsChanged returns whether an update to a SudoRequest only
+// recorded API requests in status.actions. The API audit webhook makes
+// these updates for each batch of events it receives, and they don't
+// need the request to be reconciled.
+func onlyActionsChanged(oldObj, newObj runtime.Object) bool {
+	oldReq, ok := oldObj.(*k8sudov1alpha1.SudoRequest)
+	if !ok {
+		return false
+	}
+	newReq, ok := newObj.(*k8sudov1alpha1.SudoRequest)
+	if !ok {
+		return false
+	}
+	if reflect.DeepEqual(oldReq.Status.Actions, newReq.Status.Actions) {
+		return false
+	}
+	oldReq, newReq = oldReq.DeepCopy(), newReq.DeepCopy()
+	for _, sudoReq := range []*k8sudov1alpha1.SudoRequest{oldReq, newReq} {
+		sudoReq.ResourceVersion = ""
+		sudoReq.ManagedFields = nil
+		sudoReq.Status.Actions = nil
+	}
+	return reflect.DeepEqual(oldReq, newReq)
+}
+
+// sudoRequestForBinding maps a ClusterRoleBinding or RoleBinding to the
+// SudoRequest that it was created for, from its annotation or its owner,
+// so that a binding is repaired even if its owner reference is removed
+func sudoRequestForBinding(obj handler.MapObject) []reconcile.Request {
+	name := bindingRequest(obj.Meta)
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: name}},
+	}
+}
+
 func (r *SudoRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if r.Clock == nil {
 		r.Clock = realClock{}
 	}
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("sudorequest-controller")
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &k8sudov1alpha1.SudoRequestApproval{}, approvalKey, func(rawObj runtime.Object) []string {
+		approval := rawObj.(*k8sudov1alpha1.SudoRequestApproval)
+		return []string{approval.Spec.SudoRequest}
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &rbacv1.ClusterRoleBinding{}, crbOwnerKey, func(rawObj runtime.Object) []string {
+		crb := rawObj.(*rbacv1.ClusterRoleBinding)
+		owner := ownerOf(crb)
+		if owner == "" {
+			return nil
+		}
+		return []string{owner}
+	}); err != nil {
+		return err
+	}
+
+	if err := metrics.Registry.Register(&activeEscalationsCollector{client: mgr.GetClient(), log: r.Log}); err != nil {
+		return err
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&k8sudov1alpha1.SudoRequest{}).
+		For(&k8sudov1alpha1.SudoRequest{}, builder.WithPredicates(predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return !onlyActionsChanged(e.ObjectOld, e.ObjectNew)
+			},
+		})).
+		Watches(&source.Kind{Type: &rbacv1.ClusterRoleBinding{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(sudoRequestForBinding),
+		}).
+		Watches(&source.Kind{Type: &rbacv1.RoleBinding{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(sudoRequestForBinding),
+		}).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.sudoRequestsForNamespace),
+		}).
+		Watches(&source.Kind{Type: &k8sudov1alpha1.SudoRequestApproval{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(sudoRequestForApproval),
+		}).
 		Complete(r)
 }
@@ -15,6 +15,7 @@ limitations under the License.
 package controllers
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"reflect"
@@ -23,15 +24,22 @@ import (
 
 	testinglogr "github.com/go-logr/logr/testing"
 	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clientpkg "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/audit"
+	"jetstack.io/k8sudo/pkg/policy"
 )
 
 func TestIgnoreAlreadyExists(t *testing.T) {
@@ -137,24 +145,131 @@ func TestExpiryTimeForRequest(t *testing.T) {
 	never := time.Time{}
 	inOneHour := now.Add(time.Hour)
 
+	defaults := policy.Settings{DefaultDuration: policy.DefaultDuration, MaxDuration: policy.DefaultMaxDuration}
+
 	tests := []struct {
 		name              string
 		creationTimestamp time.Time
+		grantedAt         time.Time
 		requested         time.Time
+		duration          time.Duration
+		notBefore         time.Time
+		extensions        []k8sudov1alpha1.SudoRequestExtensionStatus
+		settings          policy.Settings
 		expected          time.Time
 	}{
 		{
 			name:              "no requested",
 			creationTimestamp: now,
 			requested:         never,
-			expected:          now.Add(defaultDuration),
+			settings:          defaults,
+			expected:          now.Add(policy.DefaultDuration),
 		},
 		{
 			name:              "uses requested",
 			creationTimestamp: now,
 			requested:         inOneHour,
+			settings:          defaults,
+			expected:          inOneHour,
+		},
+		{
+			name:              "policy default",
+			creationTimestamp: now,
+			requested:         never,
+			settings:          policy.Settings{DefaultDuration: time.Minute, MaxDuration: time.Hour},
+			expected:          now.Add(time.Minute),
+		},
+		{
+			name:              "policy max",
+			creationTimestamp: now,
+			requested:         inOneHour,
+			settings:          policy.Settings{DefaultDuration: time.Minute, MaxDuration: 30 * time.Minute},
+			expected:          now.Add(30 * time.Minute),
+		},
+		{
+			name:              "from granted",
+			creationTimestamp: now,
+			grantedAt:         now.Add(20 * time.Minute),
+			requested:         never,
+			settings:          defaults,
+			expected:          now.Add(20 * time.Minute).Add(policy.DefaultDuration),
+		},
+		{
+			name:              "granted max",
+			creationTimestamp: now,
+			grantedAt:         now.Add(20 * time.Minute),
+			requested:         now.Add(2 * time.Hour),
+			settings:          defaults,
+			expected:          now.Add(20 * time.Minute).Add(policy.DefaultMaxDuration),
+		},
+		{
+			name:              "requested bounds granted",
+			creationTimestamp: now,
+			grantedAt:         now.Add(50 * time.Minute),
+			requested:         inOneHour,
+			settings:          defaults,
 			expected:          inOneHour,
 		},
+		{
+			name:              "uses duration",
+			creationTimestamp: now,
+			grantedAt:         now.Add(time.Minute),
+			duration:          30 * time.Minute,
+			settings:          defaults,
+			expected:          now.Add(31 * time.Minute),
+		},
+		{
+			name:              "duration max",
+			creationTimestamp: now,
+			duration:          2 * time.Hour,
+			settings:          defaults,
+			expected:          now.Add(policy.DefaultMaxDuration),
+		},
+		{
+			name:              "requested bounds duration",
+			creationTimestamp: now,
+			requested:         now.Add(20 * time.Minute),
+			duration:          30 * time.Minute,
+			settings:          defaults,
+			expected:          now.Add(20 * time.Minute),
+		},
+		{
+			name:              "scheduled",
+			creationTimestamp: now,
+			notBefore:         inOneHour,
+			requested:         never,
+			settings:          defaults,
+			expected:          inOneHour.Add(policy.DefaultDuration),
+		},
+		{
+			name:              "scheduled and granted",
+			creationTimestamp: now,
+			notBefore:         inOneHour,
+			grantedAt:         inOneHour.Add(time.Minute),
+			requested:         never,
+			settings:          defaults,
+			expected:          inOneHour.Add(time.Minute).Add(policy.DefaultDuration),
+		},
+		{
+			name:              "granted extensions",
+			creationTimestamp: now,
+			requested:         never,
+			settings:          defaults,
+			extensions: []k8sudov1alpha1.SudoRequestExtensionStatus{
+				{Duration: metav1.Duration{Duration: 5 * time.Minute}, Status: k8sudov1alpha1.SudoRequestExtensionStatusGranted},
+				{Duration: metav1.Duration{Duration: time.Hour}, Status: k8sudov1alpha1.SudoRequestExtensionStatusDenied},
+				{Duration: metav1.Duration{Duration: time.Minute}, Status: k8sudov1alpha1.SudoRequestExtensionStatusGranted},
+			},
+			expected: now.Add(policy.DefaultDuration).Add(6 * time.Minute),
+		},
+		{
+			name:              "duration sooner than requested",
+			creationTimestamp: now,
+			requested:         inOneHour,
+			duration:          30 * time.Minute,
+			settings:          defaults,
+			expected:          now.Add(30 * time.Minute),
+		},
 	}
 
 	for _, test := range tests {
@@ -168,7 +283,17 @@ func TestExpiryTimeForRequest(t *testing.T) {
 			if test.requested != (time.Time{}) {
 				req.Spec.Expires = &metav1.Time{Time: test.requested}
 			}
-			if got, want := expiryTimeForRequest(req), test.expected; got != want {
+			if test.grantedAt != (time.Time{}) {
+				req.Status.GrantedAt = &metav1.Time{Time: test.grantedAt}
+			}
+			if test.duration != 0 {
+				req.Spec.Duration = &metav1.Duration{Duration: test.duration}
+			}
+			if test.notBefore != (time.Time{}) {
+				req.Spec.NotBefore = &metav1.Time{Time: test.notBefore}
+			}
+			req.Status.Extensions = test.extensions
+			if got, want := expiryTimeForRequest(req, test.settings), test.expected; got != want {
 				t.Errorf("got wrong expiry time: (got != want) %s != %s", got, want)
 			}
 		})
@@ -187,7 +312,15 @@ func TestUpdateStatusFromChild(t *testing.T) {
 
 	childCRB := &rbacv1.ClusterRoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: crbName,
+			Name:              crbName,
+			CreationTimestamp: metav1.Time{Time: creationTimestamp},
+		},
+	}
+	grantedAt := creationTimestamp.Add(5 * time.Minute)
+	laterChildCRB := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              crbName,
+			CreationTimestamp: metav1.Time{Time: grantedAt},
 		},
 	}
 
@@ -196,6 +329,8 @@ func TestUpdateStatusFromChild(t *testing.T) {
 		childCRB        *rbacv1.ClusterRoleBinding
 		user            string
 		role            string
+		roleKind        string
+		revoked         *k8sudov1alpha1.SudoRequestRevocation
 		expectedStatus  k8sudov1alpha1.SudoRequestStatusStatus
 		expectedReason  string
 		expectedCRBName string
@@ -208,7 +343,7 @@ func TestUpdateStatusFromChild(t *testing.T) {
 			expectedStatus:  k8sudov1alpha1.SudoRequestStatusReady,
 			expectedReason:  "",
 			expectedCRBName: crbName,
-			expectedExpires: creationTimestamp.Add(defaultDuration),
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
 			currentTime:     creationTimestamp,
 		},
 		{
@@ -217,8 +352,39 @@ func TestUpdateStatusFromChild(t *testing.T) {
 			expectedStatus:  k8sudov1alpha1.SudoRequestStatusExpired,
 			expectedReason:  "",
 			expectedCRBName: crbName,
-			expectedExpires: creationTimestamp.Add(defaultDuration),
-			currentTime:     creationTimestamp.Add(defaultDuration).Add(time.Second),
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
+			currentTime:     creationTimestamp.Add(policy.DefaultDuration).Add(time.Second),
+		},
+		{
+			name:            "with child granted later",
+			childCRB:        laterChildCRB,
+			expectedStatus:  k8sudov1alpha1.SudoRequestStatusReady,
+			expectedReason:  "",
+			expectedCRBName: crbName,
+			expectedExpires: grantedAt.Add(policy.DefaultDuration),
+			currentTime:     creationTimestamp.Add(policy.DefaultDuration).Add(time.Second),
+		},
+		{
+			name:            "with child revoked",
+			childCRB:        childCRB,
+			revoked:         &k8sudov1alpha1.SudoRequestRevocation{User: "admin", Reason: "incident over"},
+			expectedStatus:  k8sudov1alpha1.SudoRequestStatusRevoked,
+			expectedReason:  "Revoked by admin: incident over",
+			expectedCRBName: crbName,
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
+			currentTime:     creationTimestamp,
+		},
+		{
+			name:            "without child revoked",
+			childCRB:        nil,
+			user:            "user",
+			role:            "role",
+			revoked:         &k8sudov1alpha1.SudoRequestRevocation{User: "user"},
+			expectedStatus:  k8sudov1alpha1.SudoRequestStatusRevoked,
+			expectedReason:  "Revoked by user",
+			expectedCRBName: "",
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
+			currentTime:     creationTimestamp.Add(policy.DefaultDuration).Add(time.Second),
 		},
 		{
 			name:            "without child expired",
@@ -226,8 +392,8 @@ func TestUpdateStatusFromChild(t *testing.T) {
 			expectedStatus:  k8sudov1alpha1.SudoRequestStatusExpired,
 			expectedReason:  "",
 			expectedCRBName: "",
-			expectedExpires: creationTimestamp.Add(defaultDuration),
-			currentTime:     creationTimestamp.Add(defaultDuration).Add(time.Second),
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
+			currentTime:     creationTimestamp.Add(policy.DefaultDuration).Add(time.Second),
 		},
 		{
 			name:     "without child valid",
@@ -240,7 +406,7 @@ func TestUpdateStatusFromChild(t *testing.T) {
 			expectedStatus:  "",
 			expectedReason:  "",
 			expectedCRBName: "",
-			expectedExpires: creationTimestamp.Add(defaultDuration),
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
 			currentTime:     creationTimestamp,
 		},
 		{
@@ -251,7 +417,7 @@ func TestUpdateStatusFromChild(t *testing.T) {
 			expectedStatus:  k8sudov1alpha1.SudoRequestStatusError,
 			expectedReason:  "User must be specified",
 			expectedCRBName: "",
-			expectedExpires: creationTimestamp.Add(defaultDuration),
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
 			currentTime:     creationTimestamp,
 		},
 		{
@@ -262,7 +428,31 @@ func TestUpdateStatusFromChild(t *testing.T) {
 			expectedStatus:  k8sudov1alpha1.SudoRequestStatusError,
 			expectedReason:  "Target role must be specified",
 			expectedCRBName: "",
-			expectedExpires: creationTimestamp.Add(defaultDuration),
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
+			currentTime:     creationTimestamp,
+		},
+		{
+			name:            "without child role missing namespace",
+			childCRB:        nil,
+			user:            "user",
+			role:            "role",
+			roleKind:        "Role",
+			expectedStatus:  k8sudov1alpha1.SudoRequestStatusError,
+			expectedReason:  "Namespace must be specified for a Role",
+			expectedCRBName: "",
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
+			currentTime:     creationTimestamp,
+		},
+		{
+			name:            "without child unknown role kind",
+			childCRB:        nil,
+			user:            "user",
+			role:            "role",
+			roleKind:        "Group",
+			expectedStatus:  k8sudov1alpha1.SudoRequestStatusError,
+			expectedReason:  "Unknown role kind Group",
+			expectedCRBName: "",
+			expectedExpires: creationTimestamp.Add(policy.DefaultDuration),
 			currentTime:     creationTimestamp,
 		},
 	}
@@ -274,8 +464,10 @@ func TestUpdateStatusFromChild(t *testing.T) {
 					CreationTimestamp: metav1.Time{Time: creationTimestamp},
 				},
 				Spec: k8sudov1alpha1.SudoRequestSpec{
-					User: test.user,
-					Role: test.role,
+					User:     test.user,
+					Role:     test.role,
+					RoleKind: test.roleKind,
+					Revoked:  test.revoked,
 				},
 			}
 			clock := FakeClock{
@@ -303,11 +495,12 @@ func TestUpdateStatusFromChild(t *testing.T) {
 
 func TestUpdateStatusFromAccessReview(t *testing.T) {
 	tests := []struct {
-		name            string
-		sar             *authv1.SubjectAccessReview
-		expectedStatus  k8sudov1alpha1.SudoRequestStatusStatus
-		expectedReason  string
-		expectedCRBName string
+		name               string
+		sar                *authv1.SubjectAccessReview
+		expectedStatus     k8sudov1alpha1.SudoRequestStatusStatus
+		expectedReason     string
+		expectedCRBName    string
+		expectedAuthorized metav1.ConditionStatus
 	}{
 		{
 			name: "not allowed",
@@ -318,9 +511,10 @@ func TestUpdateStatusFromAccessReview(t *testing.T) {
 					Reason:  "not allowed",
 				},
 			},
-			expectedStatus:  k8sudov1alpha1.SudoRequestStatusDenied,
-			expectedReason:  "Failed to authorize: not allowed",
-			expectedCRBName: "",
+			expectedStatus:     k8sudov1alpha1.SudoRequestStatusDenied,
+			expectedReason:     "Failed to authorize: not allowed",
+			expectedCRBName:    "",
+			expectedAuthorized: metav1.ConditionFalse,
 		},
 		{
 			name: "denied",
@@ -331,9 +525,10 @@ func TestUpdateStatusFromAccessReview(t *testing.T) {
 					Reason:  "denied",
 				},
 			},
-			expectedStatus:  k8sudov1alpha1.SudoRequestStatusDenied,
-			expectedReason:  "Failed to authorize: denied",
-			expectedCRBName: "",
+			expectedStatus:     k8sudov1alpha1.SudoRequestStatusDenied,
+			expectedReason:     "Failed to authorize: denied",
+			expectedCRBName:    "",
+			expectedAuthorized: metav1.ConditionFalse,
 		},
 		{
 			name: "allowed",
@@ -344,9 +539,10 @@ func TestUpdateStatusFromAccessReview(t *testing.T) {
 					Reason:  "allowed",
 				},
 			},
-			expectedStatus:  k8sudov1alpha1.SudoRequestStatusPending,
-			expectedReason:  "",
-			expectedCRBName: "",
+			expectedStatus:     k8sudov1alpha1.SudoRequestStatusPending,
+			expectedReason:     "",
+			expectedCRBName:    "",
+			expectedAuthorized: metav1.ConditionTrue,
 		},
 	}
 
@@ -371,15 +567,242 @@ func TestUpdateStatusFromAccessReview(t *testing.T) {
 			if got, want := req.Status.Expires, noTime; got != want {
 				t.Errorf("wrong expires: (got != want) %v != %v", got, want)
 			}
+			if got, want := conditionStatus(req, k8sudov1alpha1.SudoRequestConditionAuthorized), test.expectedAuthorized; got != want {
+				t.Errorf("wrong Authorized condition: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+// conditionStatus returns the status of the condition of the given type,
+// or an empty status if it isn't set
+func conditionStatus(req *k8sudov1alpha1.SudoRequest, conditionType k8sudov1alpha1.SudoRequestConditionType) metav1.ConditionStatus {
+	for _, condition := range req.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status
+		}
+	}
+	return ""
+}
+
+func TestSetCondition(t *testing.T) {
+	start := time.Now()
+	req := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Generation: 1},
+	}
+	r := &SudoRequestReconciler{
+		Clock: FakeClock{CurrentTime: start},
+	}
+	r.setCondition(req, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionTrue, "Authorized", "first")
+
+	// The transition time is kept when only the message changes
+	req.Generation = 2
+	r.Clock = FakeClock{CurrentTime: start.Add(time.Minute)}
+	r.setCondition(req, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionTrue, "Authorized", "second")
+	expected := []k8sudov1alpha1.SudoRequestCondition{
+		{
+			Type:               k8sudov1alpha1.SudoRequestConditionAuthorized,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: 2,
+			LastTransitionTime: metav1.Time{Time: start},
+			Reason:             "Authorized",
+			Message:            "second",
+		},
+	}
+	if got, want := req.Status.Conditions, expected; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong conditions: (got != want) %+v != %+v", got, want)
+	}
+
+	// and changed when the status changes
+	r.Clock = FakeClock{CurrentTime: start.Add(2 * time.Minute)}
+	r.setCondition(req, k8sudov1alpha1.SudoRequestConditionAuthorized, metav1.ConditionFalse, "Denied", "third")
+	r.setCondition(req, k8sudov1alpha1.SudoRequestConditionGranted, metav1.ConditionFalse, "Denied", "third")
+	if got, want := len(req.Status.Conditions), 2; got != want {
+		t.Fatalf("wrong number of conditions: (got != want) %d != %d", got, want)
+	}
+	if got, want := req.Status.Conditions[0].LastTransitionTime.Time, start.Add(2*time.Minute); !got.Equal(want) {
+		t.Errorf("wrong LastTransitionTime: (got != want) %s != %s", got, want)
+	}
+}
+
+func TestClearTampered(t *testing.T) {
+	tests := []struct {
+		name            string
+		tampered        metav1.ConditionStatus
+		expectedChanged bool
+		expectedStatus  metav1.ConditionStatus
+	}{
+		{
+			name:            "never tampered",
+			expectedChanged: false,
+			expectedStatus:  "",
+		},
+		{
+			name:            "tampered",
+			tampered:        metav1.ConditionTrue,
+			expectedChanged: true,
+			expectedStatus:  metav1.ConditionFalse,
+		},
+		{
+			name:            "already cleared",
+			tampered:        metav1.ConditionFalse,
+			expectedChanged: false,
+			expectedStatus:  metav1.ConditionFalse,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{}
+			r := &SudoRequestReconciler{
+				Clock: FakeClock{CurrentTime: time.Now()},
+			}
+			if test.tampered != "" {
+				r.setCondition(req, k8sudov1alpha1.SudoRequestConditionTampered, test.tampered, "BindingDeleted", "")
+			}
+			if got, want := r.clearTampered(req), test.expectedChanged; got != want {
+				t.Errorf("wrong changed: (got != want) %t != %t", got, want)
+			}
+			if got, want := conditionStatus(req, k8sudov1alpha1.SudoRequestConditionTampered), test.expectedStatus; got != want {
+				t.Errorf("wrong Tampered status: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusFromChildConditions(t *testing.T) {
+	creationTimestamp := time.Now()
+	tests := []struct {
+		name            string
+		childCRB        *rbacv1.ClusterRoleBinding
+		revoked         *k8sudov1alpha1.SudoRequestRevocation
+		currentTime     time.Time
+		expectedGranted metav1.ConditionStatus
+		expectedExpired metav1.ConditionStatus
+		expectedReason  string
+	}{
+		{
+			name:            "pending",
+			currentTime:     creationTimestamp,
+			expectedExpired: metav1.ConditionFalse,
+			expectedReason:  "NotExpired",
+		},
+		{
+			name: "granted",
+			childCRB: &rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "crb", CreationTimestamp: metav1.Time{Time: creationTimestamp}},
+			},
+			currentTime:     creationTimestamp,
+			expectedGranted: metav1.ConditionTrue,
+			expectedExpired: metav1.ConditionFalse,
+			expectedReason:  "NotExpired",
+		},
+		{
+			name: "expired",
+			childCRB: &rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "crb", CreationTimestamp: metav1.Time{Time: creationTimestamp}},
+			},
+			currentTime:     creationTimestamp.Add(policy.DefaultDuration + time.Minute),
+			expectedGranted: metav1.ConditionFalse,
+			expectedExpired: metav1.ConditionTrue,
+			expectedReason:  "Expired",
+		},
+		{
+			name: "revoked",
+			childCRB: &rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "crb", CreationTimestamp: metav1.Time{Time: creationTimestamp}},
+			},
+			revoked:         &k8sudov1alpha1.SudoRequestRevocation{User: "admin"},
+			currentTime:     creationTimestamp,
+			expectedGranted: metav1.ConditionFalse,
+			expectedExpired: metav1.ConditionTrue,
+			expectedReason:  "Revoked",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: creationTimestamp}},
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User:    "user",
+					Role:    "role",
+					Revoked: test.revoked,
+				},
+			}
+			r := &SudoRequestReconciler{
+				Clock: FakeClock{CurrentTime: test.currentTime},
+			}
+			r.updateStatusFromChild(req, test.childCRB)
+			if got, want := conditionStatus(req, k8sudov1alpha1.SudoRequestConditionGranted), test.expectedGranted; got != want {
+				t.Errorf("wrong Granted condition: (got != want) %s != %s", got, want)
+			}
+			if got, want := conditionStatus(req, k8sudov1alpha1.SudoRequestConditionExpired), test.expectedExpired; got != want {
+				t.Errorf("wrong Expired condition: (got != want) %s != %s", got, want)
+			}
+			for _, condition := range req.Status.Conditions {
+				if condition.Type == k8sudov1alpha1.SudoRequestConditionExpired && condition.Reason != test.expectedReason {
+					t.Errorf("wrong Expired reason: (got != want) %s != %s", condition.Reason, test.expectedReason)
+				}
+			}
 		})
 	}
 }
 
+func TestAddHistory(t *testing.T) {
+	start := time.Now()
+	req := &k8sudov1alpha1.SudoRequest{}
+	r := &SudoRequestReconciler{
+		Clock: FakeClock{CurrentTime: start},
+	}
+
+	// Nothing is recorded before the request has a status
+	r.addHistory(req, historyActorController)
+	if got, want := len(req.Status.History), 0; got != want {
+		t.Fatalf("wrong history length: (got != want) %d != %d", got, want)
+	}
+
+	req.Status.Status = k8sudov1alpha1.SudoRequestStatusPending
+	r.addHistory(req, historyActorController)
+	r.addHistory(req, historyActorController)
+	req.Status.Status = k8sudov1alpha1.SudoRequestStatusRevoked
+	req.Status.Reason = "Revoked by admin"
+	r.addHistory(req, "admin")
+	expected := []k8sudov1alpha1.SudoRequestHistoryEntry{
+		{
+			Status: k8sudov1alpha1.SudoRequestStatusPending,
+			Time:   metav1.Time{Time: start},
+			Actor:  historyActorController,
+		},
+		{
+			Status: k8sudov1alpha1.SudoRequestStatusRevoked,
+			Time:   metav1.Time{Time: start},
+			Actor:  "admin",
+			Reason: "Revoked by admin",
+		},
+	}
+	if got, want := req.Status.History, expected; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong history: (got != want) %+v != %+v", got, want)
+	}
+
+	// The oldest entries are dropped
+	for i := 0; i < maxHistory; i++ {
+		req.Status.Status = k8sudov1alpha1.SudoRequestStatusStatus(fmt.Sprintf("Status%d", i))
+		r.addHistory(req, historyActorController)
+	}
+	if got, want := len(req.Status.History), maxHistory; got != want {
+		t.Fatalf("wrong history length: (got != want) %d != %d", got, want)
+	}
+	if got, want := req.Status.History[0].Status, k8sudov1alpha1.SudoRequestStatusStatus("Status0"); got != want {
+		t.Errorf("wrong oldest entry: (got != want) %s != %s", got, want)
+	}
+}
+
 func TestCreateClusterRoleBinding(t *testing.T) {
 	user := "user"
 	role := "role"
 	reqName := "sudo-req"
-	creationTimestamp := time.Now()
+	creationTimestamp := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)
 
 	req := &k8sudov1alpha1.SudoRequest{
 		Spec: k8sudov1alpha1.SudoRequestSpec{
@@ -411,63 +834,195 @@ func TestCreateClusterRoleBinding(t *testing.T) {
 		t.Errorf("wrong RoleRef: (got != want) %#v != %#v", got, want)
 	}
 
-	expectedName := fmt.Sprintf("sudo-%s-%s-%s-%s", user, role, reqName, creationTimestamp.Format("2006.01.02.15.04.05"))
-	if got, want := crb.ObjectMeta.Name, expectedName; got != want {
+	if got, want := crb.ObjectMeta.Name, "sudo-user-role-sudo-req-e37b9acf94"; got != want {
 		t.Errorf("wrong Name: (got != want) %s != %s", got, want)
 	}
+	expectedLabels := map[string]string{
+		k8sudov1alpha1.ManagedByLabel:        k8sudov1alpha1.ManagedByValue,
+		k8sudov1alpha1.SudoRequestAnnotation: reqName,
+		k8sudov1alpha1.UserAnnotation:        user,
+		k8sudov1alpha1.RoleAnnotation:        role,
+	}
+	if got, want := crb.Labels, expectedLabels; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong Labels: (got != want) %v != %v", got, want)
+	}
 }
 
-func TestFindChildCRB(t *testing.T) {
-	req := k8sudov1alpha1.SudoRequest{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:              "sudo-req",
-			CreationTimestamp: metav1.Time{Time: time.Now()},
-		},
+func TestCreateClusterRoleBindingForGroup(t *testing.T) {
+	req := &k8sudov1alpha1.SudoRequest{
 		Spec: k8sudov1alpha1.SudoRequestSpec{
-			User: "user",
-			Role: "role",
+			Group: "sre",
+			Role:  "role",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "sudo-req",
 		},
 	}
 
-	validCRB := rbacv1.ClusterRoleBinding{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "ClusterRoleBinding",
-			APIVersion: "rbac.authorization.k8s.io/v1",
-		},
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	r := &SudoRequestReconciler{
+		Clock:  FakeClock{},
+		Scheme: scheme,
+	}
+	log := testinglogr.TestLogger{T: t}
+	crb, err := r.createClusterRoleBinding(req, log)
+	if err != nil {
+		t.Fatalf("error creating CRB: %v", err)
+	}
+	if got, want := crb.Subjects, ([]rbacv1.Subject{{Kind: "Group", APIGroup: "rbac.authorization.k8s.io", Name: "sre"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong Subject: (got != want) %#v != %#v", got, want)
+	}
+}
+
+func TestUpdateStatusFromChildRoleBinding(t *testing.T) {
+	creationTimestamp := time.Now()
+	req := &k8sudov1alpha1.SudoRequest{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: crbName(&req),
+			CreationTimestamp: metav1.Time{Time: creationTimestamp},
+		},
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User:      "user",
+			Role:      "role",
+			Namespace: "ns",
 		},
 	}
-
-	invalidCRB := rbacv1.ClusterRoleBinding{
+	childRB := &rbacv1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: crbName(&req) + "-wrong",
+			Name:      "sudo-rb",
+			Namespace: "ns",
 		},
 	}
+	r := &SudoRequestReconciler{
+		Clock: FakeClock{CurrentTime: creationTimestamp},
+	}
+	r.updateStatusFromChildRoleBinding(req, childRB)
+	if got, want := req.Status.Status, k8sudov1alpha1.SudoRequestStatusReady; got != want {
+		t.Errorf("wrong status: (got != want) %s != %s", got, want)
+	}
+	if got, want := req.Status.RoleBinding, childRB.Name; got != want {
+		t.Errorf("wrong RoleBinding name: (got != want) %s != %s", got, want)
+	}
+	if req.Status.GrantedAt == nil || !req.Status.GrantedAt.Time.Equal(creationTimestamp) {
+		t.Errorf("wrong grantedAt: %v", req.Status.GrantedAt)
+	}
+	if got, want := req.Status.ClusterRoleBinding, ""; got != want {
+		t.Errorf("wrong ClusterRoleBinding name: (got != want) %s != %s", got, want)
+	}
+}
 
+func TestCreateRoleBinding(t *testing.T) {
 	tests := []struct {
-		name          string
-		crbs          []rbacv1.ClusterRoleBinding
-		expectError   bool
-		expectedChild *rbacv1.ClusterRoleBinding
+		name     string
+		roleKind string
+		expected string
 	}{
 		{
-			name:          "child exists",
-			crbs:          []rbacv1.ClusterRoleBinding{validCRB},
-			expectError:   false,
-			expectedChild: &validCRB,
+			name:     "default kind",
+			roleKind: "",
+			expected: "ClusterRole",
 		},
 		{
-			name:          "child does not exist",
-			crbs:          []rbacv1.ClusterRoleBinding{invalidCRB},
-			expectError:   false,
-			expectedChild: nil,
+			name:     "cluster role",
+			roleKind: "ClusterRole",
+			expected: "ClusterRole",
+		},
+		{
+			name:     "role",
+			roleKind: "Role",
+			expected: "Role",
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			clock := FakeClock{}
+			req := &k8sudov1alpha1.SudoRequest{
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User:      "user",
+					Role:      "role",
+					RoleKind:  test.roleKind,
+					Namespace: "ns",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "sudo-req",
+					CreationTimestamp: metav1.Time{Time: time.Now()},
+				},
+			}
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			r := &SudoRequestReconciler{
+				Clock:  FakeClock{},
+				Scheme: scheme,
+			}
+			log := testinglogr.TestLogger{T: t}
+			rb, err := r.createRoleBinding(req, "ns", log)
+			if err != nil {
+				t.Fatalf("error creating RoleBinding: %v", err)
+			}
+			if got, want := rb.Namespace, "ns"; got != want {
+				t.Errorf("wrong Namespace: (got != want) %s != %s", got, want)
+			}
+			if got, want := rb.Subjects, ([]rbacv1.Subject{{Kind: "User", APIGroup: "rbac.authorization.k8s.io", Name: "user"}}); !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong Subject: (got != want) %#v != %#v", got, want)
+			}
+			if got, want := rb.RoleRef, (rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: test.expected, Name: "role"}); !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong RoleRef: (got != want) %#v != %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestFindChildCRB(t *testing.T) {
+	req := k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "sudo-req",
+			CreationTimestamp: metav1.Time{Time: time.Now()},
+		},
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User: "user",
+			Role: "role",
+		},
+	}
+
+	validCRB := rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ClusterRoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: crbName(&req),
+		},
+	}
+
+	invalidCRB := rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: crbName(&req) + "-wrong",
+		},
+	}
+
+	tests := []struct {
+		name          string
+		crbs          []rbacv1.ClusterRoleBinding
+		expectError   bool
+		expectedChild *rbacv1.ClusterRoleBinding
+	}{
+		{
+			name:          "child exists",
+			crbs:          []rbacv1.ClusterRoleBinding{validCRB},
+			expectError:   false,
+			expectedChild: &validCRB,
+		},
+		{
+			name:          "child does not exist",
+			crbs:          []rbacv1.ClusterRoleBinding{invalidCRB},
+			expectError:   false,
+			expectedChild: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := FakeClock{}
 			scheme := runtime.NewScheme()
 			k8sudov1alpha1.AddToScheme(scheme)
 			rbacv1.AddToScheme(scheme)
@@ -548,9 +1103,10 @@ func TestOnPending(t *testing.T) {
 			rbacv1.AddToScheme(scheme)
 			client := fake.NewFakeClientWithScheme(scheme, &rbacv1.ClusterRoleBindingList{Items: test.crbs})
 			r := &SudoRequestReconciler{
-				Clock:  clock,
-				Scheme: scheme,
-				Client: client,
+				Clock:    clock,
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
 			}
 			log := testinglogr.TestLogger{T: t}
 			ctx := context.Background()
@@ -612,9 +1168,10 @@ func TestOnExpired(t *testing.T) {
 			rbacv1.AddToScheme(scheme)
 			client := fake.NewFakeClientWithScheme(scheme, &rbacv1.ClusterRoleBindingList{Items: test.crbs})
 			r := &SudoRequestReconciler{
-				Clock:  clock,
-				Scheme: scheme,
-				Client: client,
+				Clock:    clock,
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
 			}
 			log := testinglogr.TestLogger{T: t}
 			ctx := context.Background()
@@ -641,3 +1198,1869 @@ func TestOnExpired(t *testing.T) {
 		})
 	}
 }
+
+func TestRepairClusterRoleBinding(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "request"},
+		Spec:       k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+		Status:     k8sudov1alpha1.SudoRequestStatus{Status: k8sudov1alpha1.SudoRequestStatusReady},
+	}
+	expected, err := (&SudoRequestReconciler{Scheme: scheme}).createClusterRoleBinding(sudoReq, testinglogr.TestLogger{T: t})
+	if err != nil {
+		t.Fatalf("error creating expected binding: %v", err)
+	}
+	tests := []struct {
+		name           string
+		modify         func(crb *rbacv1.ClusterRoleBinding)
+		deleted        bool
+		expectTampered bool
+		expectedReason string
+	}{
+		{
+			name:   "unchanged",
+			modify: func(crb *rbacv1.ClusterRoleBinding) {},
+		},
+		{
+			name: "labels added",
+			modify: func(crb *rbacv1.ClusterRoleBinding) {
+				crb.Labels = map[string]string{"team": "sre"}
+			},
+		},
+		{
+			name: "label changed",
+			modify: func(crb *rbacv1.ClusterRoleBinding) {
+				crb.Labels[k8sudov1alpha1.ManagedByLabel] = "someone"
+			},
+			expectTampered: true,
+			expectedReason: "BindingModified",
+		},
+		{
+			name:           "deleted",
+			deleted:        true,
+			expectTampered: true,
+			expectedReason: "BindingDeleted",
+		},
+		{
+			name: "subject added",
+			modify: func(crb *rbacv1.ClusterRoleBinding) {
+				crb.Subjects = append(crb.Subjects, rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "mallory"})
+			},
+			expectTampered: true,
+			expectedReason: "BindingModified",
+		},
+		{
+			name: "role changed",
+			modify: func(crb *rbacv1.ClusterRoleBinding) {
+				crb.RoleRef.Name = "cluster-admin"
+			},
+			expectTampered: true,
+			expectedReason: "BindingModified",
+		},
+		{
+			name: "owner removed",
+			modify: func(crb *rbacv1.ClusterRoleBinding) {
+				crb.OwnerReferences = nil
+			},
+			expectTampered: true,
+			expectedReason: "BindingModified",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objs []runtime.Object
+			if !test.deleted {
+				crb := expected.DeepCopy()
+				test.modify(crb)
+				objs = append(objs, crb)
+			}
+			client := fake.NewFakeClientWithScheme(scheme, objs...)
+			r := &SudoRequestReconciler{
+				Clock:    FakeClock{},
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
+			}
+			log := testinglogr.TestLogger{T: t}
+			ctx := context.Background()
+			sudoReq := sudoReq.DeepCopy()
+			tampered, err := r.repairClusterRoleBinding(ctx, sudoReq, log)
+			if err != nil {
+				t.Fatalf("repairClusterRoleBinding returned an error: %v", err)
+			}
+			if got, want := tampered, test.expectTampered; got != want {
+				t.Errorf("wrong tampered: (got != want) %t != %t", got, want)
+			}
+
+			var crb rbacv1.ClusterRoleBinding
+			if err := client.Get(ctx, types.NamespacedName{Name: expected.Name}, &crb); err != nil {
+				t.Fatalf("error getting ClusterRoleBinding: %v", err)
+			}
+			if drift := bindingDrift(expected, &crb); len(drift) != 0 {
+				t.Errorf("ClusterRoleBinding wasn't restored, changed: %v", drift)
+			}
+			if !hasMetadata(&crb, expected) {
+				t.Errorf("ClusterRoleBinding labels and annotations weren't restored: %v %v", crb.Labels, crb.Annotations)
+			}
+
+			var condition *k8sudov1alpha1.SudoRequestCondition
+			for i := range sudoReq.Status.Conditions {
+				if sudoReq.Status.Conditions[i].Type == k8sudov1alpha1.SudoRequestConditionTampered {
+					condition = &sudoReq.Status.Conditions[i]
+				}
+			}
+			if !test.expectTampered {
+				if condition != nil {
+					t.Errorf("unexpected Tampered condition: %+v", condition)
+				}
+				return
+			}
+			if condition == nil {
+				t.Fatalf("no Tampered condition: %+v", sudoReq.Status.Conditions)
+			}
+			if got, want := condition.Reason, test.expectedReason; got != want {
+				t.Errorf("wrong Reason: (got != want) %q != %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRepairFromGrant(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	granted := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "request"},
+		Spec:       k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+		Status:     k8sudov1alpha1.SudoRequestStatus{Status: k8sudov1alpha1.SudoRequestStatusReady},
+	}
+	granted.Status.Grant = grantFor(granted)
+	expected, err := (&SudoRequestReconciler{Scheme: scheme}).createClusterRoleBinding(granted, testinglogr.TestLogger{T: t})
+	if err != nil {
+		t.Fatalf("error creating expected binding: %v", err)
+	}
+	tests := []struct {
+		name           string
+		deleted        bool
+		expectTampered bool
+	}{
+		{
+			name: "unchanged binding",
+		},
+		{
+			name:           "deleted binding",
+			deleted:        true,
+			expectTampered: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objs []runtime.Object
+			if !test.deleted {
+				objs = append(objs, expected.DeepCopy())
+			}
+			client := fake.NewFakeClientWithScheme(scheme, objs...)
+			r := &SudoRequestReconciler{
+				Clock:    FakeClock{},
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
+			}
+			ctx := context.Background()
+			// The spec is changed without going through the webhook
+			sudoReq := granted.DeepCopy()
+			sudoReq.Spec.User = "mallory"
+			sudoReq.Spec.Role = "cluster-admin"
+			tampered, err := r.repairClusterRoleBinding(ctx, sudoReq, testinglogr.TestLogger{T: t})
+			if err != nil {
+				t.Fatalf("repairClusterRoleBinding returned an error: %v", err)
+			}
+			if got, want := tampered, test.expectTampered; got != want {
+				t.Errorf("wrong tampered: (got != want) %t != %t", got, want)
+			}
+
+			var crbs rbacv1.ClusterRoleBindingList
+			if err := client.List(ctx, &crbs); err != nil {
+				t.Fatalf("error listing ClusterRoleBindings: %v", err)
+			}
+			if got, want := len(crbs.Items), 1; got != want {
+				t.Fatalf("wrong number of ClusterRoleBindings: (got != want) %d != %d", got, want)
+			}
+			crb := crbs.Items[0]
+			if got, want := crb.RoleRef.Name, "role"; got != want {
+				t.Errorf("wrong role: (got != want) %s != %s", got, want)
+			}
+			if got, want := crb.Subjects[0].Name, "user"; got != want {
+				t.Errorf("wrong subject: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRepairRoleBindings(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "request"},
+		Spec:       k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role", Namespaces: []string{"a", "b"}},
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			Status: k8sudov1alpha1.SudoRequestStatusReady,
+			Namespaces: []k8sudov1alpha1.SudoRequestNamespaceStatus{
+				{Namespace: "a", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+				{Namespace: "b", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+			},
+		},
+	}
+	sudoReq.Status.Grant = grantFor(sudoReq)
+	expected := map[string]*rbacv1.RoleBinding{}
+	for _, namespace := range []string{"a", "b"} {
+		rb, err := (&SudoRequestReconciler{Scheme: scheme}).createRoleBinding(sudoReq, namespace, testinglogr.TestLogger{T: t})
+		if err != nil {
+			t.Fatalf("error creating expected binding: %v", err)
+		}
+		expected[namespace] = rb
+	}
+	tests := []struct {
+		name           string
+		modify         func(rb *rbacv1.RoleBinding)
+		deleted        bool
+		expectTampered bool
+		expectedReason string
+	}{
+		{
+			name:   "unchanged",
+			modify: func(rb *rbacv1.RoleBinding) {},
+		},
+		{
+			name:           "deleted",
+			deleted:        true,
+			expectTampered: true,
+			expectedReason: "BindingDeleted",
+		},
+		{
+			name: "subject added",
+			modify: func(rb *rbacv1.RoleBinding) {
+				rb.Subjects = append(rb.Subjects, rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "mallory"})
+			},
+			expectTampered: true,
+			expectedReason: "BindingModified",
+		},
+		{
+			name: "role changed",
+			modify: func(rb *rbacv1.RoleBinding) {
+				rb.RoleRef.Name = "cluster-admin"
+			},
+			expectTampered: true,
+			expectedReason: "BindingModified",
+		},
+		{
+			name: "owner removed",
+			modify: func(rb *rbacv1.RoleBinding) {
+				rb.OwnerReferences = nil
+			},
+			expectTampered: true,
+			expectedReason: "BindingModified",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Only the binding in b is changed
+			objs := []runtime.Object{expected["a"].DeepCopy()}
+			if !test.deleted {
+				rb := expected["b"].DeepCopy()
+				test.modify(rb)
+				objs = append(objs, rb)
+			}
+			client := fake.NewFakeClientWithScheme(scheme, objs...)
+			r := &SudoRequestReconciler{
+				Clock:    FakeClock{},
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
+			}
+			ctx := context.Background()
+			sudoReq := sudoReq.DeepCopy()
+			tampered, err := r.repairRoleBindings(ctx, sudoReq, testinglogr.TestLogger{T: t})
+			if err != nil {
+				t.Fatalf("repairRoleBindings returned an error: %v", err)
+			}
+			if got, want := tampered, test.expectTampered; got != want {
+				t.Errorf("wrong tampered: (got != want) %t != %t", got, want)
+			}
+
+			for namespace, expected := range expected {
+				var rb rbacv1.RoleBinding
+				if err := client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: expected.Name}, &rb); err != nil {
+					t.Fatalf("error getting RoleBinding in %s: %v", namespace, err)
+				}
+				if drift := bindingDrift(expected, &rb); len(drift) != 0 {
+					t.Errorf("RoleBinding in %s wasn't restored, changed: %v", namespace, drift)
+				}
+			}
+
+			tampered = false
+			for _, condition := range sudoReq.Status.Conditions {
+				if condition.Type != k8sudov1alpha1.SudoRequestConditionTampered {
+					continue
+				}
+				tampered = true
+				if got, want := condition.Reason, test.expectedReason; got != want {
+					t.Errorf("wrong Reason: (got != want) %q != %q", got, want)
+				}
+			}
+			if got, want := tampered, test.expectTampered; got != want {
+				t.Errorf("wrong Tampered condition: (got != want) %t != %t", got, want)
+			}
+		})
+	}
+}
+
+func TestExpiresAnnotation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	expires := time.Date(2020, time.June, 2, 3, 0, 0, 0, time.UTC)
+	extended := expires.Add(30 * time.Minute)
+	granted := []k8sudov1alpha1.SudoRequestNamespaceStatus{
+		{Namespace: "a", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+		{Namespace: "b", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+	}
+	tests := []struct {
+		name             string
+		spec             k8sudov1alpha1.SudoRequestSpec
+		namespaces       []k8sudov1alpha1.SudoRequestNamespaceStatus
+		expectedBindings int
+	}{
+		{
+			name:             "cluster-wide",
+			spec:             k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+			expectedBindings: 1,
+		},
+		{
+			name:             "namespaced",
+			spec:             k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role", Namespace: "a"},
+			expectedBindings: 1,
+		},
+		{
+			name:             "namespaces",
+			spec:             k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role", Namespaces: []string{"a", "b"}},
+			namespaces:       granted,
+			expectedBindings: 2,
+		},
+	}
+
+	// expiresAnnotations returns the expiry annotation of each of the
+	// bindings
+	expiresAnnotations := func(t *testing.T, client clientpkg.Client) []string {
+		ctx := context.Background()
+		var annotations []string
+		var crbs rbacv1.ClusterRoleBindingList
+		if err := client.List(ctx, &crbs); err != nil {
+			t.Fatalf("error listing ClusterRoleBindings: %v", err)
+		}
+		for _, crb := range crbs.Items {
+			annotations = append(annotations, crb.Annotations[k8sudov1alpha1.ExpiresAnnotation])
+		}
+		var rbs rbacv1.RoleBindingList
+		if err := client.List(ctx, &rbs); err != nil {
+			t.Fatalf("error listing RoleBindings: %v", err)
+		}
+		for _, rb := range rbs.Items {
+			annotations = append(annotations, rb.Annotations[k8sudov1alpha1.ExpiresAnnotation])
+		}
+		return annotations
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewFakeClientWithScheme(scheme)
+			r := &SudoRequestReconciler{
+				Clock:    FakeClock{},
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
+			}
+			log := testinglogr.TestLogger{T: t}
+			ctx := context.Background()
+			sudoReq := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "request"},
+				Spec:       test.spec,
+				Status: k8sudov1alpha1.SudoRequestStatus{
+					Status:     k8sudov1alpha1.SudoRequestStatusPending,
+					Namespaces: test.namespaces,
+					Expires:    &metav1.Time{Time: expires},
+				},
+			}
+			sudoReq.Status.Grant = grantFor(sudoReq)
+			if _, err := r.OnPending(ctx, sudoReq, log); err != nil {
+				t.Fatalf("OnPending returned an error: %v", err)
+			}
+			annotations := expiresAnnotations(t, client)
+			if got, want := len(annotations), test.expectedBindings; got != want {
+				t.Fatalf("wrong number of bindings: (got != want) %d != %d", got, want)
+			}
+			for _, annotation := range annotations {
+				if got, want := annotation, "2020-06-02T03:00:00Z"; got != want {
+					t.Errorf("wrong expiry annotation when granted: (got != want) %s != %s", got, want)
+				}
+			}
+
+			// An approved extension moves the expiry
+			sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusReady
+			sudoReq.Status.Expires = &metav1.Time{Time: extended}
+			var tampered bool
+			var err error
+			if test.spec.Namespace != "" || len(test.spec.Namespaces) > 0 {
+				tampered, err = r.repairRoleBindings(ctx, sudoReq, log)
+			} else {
+				tampered, err = r.repairClusterRoleBinding(ctx, sudoReq, log)
+			}
+			if err != nil {
+				t.Fatalf("repair returned an error: %v", err)
+			}
+			if tampered {
+				t.Errorf("extending the request was treated as tampering: %+v", sudoReq.Status.Conditions)
+			}
+			annotations = expiresAnnotations(t, client)
+			if got, want := len(annotations), test.expectedBindings; got != want {
+				t.Fatalf("wrong number of bindings: (got != want) %d != %d", got, want)
+			}
+			for _, annotation := range annotations {
+				if got, want := annotation, "2020-06-02T03:30:00Z"; got != want {
+					t.Errorf("wrong expiry annotation when extended: (got != want) %s != %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOnlyActionsChanged(t *testing.T) {
+	old := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "req", ResourceVersion: "1"},
+		Spec:       k8sudov1alpha1.SudoRequestSpec{User: "alice", Role: "role"},
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			Status:  k8sudov1alpha1.SudoRequestStatusReady,
+			Actions: &k8sudov1alpha1.SudoRequestActions{Count: 1},
+		},
+	}
+	tests := []struct {
+		name     string
+		modify   func(sudoReq *k8sudov1alpha1.SudoRequest)
+		expected bool
+	}{
+		{
+			name: "actions recorded",
+			modify: func(sudoReq *k8sudov1alpha1.SudoRequest) {
+				sudoReq.Status.Actions.Count = 2
+			},
+			expected: true,
+		},
+		{
+			name: "status changed",
+			modify: func(sudoReq *k8sudov1alpha1.SudoRequest) {
+				sudoReq.Status.Actions.Count = 2
+				sudoReq.Status.Status = k8sudov1alpha1.SudoRequestStatusExpired
+			},
+			expected: false,
+		},
+		{
+			name: "revoked",
+			modify: func(sudoReq *k8sudov1alpha1.SudoRequest) {
+				sudoReq.Generation = 2
+				sudoReq.Spec.Revoked = &k8sudov1alpha1.SudoRequestRevocation{User: "alice"}
+			},
+			expected: false,
+		},
+		{
+			name:     "resync",
+			modify:   func(sudoReq *k8sudov1alpha1.SudoRequest) {},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := old.DeepCopy()
+			updated.ResourceVersion = "2"
+			test.modify(updated)
+			if got, want := onlyActionsChanged(old, updated), test.expected; got != want {
+				t.Errorf("wrong result: (got != want) %t != %t", got, want)
+			}
+		})
+	}
+}
+
+func TestSudoRequestForBinding(t *testing.T) {
+	controller := true
+	tests := []struct {
+		name     string
+		obj      metav1.Object
+		expected []reconcile.Request
+	}{
+		{
+			name: "annotated RoleBinding",
+			obj: &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{
+				Name:        "binding",
+				Namespace:   "ns",
+				Annotations: map[string]string{k8sudov1alpha1.SudoRequestAnnotation: "req"},
+			}},
+			expected: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "req"}}},
+		},
+		{
+			name: "owned ClusterRoleBinding",
+			obj: &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{
+				Name: "binding",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: apiGVStr,
+					Kind:       sudoRequestKind,
+					Name:       "req",
+					Controller: &controller,
+				}},
+			}},
+			expected: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "req"}}},
+		},
+		{
+			name: "other binding",
+			obj:  &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := sudoRequestForBinding(handler.MapObject{Meta: test.obj, Object: test.obj.(runtime.Object)})
+			if got, want := requests, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong requests: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRecordStatusChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous k8sudov1alpha1.SudoRequestStatusStatus
+		status   k8sudov1alpha1.SudoRequestStatusStatus
+		reason   string
+		expected string
+	}{
+		{
+			name:     "pending",
+			status:   k8sudov1alpha1.SudoRequestStatusPending,
+			expected: "Normal Pending Authorized to assume role",
+		},
+		{
+			name:     "denied",
+			status:   k8sudov1alpha1.SudoRequestStatusDenied,
+			reason:   "Failed to authorize: no sudo",
+			expected: "Warning Denied Failed to authorize: no sudo",
+		},
+		{
+			name:     "expired",
+			previous: k8sudov1alpha1.SudoRequestStatusReady,
+			status:   k8sudov1alpha1.SudoRequestStatusExpired,
+			expected: "Normal Expired Access to role expired",
+		},
+		{
+			name:     "unchanged",
+			previous: k8sudov1alpha1.SudoRequestStatusPending,
+			status:   k8sudov1alpha1.SudoRequestStatusPending,
+		},
+		{
+			name:     "ready",
+			previous: k8sudov1alpha1.SudoRequestStatusPending,
+			status:   k8sudov1alpha1.SudoRequestStatusReady,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &SudoRequestReconciler{
+				Recorder: recorder,
+			}
+			req := &k8sudov1alpha1.SudoRequest{
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User: "user",
+					Role: "role",
+				},
+				Status: k8sudov1alpha1.SudoRequestStatus{
+					Status: test.status,
+					Reason: test.reason,
+				},
+			}
+			r.recordStatusChange(req, test.previous)
+			var got string
+			select {
+			case got = <-recorder.Events:
+			default:
+			}
+			if want := test.expected; got != want {
+				t.Errorf("wrong event: (got != want) %q != %q", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusFromSpecRevokedAfterExpiry(t *testing.T) {
+	creationTimestamp := time.Now()
+	req := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.Time{Time: creationTimestamp},
+		},
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User:    "user",
+			Role:    "role",
+			Revoked: &k8sudov1alpha1.SudoRequestRevocation{User: "user"},
+		},
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			Status: k8sudov1alpha1.SudoRequestStatusExpired,
+		},
+	}
+	r := &SudoRequestReconciler{
+		Clock: FakeClock{CurrentTime: creationTimestamp.Add(policy.DefaultDuration).Add(time.Second)},
+	}
+	r.updateStatusFromSpec(req)
+	if got, want := req.Status.Status, k8sudov1alpha1.SudoRequestStatusExpired; got != want {
+		t.Errorf("wrong status: (got != want) %s != %s", got, want)
+	}
+}
+
+func TestOnPendingNamespaced(t *testing.T) {
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User:      "user",
+			Role:      "role",
+			Namespace: "ns",
+		},
+	}
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	r := &SudoRequestReconciler{
+		Clock:    FakeClock{},
+		Scheme:   scheme,
+		Client:   client,
+		Recorder: recorder,
+	}
+	log := testinglogr.TestLogger{T: t}
+	ctx := context.Background()
+	if _, err := r.OnPending(ctx, sudoReq, log); err != nil {
+		t.Fatalf("OnPending returned an error: %v", err)
+	}
+	rb := rbacv1.RoleBinding{}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: crbName(sudoReq)}, &rb); err != nil {
+		t.Errorf("failed to get rb: %s", err)
+	}
+	if got, want := <-recorder.Events, "Normal Granted Granted ClusterRole role in ns to user"; got != want {
+		t.Errorf("wrong event: (got != want) %q != %q", got, want)
+	}
+	crb := rbacv1.ClusterRoleBinding{}
+	if err := client.Get(ctx, types.NamespacedName{Name: crbName(sudoReq)}, &crb); !apierrors.IsNotFound(err) {
+		t.Errorf("expected no crb, got: %v", err)
+	}
+}
+
+func TestOnExpiredNamespaced(t *testing.T) {
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			Namespace: "ns",
+		},
+	}
+	sudoReq.Status.RoleBinding = crbName(sudoReq)
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme, &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      crbName(sudoReq),
+			Namespace: "ns",
+		},
+	})
+	r := &SudoRequestReconciler{
+		Clock:    FakeClock{},
+		Scheme:   scheme,
+		Client:   client,
+		Recorder: record.NewFakeRecorder(10),
+	}
+	log := testinglogr.TestLogger{T: t}
+	ctx := context.Background()
+	if _, err := r.OnExpired(ctx, sudoReq, log); err != nil {
+		t.Fatalf("OnExpired returned an error: %v", err)
+	}
+	rb := rbacv1.RoleBinding{}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: crbName(sudoReq)}, &rb); !apierrors.IsNotFound(err) {
+		t.Errorf("expected rb to be deleted, got: %v", err)
+	}
+}
+
+func TestOnDeleted(t *testing.T) {
+	deletedAt := metav1.NewTime(time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC))
+	sudoReqFor := func(spec k8sudov1alpha1.SudoRequestSpec, finalizers ...string) *k8sudov1alpha1.SudoRequest {
+		spec.User = "user"
+		spec.Role = "role"
+		return &k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "request",
+				DeletionTimestamp: &deletedAt,
+				Finalizers:        finalizers,
+			},
+			Spec: spec,
+		}
+	}
+	clusterWide := sudoReqFor(k8sudov1alpha1.SudoRequestSpec{}, sudoRequestFinalizer)
+	namespaced := sudoReqFor(k8sudov1alpha1.SudoRequestSpec{Namespace: "ns"}, sudoRequestFinalizer)
+	tests := []struct {
+		name              string
+		sudoReq           *k8sudov1alpha1.SudoRequest
+		bindings          []runtime.Object
+		expectedDecisions []string
+		expectedFinalizer bool
+	}{
+		{
+			name:    "cluster-wide",
+			sudoReq: clusterWide,
+			bindings: []runtime.Object{
+				&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crbName(clusterWide)}},
+			},
+			expectedDecisions: []string{audit.DecisionRemoved},
+		},
+		{
+			name:    "namespaced",
+			sudoReq: namespaced,
+			bindings: []runtime.Object{
+				&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crbName(namespaced), Namespace: "ns"}},
+			},
+			expectedDecisions: []string{audit.DecisionRemoved},
+		},
+		{
+			name:              "already removed",
+			sudoReq:           clusterWide,
+			expectedDecisions: []string{audit.DecisionDeleted},
+		},
+		{
+			name:    "without the finalizer",
+			sudoReq: sudoReqFor(k8sudov1alpha1.SudoRequestSpec{}),
+			bindings: []runtime.Object{
+				&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crbName(clusterWide)}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			rbacv1.AddToScheme(scheme)
+			sudoReq := test.sudoReq.DeepCopy()
+			client := fake.NewFakeClientWithScheme(scheme, append(test.bindings, sudoReq.DeepCopy())...)
+			var buf bytes.Buffer
+			r := &SudoRequestReconciler{
+				Clock:    FakeClock{CurrentTime: deletedAt.Time},
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
+				Audit:    audit.NewLogger(testinglogr.TestLogger{T: t}, nil, audit.NewWriterSink("test", &buf)),
+			}
+			log := testinglogr.TestLogger{T: t}
+			ctx := context.Background()
+			if _, err := r.OnDeleted(ctx, sudoReq, log); err != nil {
+				t.Fatalf("OnDeleted returned an error: %v", err)
+			}
+
+			var updated k8sudov1alpha1.SudoRequest
+			if err := client.Get(ctx, types.NamespacedName{Name: sudoReq.Name}, &updated); err != nil {
+				t.Fatalf("error getting SudoRequest: %v", err)
+			}
+			if got, want := len(updated.Finalizers), 0; got != want {
+				t.Errorf("wrong number of finalizers: (got != want) %d != %d: %v", got, want, updated.Finalizers)
+			}
+			if test.sudoReq.Finalizers != nil {
+				for _, binding := range test.bindings {
+					key, err := clientpkg.ObjectKeyFromObject(binding)
+					if err != nil {
+						t.Fatalf("error getting key of binding: %v", err)
+					}
+					if err := client.Get(ctx, key, binding); !apierrors.IsNotFound(err) {
+						t.Errorf("expected binding %s to be deleted, got: %v", key, err)
+					}
+				}
+			}
+
+			records := auditRecords(t, &buf)
+			if got, want := len(records), len(test.expectedDecisions); got != want {
+				t.Fatalf("wrong number of records: (got != want) %d != %d: %+v", got, want, records)
+			}
+			for i, record := range records {
+				if got, want := record.Event, audit.EventDeletion; got != want {
+					t.Errorf("wrong Event: (got != want) %q != %q", got, want)
+				}
+				if got, want := record.Decision, test.expectedDecisions[i]; got != want {
+					t.Errorf("wrong Decision: (got != want) %q != %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseFinalizer(t *testing.T) {
+	sudoReqIn := func(status k8sudov1alpha1.SudoRequestStatusStatus) *k8sudov1alpha1.SudoRequest {
+		return &k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "request", Finalizers: []string{sudoRequestFinalizer}},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+			Status:     k8sudov1alpha1.SudoRequestStatus{Status: status},
+		}
+	}
+	expired := sudoReqIn(k8sudov1alpha1.SudoRequestStatusExpired)
+	expired.Status.ClusterRoleBinding = crbName(expired)
+	denied := sudoReqIn(k8sudov1alpha1.SudoRequestStatusDenied)
+	tests := []struct {
+		name     string
+		sudoReq  *k8sudov1alpha1.SudoRequest
+		onExpiry bool
+	}{
+		{
+			name:     "expired",
+			sudoReq:  expired,
+			onExpiry: true,
+		},
+		{
+			name:    "denied with a binding the status doesn't record",
+			sudoReq: denied,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			rbacv1.AddToScheme(scheme)
+			sudoReq := test.sudoReq.DeepCopy()
+			crb := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crbName(sudoReq)}}
+			client := fake.NewFakeClientWithScheme(scheme, crb, sudoReq.DeepCopy())
+			r := &SudoRequestReconciler{
+				Clock:    FakeClock{},
+				Scheme:   scheme,
+				Client:   client,
+				Recorder: record.NewFakeRecorder(10),
+			}
+			log := testinglogr.TestLogger{T: t}
+			ctx := context.Background()
+			var err error
+			if test.onExpiry {
+				_, err = r.OnExpired(ctx, sudoReq, log)
+			} else {
+				err = r.releaseFinalizer(ctx, sudoReq, log)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var updated k8sudov1alpha1.SudoRequest
+			if err := client.Get(ctx, types.NamespacedName{Name: sudoReq.Name}, &updated); err != nil {
+				t.Fatalf("error getting SudoRequest: %v", err)
+			}
+			if got, want := len(updated.Finalizers), 0; got != want {
+				t.Errorf("wrong number of finalizers: (got != want) %d != %d: %v", got, want, updated.Finalizers)
+			}
+			if err := client.Get(ctx, types.NamespacedName{Name: crb.Name}, crb); !apierrors.IsNotFound(err) {
+				t.Errorf("expected ClusterRoleBinding to be deleted, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestRequestedNamespaces(t *testing.T) {
+	req := &k8sudov1alpha1.SudoRequest{
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			Namespaces: []string{"b", "a", "", "b"},
+		},
+	}
+	if got, want := requestedNamespaces(req), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong namespaces: (got != want) %v != %v", got, want)
+	}
+}
+
+func TestUpdateStatusFromNamespaces(t *testing.T) {
+	granted := k8sudov1alpha1.SudoRequestNamespaceStatus{
+		Namespace: "a",
+		Status:    k8sudov1alpha1.SudoRequestNamespaceStatusGranted,
+	}
+	denied := k8sudov1alpha1.SudoRequestNamespaceStatus{
+		Namespace: "b",
+		Status:    k8sudov1alpha1.SudoRequestNamespaceStatusDenied,
+		Reason:    "Failed to authorize: denied",
+	}
+
+	tests := []struct {
+		name           string
+		namespaces     []k8sudov1alpha1.SudoRequestNamespaceStatus
+		expectedStatus k8sudov1alpha1.SudoRequestStatusStatus
+		expectedReason string
+	}{
+		{
+			name:           "all granted",
+			namespaces:     []k8sudov1alpha1.SudoRequestNamespaceStatus{granted},
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusPending,
+			expectedReason: "",
+		},
+		{
+			name:           "some granted",
+			namespaces:     []k8sudov1alpha1.SudoRequestNamespaceStatus{granted, denied},
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusPending,
+			expectedReason: "",
+		},
+		{
+			name:           "none granted",
+			namespaces:     []k8sudov1alpha1.SudoRequestNamespaceStatus{denied},
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusDenied,
+			expectedReason: "Failed to authorize in any namespace",
+		},
+		{
+			name:           "no namespaces",
+			namespaces:     []k8sudov1alpha1.SudoRequestNamespaceStatus{},
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusDenied,
+			expectedReason: "No namespaces matched the request",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{}
+			r := &SudoRequestReconciler{
+				Clock: FakeClock{},
+			}
+			r.updateStatusFromNamespaces(req, test.namespaces)
+			if got, want := req.Status.Status, test.expectedStatus; got != want {
+				t.Errorf("wrong status: (got != want) %s != %s", got, want)
+			}
+			if got, want := req.Status.Reason, test.expectedReason; got != want {
+				t.Errorf("wrong reason: (got != want) %s != %s", got, want)
+			}
+			if got, want := req.Status.Namespaces, test.namespaces; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong namespaces: (got != want) %+v != %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusFromChildRoleBindings(t *testing.T) {
+	creationTimestamp := time.Now()
+	childRB := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sudo-rb",
+			Namespace: "a",
+		},
+	}
+
+	tests := []struct {
+		name           string
+		childRBs       map[string]*rbacv1.RoleBinding
+		expectedStatus k8sudov1alpha1.SudoRequestStatusStatus
+		expectedRB     string
+	}{
+		{
+			name:           "all created",
+			childRBs:       map[string]*rbacv1.RoleBinding{"a": childRB},
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusReady,
+			expectedRB:     "sudo-rb",
+		},
+		{
+			name:           "not yet created",
+			childRBs:       map[string]*rbacv1.RoleBinding{},
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusPending,
+			expectedRB:     "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.Time{Time: creationTimestamp},
+				},
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User:       "user",
+					Role:       "role",
+					Namespaces: []string{"a", "b"},
+				},
+				Status: k8sudov1alpha1.SudoRequestStatus{
+					Status: k8sudov1alpha1.SudoRequestStatusPending,
+					Namespaces: []k8sudov1alpha1.SudoRequestNamespaceStatus{
+						{Namespace: "a", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+						{Namespace: "b", Status: k8sudov1alpha1.SudoRequestNamespaceStatusDenied},
+					},
+				},
+			}
+			r := &SudoRequestReconciler{
+				Clock: FakeClock{CurrentTime: creationTimestamp},
+			}
+			r.updateStatusFromChildRoleBindings(req, test.childRBs)
+			if got, want := req.Status.Status, test.expectedStatus; got != want {
+				t.Errorf("wrong status: (got != want) %s != %s", got, want)
+			}
+			if got, want := req.Status.Namespaces[0].RoleBinding, test.expectedRB; got != want {
+				t.Errorf("wrong RoleBinding name: (got != want) %s != %s", got, want)
+			}
+			if got, want := req.Status.Namespaces[1].RoleBinding, ""; got != want {
+				t.Errorf("wrong RoleBinding name for denied namespace: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckNamespacesAccess(t *testing.T) {
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User:       "user",
+			Role:       "role",
+			Namespaces: []string{"exists", "missing"},
+		},
+	}
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	authv1.AddToScheme(scheme)
+	corev1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "exists",
+		},
+	})
+	r := &SudoRequestReconciler{
+		Clock:  FakeClock{},
+		Scheme: scheme,
+		Client: client,
+	}
+	log := testinglogr.TestLogger{T: t}
+	statuses, err := r.checkNamespacesAccess(context.Background(), sudoReq, log)
+	if err != nil {
+		t.Fatalf("checkNamespacesAccess returned an error: %v", err)
+	}
+	// The fake client doesn't evaluate the SubjectAccessReview, so it
+	// is never allowed
+	expected := []k8sudov1alpha1.SudoRequestNamespaceStatus{
+		{
+			Namespace: "exists",
+			Status:    k8sudov1alpha1.SudoRequestNamespaceStatusDenied,
+			Reason:    "Failed to authorize: ",
+		},
+		{
+			Namespace: "missing",
+			Status:    k8sudov1alpha1.SudoRequestNamespaceStatusDenied,
+			Reason:    "Namespace not found",
+		},
+	}
+	if got, want := statuses, expected; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong namespace statuses: (got != want) %+v != %+v", got, want)
+	}
+}
+
+func TestOnPendingAndExpiredNamespaces(t *testing.T) {
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User:       "user",
+			Role:       "role",
+			Namespaces: []string{"a", "b"},
+		},
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			Namespaces: []k8sudov1alpha1.SudoRequestNamespaceStatus{
+				{Namespace: "a", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+				{Namespace: "b", Status: k8sudov1alpha1.SudoRequestNamespaceStatusDenied},
+			},
+		},
+	}
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme)
+	r := &SudoRequestReconciler{
+		Clock:    FakeClock{},
+		Scheme:   scheme,
+		Client:   client,
+		Recorder: record.NewFakeRecorder(10),
+	}
+	log := testinglogr.TestLogger{T: t}
+	ctx := context.Background()
+	res, err := r.OnPending(ctx, sudoReq, log)
+	if err != nil {
+		t.Fatalf("OnPending returned an error: %v", err)
+	}
+	if got, want := res.RequeueAfter, time.Second; got != want {
+		t.Errorf("wrong RequeueAfter: (got != want) %s != %s", got, want)
+	}
+	rb := rbacv1.RoleBinding{}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: "a", Name: crbName(sudoReq)}, &rb); err != nil {
+		t.Errorf("failed to get rb in granted namespace: %s", err)
+	}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: "b", Name: crbName(sudoReq)}, &rb); !apierrors.IsNotFound(err) {
+		t.Errorf("expected no rb in denied namespace, got: %v", err)
+	}
+	// Creating again should tolerate the existing RoleBinding
+	if _, err := r.OnPending(ctx, sudoReq, log); err != nil {
+		t.Fatalf("OnPending returned an error on retry: %v", err)
+	}
+
+	if _, err := r.OnExpired(ctx, sudoReq, log); err != nil {
+		t.Fatalf("OnExpired returned an error: %v", err)
+	}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: "a", Name: crbName(sudoReq)}, &rb); !apierrors.IsNotFound(err) {
+		t.Errorf("expected rb to be deleted, got: %v", err)
+	}
+}
+
+func TestSyncSelectedNamespaces(t *testing.T) {
+	selected := map[string]string{"team": "payments"}
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			User:              "user",
+			Role:              "role",
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: selected},
+		},
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			Status: k8sudov1alpha1.SudoRequestStatusReady,
+			Namespaces: []k8sudov1alpha1.SudoRequestNamespaceStatus{
+				{Namespace: "kept", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+				{Namespace: "relabelled", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+			},
+		},
+	}
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	authv1.AddToScheme(scheme)
+	corev1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kept", Labels: selected}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "new", Labels: selected}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "relabelled"}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crbName(sudoReq), Namespace: "kept"}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crbName(sudoReq), Namespace: "relabelled"}},
+	)
+	r := &SudoRequestReconciler{
+		Clock:  FakeClock{},
+		Scheme: scheme,
+		Client: client,
+	}
+	log := testinglogr.TestLogger{T: t}
+	ctx := context.Background()
+	changed, err := r.syncSelectedNamespaces(ctx, sudoReq, log)
+	if err != nil {
+		t.Fatalf("syncSelectedNamespaces returned an error: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected the namespaces to change")
+	}
+	// The fake client doesn't evaluate the SubjectAccessReview, so the
+	// new namespace is denied
+	expected := []k8sudov1alpha1.SudoRequestNamespaceStatus{
+		{Namespace: "kept", Status: k8sudov1alpha1.SudoRequestNamespaceStatusGranted},
+		{Namespace: "new", Status: k8sudov1alpha1.SudoRequestNamespaceStatusDenied, Reason: "Failed to authorize: "},
+	}
+	if got, want := sudoReq.Status.Namespaces, expected; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong namespace statuses: (got != want) %+v != %+v", got, want)
+	}
+	rb := rbacv1.RoleBinding{}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: "kept", Name: crbName(sudoReq)}, &rb); err != nil {
+		t.Errorf("failed to get rb in matching namespace: %s", err)
+	}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: "relabelled", Name: crbName(sudoReq)}, &rb); !apierrors.IsNotFound(err) {
+		t.Errorf("expected rb in relabelled namespace to be deleted, got: %v", err)
+	}
+
+	changed, err = r.syncSelectedNamespaces(ctx, sudoReq, log)
+	if err != nil {
+		t.Fatalf("syncSelectedNamespaces returned an error: %v", err)
+	}
+	if changed {
+		t.Errorf("expected no change on second sync")
+	}
+}
+
+func TestSudoRequestsForNamespace(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	client := fake.NewFakeClientWithScheme(scheme,
+		&k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "ready-selector"},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{NamespaceSelector: selector},
+			Status:     k8sudov1alpha1.SudoRequestStatus{Status: k8sudov1alpha1.SudoRequestStatusReady},
+		},
+		&k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "expired-selector"},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{NamespaceSelector: selector},
+			Status:     k8sudov1alpha1.SudoRequestStatus{Status: k8sudov1alpha1.SudoRequestStatusExpired},
+		},
+		&k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "ready-cluster"},
+			Status:     k8sudov1alpha1.SudoRequestStatus{Status: k8sudov1alpha1.SudoRequestStatusReady},
+		},
+	)
+	r := &SudoRequestReconciler{
+		Client: client,
+		Log:    testinglogr.TestLogger{T: t},
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+	requests := r.sudoRequestsForNamespace(handler.MapObject{Meta: ns, Object: ns})
+	expected := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "ready-selector"}}}
+	if got, want := requests, expected; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong requests: (got != want) %v != %v", got, want)
+	}
+}
+
+func approval(approver string, decision k8sudov1alpha1.SudoRequestApprovalDecision, reason string) k8sudov1alpha1.SudoRequestApproval {
+	return k8sudov1alpha1.SudoRequestApproval{
+		Spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+			SudoRequest: "req",
+			Approver:    approver,
+			Decision:    decision,
+			Reason:      reason,
+		},
+	}
+}
+
+func TestUpdateStatusFromApprovalDecisions(t *testing.T) {
+	approve := k8sudov1alpha1.SudoRequestApprovalDecisionApprove
+	reject := k8sudov1alpha1.SudoRequestApprovalDecisionReject
+
+	memberApproval := func(approver string, groups ...string) k8sudov1alpha1.SudoRequestApproval {
+		a := approval(approver, approve, "")
+		a.Spec.Groups = groups
+		return a
+	}
+
+	tests := []struct {
+		name              string
+		group             string
+		scheduleRequester string
+		approvals         []k8sudov1alpha1.SudoRequestApproval
+		required          int
+		expectedStatus    k8sudov1alpha1.SudoRequestStatusStatus
+		expectedReason    string
+		expectedApprovers []string
+		expectedActor     string
+	}{
+		{
+			name:              "no approvals",
+			approvals:         []k8sudov1alpha1.SudoRequestApproval{},
+			required:          2,
+			expectedStatus:    k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+			expectedReason:    "Approved by 0 of 2 required approvers",
+			expectedApprovers: []string{},
+		},
+		{
+			name: "enough approvals",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				approval("carol", approve, ""),
+				approval("bob", approve, ""),
+			},
+			required:          2,
+			expectedStatus:    k8sudov1alpha1.SudoRequestStatusPending,
+			expectedReason:    "",
+			expectedApprovers: []string{"bob", "carol"},
+			expectedActor:     "bob,carol",
+		},
+		{
+			name: "duplicate approver",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				approval("bob", approve, ""),
+				approval("bob", approve, ""),
+			},
+			required:          2,
+			expectedStatus:    k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+			expectedReason:    "Approved by 1 of 2 required approvers",
+			expectedApprovers: []string{"bob"},
+		},
+		{
+			name: "requester approval ignored",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				approval("user", approve, ""),
+			},
+			required:          1,
+			expectedStatus:    k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+			expectedReason:    "Approved by 0 of 1 required approvers",
+			expectedApprovers: []string{},
+		},
+		{
+			name:  "group member approval ignored",
+			group: "sre",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				memberApproval("dave", "dev", "sre"),
+				memberApproval("bob", "dev"),
+			},
+			required:          1,
+			expectedStatus:    k8sudov1alpha1.SudoRequestStatusPending,
+			expectedReason:    "",
+			expectedApprovers: []string{"bob"},
+			expectedActor:     "bob",
+		},
+		{
+			name:              "schedule requester approval ignored",
+			scheduleRequester: "admin",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				approval("admin", approve, ""),
+			},
+			required:          1,
+			expectedStatus:    k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+			expectedReason:    "Approved by 0 of 1 required approvers",
+			expectedApprovers: []string{},
+		},
+		{
+			name: "rejected",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				approval("bob", approve, ""),
+				approval("carol", reject, "not during the freeze"),
+			},
+			required:       1,
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusRejected,
+			expectedReason: "Rejected by carol: not during the freeze",
+			expectedActor:  "carol",
+		},
+		{
+			name: "rejected without reason",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				approval("carol", reject, ""),
+			},
+			required:       1,
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusRejected,
+			expectedReason: "Rejected by carol",
+			expectedActor:  "carol",
+		},
+		{
+			name: "only first decision counts",
+			approvals: []k8sudov1alpha1.SudoRequestApproval{
+				approval("bob", approve, ""),
+				approval("bob", reject, ""),
+			},
+			required:          1,
+			expectedStatus:    k8sudov1alpha1.SudoRequestStatusPending,
+			expectedReason:    "",
+			expectedApprovers: []string{"bob"},
+			expectedActor:     "bob",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "req"},
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User: "user",
+					Role: "role",
+				},
+			}
+			if test.group != "" {
+				req.Spec.User, req.Spec.Group = "", test.group
+			}
+			r := &SudoRequestReconciler{
+				Clock: FakeClock{},
+			}
+			r.updateStatusFromApprovalDecisions(req, test.scheduleRequester, test.approvals, test.required)
+			if got, want := req.Status.Status, test.expectedStatus; got != want {
+				t.Errorf("wrong status: (got != want) %s != %s", got, want)
+			}
+			if got, want := req.Status.Reason, test.expectedReason; got != want {
+				t.Errorf("wrong reason: (got != want) %s != %s", got, want)
+			}
+			if got, want := req.Status.Approvers, test.expectedApprovers; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong approvers: (got != want) %v != %v", got, want)
+			}
+			actor := ""
+			if len(req.Status.History) > 0 {
+				actor = req.Status.History[len(req.Status.History)-1].Actor
+			}
+			if got, want := actor, test.expectedActor; got != want {
+				t.Errorf("wrong actor: (got != want) %q != %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFindApprovals(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	approvals := []runtime.Object{
+		&k8sudov1alpha1.SudoRequestApproval{
+			ObjectMeta: metav1.ObjectMeta{Name: "approval"},
+			Spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest:    "req",
+				SudoRequestUID: "req-uid",
+				Approver:       "bob",
+				Decision:       k8sudov1alpha1.SudoRequestApprovalDecisionApprove,
+			},
+		},
+		&k8sudov1alpha1.SudoRequestApproval{
+			ObjectMeta: metav1.ObjectMeta{Name: "approval-of-old-request"},
+			Spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest:    "req",
+				SudoRequestUID: "old-req-uid",
+				Approver:       "carol",
+				Decision:       k8sudov1alpha1.SudoRequestApprovalDecisionApprove,
+			},
+		},
+		&k8sudov1alpha1.SudoRequestApproval{
+			ObjectMeta: metav1.ObjectMeta{Name: "unauthorized-approval"},
+			Spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest:    "req",
+				SudoRequestUID: "req-uid",
+				Approver:       "dave",
+				Decision:       k8sudov1alpha1.SudoRequestApprovalDecisionApprove,
+			},
+		},
+	}
+	r := &SudoRequestReconciler{
+		Client: &accessReviewClient{
+			Client:  fake.NewFakeClientWithScheme(scheme, approvals...),
+			allowed: map[string]string{"bob": "req", "carol": "req"},
+		},
+	}
+	req := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "req", UID: "req-uid"},
+		Spec:       k8sudov1alpha1.SudoRequestSpec{User: "alice", Role: "role"},
+	}
+	found, err := r.findApprovals(context.Background(), req, "", nil, testinglogr.TestLogger{T: t})
+	if err != nil {
+		t.Fatalf("findApprovals returned an error: %v", err)
+	}
+	names := []string{}
+	for _, approval := range found {
+		names = append(names, approval.Name)
+	}
+	if got, want := names, []string{"approval"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong approvals: (got != want) %v != %v", got, want)
+	}
+}
+
+func TestUpdateStatusFromApprovals(t *testing.T) {
+	requiredApprovals := 1
+	store := policy.NewStore(&policy.Policy{
+		APIVersion: policy.APIVersion,
+		Kind:       policy.Kind,
+		Roles: []policy.RolePolicy{
+			{
+				Name:         "cluster-admin",
+				RoleSettings: policy.RoleSettings{RequiredApprovals: &requiredApprovals},
+			},
+		},
+	})
+	approvals := []runtime.Object{
+		&k8sudov1alpha1.SudoRequestApproval{
+			ObjectMeta: metav1.ObjectMeta{Name: "approval"},
+			Spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest: "req",
+				Approver:    "bob",
+				Decision:    k8sudov1alpha1.SudoRequestApprovalDecisionApprove,
+			},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		role           string
+		expectedStatus k8sudov1alpha1.SudoRequestStatusStatus
+	}{
+		{
+			name:           "no approvals required",
+			role:           "view",
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusPending,
+		},
+		{
+			// The fake client doesn't evaluate the SubjectAccessReview,
+			// so the approver is never authorized
+			name:           "unauthorized approver",
+			role:           "cluster-admin",
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "req"},
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User: "user",
+					Role: test.role,
+				},
+				Status: k8sudov1alpha1.SudoRequestStatus{
+					Status: k8sudov1alpha1.SudoRequestStatusPending,
+				},
+			}
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			authv1.AddToScheme(scheme)
+			r := &SudoRequestReconciler{
+				Clock:  FakeClock{},
+				Scheme: scheme,
+				Client: fake.NewFakeClientWithScheme(scheme, approvals...),
+				Policy: store,
+			}
+			if err := r.updateStatusFromApprovals(context.Background(), req, testinglogr.TestLogger{T: t}); err != nil {
+				t.Fatalf("updateStatusFromApprovals returned an error: %v", err)
+			}
+			if got, want := req.Status.Status, test.expectedStatus; got != want {
+				t.Errorf("wrong status: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestSudoRequestForApproval(t *testing.T) {
+	a := approval("bob", k8sudov1alpha1.SudoRequestApprovalDecisionApprove, "")
+	requests := sudoRequestForApproval(handler.MapObject{Meta: &a, Object: &a})
+	expected := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "req"}}}
+	if got, want := requests, expected; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong requests: (got != want) %v != %v", got, want)
+	}
+}
+
+func TestUpdateExtensions(t *testing.T) {
+	grantedAt := time.Now()
+	granted := k8sudov1alpha1.SudoRequestExtensionStatus{
+		Duration: metav1.Duration{Duration: 20 * time.Minute},
+		Status:   k8sudov1alpha1.SudoRequestExtensionStatusGranted,
+	}
+
+	tests := []struct {
+		name               string
+		extensions         []time.Duration
+		statuses           []k8sudov1alpha1.SudoRequestExtensionStatus
+		expectedStatuses   []k8sudov1alpha1.SudoRequestExtensionStatusStatus
+		expectedLastReason string
+		expectedExpires    time.Time
+	}{
+		{
+			name:             "no extensions",
+			expectedStatuses: []k8sudov1alpha1.SudoRequestExtensionStatusStatus{},
+			expectedExpires:  grantedAt.Add(policy.DefaultDuration),
+		},
+		{
+			name:       "over the total",
+			extensions: []time.Duration{time.Hour},
+			expectedStatuses: []k8sudov1alpha1.SudoRequestExtensionStatusStatus{
+				k8sudov1alpha1.SudoRequestExtensionStatusDenied,
+			},
+			expectedLastReason: "Extension would grant 1h10m0s in total, more than the maximum of 1h0m0s",
+			expectedExpires:    grantedAt.Add(policy.DefaultDuration),
+		},
+		{
+			// The fake client doesn't evaluate the SubjectAccessReview,
+			// so it is never allowed
+			name:       "not authorized",
+			extensions: []time.Duration{10 * time.Minute},
+			expectedStatuses: []k8sudov1alpha1.SudoRequestExtensionStatusStatus{
+				k8sudov1alpha1.SudoRequestExtensionStatusDenied,
+			},
+			expectedLastReason: "Failed to authorize: ",
+			expectedExpires:    grantedAt.Add(policy.DefaultDuration),
+		},
+		{
+			name:       "already granted",
+			extensions: []time.Duration{20 * time.Minute},
+			statuses:   []k8sudov1alpha1.SudoRequestExtensionStatus{granted},
+			expectedStatuses: []k8sudov1alpha1.SudoRequestExtensionStatusStatus{
+				k8sudov1alpha1.SudoRequestExtensionStatusGranted,
+			},
+			expectedExpires: grantedAt.Add(policy.DefaultDuration).Add(20 * time.Minute),
+		},
+		{
+			name:       "over the total with granted extensions",
+			extensions: []time.Duration{20 * time.Minute, 40 * time.Minute},
+			statuses:   []k8sudov1alpha1.SudoRequestExtensionStatus{granted},
+			expectedStatuses: []k8sudov1alpha1.SudoRequestExtensionStatusStatus{
+				k8sudov1alpha1.SudoRequestExtensionStatusGranted,
+				k8sudov1alpha1.SudoRequestExtensionStatusDenied,
+			},
+			expectedLastReason: "Extension would grant 1h10m0s in total, more than the maximum of 1h0m0s",
+			expectedExpires:    grantedAt.Add(policy.DefaultDuration).Add(20 * time.Minute),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "req",
+					CreationTimestamp: metav1.Time{Time: grantedAt.Add(-time.Minute)},
+				},
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User: "user",
+					Role: "role",
+				},
+				Status: k8sudov1alpha1.SudoRequestStatus{
+					Status:     k8sudov1alpha1.SudoRequestStatusReady,
+					GrantedAt:  &metav1.Time{Time: grantedAt},
+					Extensions: test.statuses,
+				},
+			}
+			for _, duration := range test.extensions {
+				req.Spec.Extensions = append(req.Spec.Extensions, k8sudov1alpha1.SudoRequestExtension{
+					Duration: metav1.Duration{Duration: duration},
+				})
+			}
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			authv1.AddToScheme(scheme)
+			r := &SudoRequestReconciler{
+				Clock:  FakeClock{CurrentTime: grantedAt},
+				Scheme: scheme,
+				Client: fake.NewFakeClientWithScheme(scheme),
+			}
+			if err := r.updateExtensions(context.Background(), req, testinglogr.TestLogger{T: t}); err != nil {
+				t.Fatalf("updateExtensions returned an error: %v", err)
+			}
+			statuses := []k8sudov1alpha1.SudoRequestExtensionStatusStatus{}
+			for _, extStatus := range req.Status.Extensions {
+				statuses = append(statuses, extStatus.Status)
+			}
+			if got, want := statuses, test.expectedStatuses; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong extension statuses: (got != want) %v != %v", got, want)
+			}
+			if len(req.Status.Extensions) > 0 {
+				if got, want := req.Status.Extensions[len(req.Status.Extensions)-1].Reason, test.expectedLastReason; got != want {
+					t.Errorf("wrong reason: (got != want) %s != %s", got, want)
+				}
+			}
+			if got, want := req.Status.Expires.Time, test.expectedExpires; !got.Equal(want) {
+				t.Errorf("wrong expires: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestExtensionStatusFromApprovals(t *testing.T) {
+	requiredApprovals := 1
+	store := policy.NewStore(&policy.Policy{
+		APIVersion: policy.APIVersion,
+		Kind:       policy.Kind,
+		Roles: []policy.RolePolicy{
+			{
+				Name:         "cluster-admin",
+				RoleSettings: policy.RoleSettings{RequiredApprovals: &requiredApprovals},
+			},
+		},
+	})
+	extension := int32(0)
+	otherExtension := int32(1)
+	approvals := []runtime.Object{
+		&k8sudov1alpha1.SudoRequestApproval{
+			ObjectMeta: metav1.ObjectMeta{Name: "reject-request"},
+			Spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest: "req",
+				Approver:    "bob",
+				Decision:    k8sudov1alpha1.SudoRequestApprovalDecisionReject,
+			},
+		},
+		&k8sudov1alpha1.SudoRequestApproval{
+			ObjectMeta: metav1.ObjectMeta{Name: "reject-other-extension"},
+			Spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest: "req",
+				Approver:    "bob",
+				Decision:    k8sudov1alpha1.SudoRequestApprovalDecisionReject,
+				Extension:   &otherExtension,
+			},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		role           string
+		expectedStatus k8sudov1alpha1.SudoRequestExtensionStatusStatus
+		expectedReason string
+	}{
+		{
+			name:           "no approvals required",
+			role:           "view",
+			expectedStatus: k8sudov1alpha1.SudoRequestExtensionStatusGranted,
+		},
+		{
+			// Only approvals of this extension count, and the fake
+			// client never authorizes the approver
+			name:           "approvals required",
+			role:           "cluster-admin",
+			expectedStatus: k8sudov1alpha1.SudoRequestExtensionStatusAwaitingApproval,
+			expectedReason: "Approved by 0 of 1 required approvers",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "req"},
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User: "user",
+					Role: test.role,
+				},
+			}
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			authv1.AddToScheme(scheme)
+			r := &SudoRequestReconciler{
+				Clock:  FakeClock{},
+				Scheme: scheme,
+				Client: fake.NewFakeClientWithScheme(scheme, approvals...),
+				Policy: store,
+			}
+			extStatus := k8sudov1alpha1.SudoRequestExtensionStatus{}
+			if err := r.extensionStatusFromApprovals(context.Background(), req, extension, &extStatus, testinglogr.TestLogger{T: t}); err != nil {
+				t.Fatalf("extensionStatusFromApprovals returned an error: %v", err)
+			}
+			if got, want := extStatus.Status, test.expectedStatus; got != want {
+				t.Errorf("wrong status: (got != want) %s != %s", got, want)
+			}
+			if got, want := extStatus.Reason, test.expectedReason; got != want {
+				t.Errorf("wrong reason: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusFromSchedule(t *testing.T) {
+	now := time.Now()
+	notBefore := metav1.NewTime(now.Add(time.Hour))
+
+	tests := []struct {
+		name           string
+		status         k8sudov1alpha1.SudoRequestStatusStatus
+		notBefore      *metav1.Time
+		currentTime    time.Time
+		expectedStatus k8sudov1alpha1.SudoRequestStatusStatus
+	}{
+		{
+			name:           "not scheduled",
+			status:         k8sudov1alpha1.SudoRequestStatusPending,
+			currentTime:    now,
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusPending,
+		},
+		{
+			name:           "before start",
+			status:         k8sudov1alpha1.SudoRequestStatusPending,
+			notBefore:      &notBefore,
+			currentTime:    now,
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusScheduled,
+		},
+		{
+			name:           "after start",
+			status:         k8sudov1alpha1.SudoRequestStatusPending,
+			notBefore:      &notBefore,
+			currentTime:    now.Add(2 * time.Hour),
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusPending,
+		},
+		{
+			name:           "awaiting approval",
+			status:         k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+			notBefore:      &notBefore,
+			currentTime:    now,
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusAwaitingApproval,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					NotBefore: test.notBefore,
+				},
+				Status: k8sudov1alpha1.SudoRequestStatus{
+					Status: test.status,
+				},
+			}
+			r := &SudoRequestReconciler{
+				Clock: FakeClock{CurrentTime: test.currentTime},
+			}
+			r.updateStatusFromSchedule(req)
+			if got, want := req.Status.Status, test.expectedStatus; got != want {
+				t.Errorf("wrong status: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusScheduled(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		currentTime    time.Time
+		expectedStatus k8sudov1alpha1.SudoRequestStatusStatus
+		expectedReason string
+	}{
+		{
+			name:           "before start",
+			currentTime:    now,
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusScheduled,
+			expectedReason: "Scheduled",
+		},
+		{
+			// Authorization is checked again at the start, which the
+			// fake client never allows
+			name:           "at start",
+			currentTime:    now.Add(time.Hour),
+			expectedStatus: k8sudov1alpha1.SudoRequestStatusDenied,
+			expectedReason: "Failed to authorize: ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &k8sudov1alpha1.SudoRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "req",
+					CreationTimestamp: metav1.Time{Time: now},
+				},
+				Spec: k8sudov1alpha1.SudoRequestSpec{
+					User:      "user",
+					Role:      "role",
+					NotBefore: &metav1.Time{Time: now.Add(time.Hour)},
+				},
+				Status: k8sudov1alpha1.SudoRequestStatus{
+					Status: k8sudov1alpha1.SudoRequestStatusScheduled,
+					Reason: "Scheduled",
+				},
+			}
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			authv1.AddToScheme(scheme)
+			rbacv1.AddToScheme(scheme)
+			r := &SudoRequestReconciler{
+				Clock:  FakeClock{CurrentTime: test.currentTime},
+				Scheme: scheme,
+				Client: fake.NewFakeClientWithScheme(scheme),
+			}
+			if err := r.updateStatus(context.Background(), req, testinglogr.TestLogger{T: t}); err != nil {
+				t.Fatalf("updateStatus returned an error: %v", err)
+			}
+			if got, want := req.Status.Status, test.expectedStatus; got != want {
+				t.Errorf("wrong status: (got != want) %s != %s", got, want)
+			}
+			if got, want := req.Status.Reason, test.expectedReason; got != want {
+				t.Errorf("wrong reason: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestOnScheduled(t *testing.T) {
+	now := time.Now()
+	req := &k8sudov1alpha1.SudoRequest{
+		Spec: k8sudov1alpha1.SudoRequestSpec{
+			NotBefore: &metav1.Time{Time: now.Add(time.Hour)},
+		},
+	}
+	r := &SudoRequestReconciler{
+		Clock: FakeClock{CurrentTime: now},
+	}
+	res, err := r.OnScheduled(req)
+	if err != nil {
+		t.Fatalf("OnScheduled returned an error: %v", err)
+	}
+	if got, want := res.RequeueAfter, time.Hour; got != want {
+		t.Errorf("wrong RequeueAfter: (got != want) %s != %s", got, want)
+	}
+}
@@ -18,16 +18,24 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/api/admission/v1beta1"
 	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/audit"
+	"jetstack.io/k8sudo/pkg/policy"
 )
 
 // +kubebuilder:webhook:verbs=create;update,path=/validate-k8sudo-jetstack-io-v1alpha1-sudorequest,mutating=false,failurePolicy=fail,groups=k8sudo.jetstack.io,resources=sudorequests,versions=v1alpha1,name=vsudorequest.kb.io
@@ -45,42 +53,317 @@ type SudoReqHandler struct {
 	Client  client.Client
 	Decoder *admission.Decoder
 	Log     logr.Logger
+	// The policy to apply to requests. If nil the built-in defaults
+	// are used.
+	Policy *policy.Store
+	// Records each decision on a request. If nil nothing is recorded.
+	Audit *audit.Logger
 }
 
 func (h *SudoReqHandler) ValidateAccess(spec k8sudov1alpha1.SudoRequestSpec, userInfo authv1.UserInfo, log logr.Logger) admission.Response {
+	if spec.Group != "" {
+		return admission.Denied("Only a SudoSchedule can create a SudoRequest for a group")
+	}
 	if spec.User != userInfo.Username {
 		return admission.Denied(fmt.Sprintf("%s cannot create a SudoRequest for %s", userInfo.Username, spec.User))
 	}
 	return admission.Allowed("")
 }
 
+// ValidateScheduled checks that a request created for a SudoSchedule is
+// exactly the request the schedule would create for one of its windows.
+// The schedule takes the place of the user asking for access, so it must
+// be the schedule the request's owner reference was set from rather than
+// a later one with the same name.
+func (h *SudoReqHandler) ValidateScheduled(ctx context.Context, name string, uid types.UID, spec k8sudov1alpha1.SudoRequestSpec, log logr.Logger) admission.Response {
+	var sched k8sudov1alpha1.SudoSchedule
+	if err := h.Client.Get(ctx, types.NamespacedName{Name: name}, &sched); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Denied(fmt.Sprintf("SudoSchedule %s not found", name))
+		}
+		log.Error(err, "unable to get SudoSchedule")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if sched.UID != uid {
+		return admission.Denied(fmt.Sprintf("SudoRequest is not owned by SudoSchedule %s", name))
+	}
+	parsed, err := parseSchedule(sched.Spec)
+	if err != nil {
+		return admission.Denied(fmt.Sprintf("SudoSchedule %s is invalid: %s", name, err))
+	}
+	if spec.NotBefore == nil || spec.Expires == nil || !parsed.isStart(spec.NotBefore.Time) ||
+		!spec.Expires.Time.Equal(spec.NotBefore.Add(parsed.duration)) {
+		return admission.Denied(fmt.Sprintf("SudoRequest is not for a window of SudoSchedule %s", name))
+	}
+	// The times have been checked, and are compared separately as they
+	// may be in a different location
+	expected := sudoRequestSpecForWindow(sched.Spec, spec.NotBefore.Time, spec.Expires.Time)
+	expected.NotBefore, expected.Expires = spec.NotBefore, spec.Expires
+	if !reflect.DeepEqual(expected, spec) {
+		return admission.Denied(fmt.Sprintf("SudoRequest does not match SudoSchedule %s", name))
+	}
+	return admission.Allowed("")
+}
+
+// ValidatePolicy checks the request against the policy for the
+// requested role
+func ValidatePolicy(spec k8sudov1alpha1.SudoRequestSpec, userInfo authv1.UserInfo, settings policy.Settings, log logr.Logger) admission.Response {
+	if settings.RequireReason && spec.Reason == "" {
+		return admission.Denied(fmt.Sprintf("Reason must be set to request %s", spec.Role))
+	}
+	if !settings.Allows(userInfo.Username, userInfo.Groups) {
+		subject := userInfo.Username
+		if subject == "" && spec.Group != "" {
+			subject = spec.Group
+		}
+		return admission.Denied(fmt.Sprintf("%s is not allowed to request %s", subject, spec.Role))
+	}
+	return admission.Allowed("")
+}
+
+// ValidateDuration checks that the request doesn't ask for access for
+// longer than the policy allows, rather than having it silently cut
+// short
+func ValidateDuration(spec k8sudov1alpha1.SudoRequestSpec, settings policy.Settings, now time.Time, log logr.Logger) admission.Response {
+	if spec.Duration != nil && spec.Duration.Duration > settings.MaxDuration {
+		return admission.Denied(fmt.Sprintf("Duration %s is longer than the maximum of %s for %s", spec.Duration.Duration, settings.MaxDuration, spec.Role))
+	}
+	start := now
+	if spec.NotBefore != nil && spec.NotBefore.After(now) {
+		start = spec.NotBefore.Time
+	}
+	if spec.Duration == nil && spec.Expires != nil && spec.Expires.Sub(start) > settings.MaxDuration {
+		return admission.Denied(fmt.Sprintf("Expires is more than the maximum of %s from the start for %s", settings.MaxDuration, spec.Role))
+	}
+	return admission.Allowed("")
+}
+
+// ValidateRevocation checks that the user revoking a request is either
+// the user that it grants access to, or is authorized to revoke it
+func (h *SudoReqHandler) ValidateRevocation(ctx context.Context, name string, old, spec k8sudov1alpha1.SudoRequestSpec, userInfo authv1.UserInfo, log logr.Logger) admission.Response {
+	if old.Revoked != nil {
+		return admission.Denied("A revoked SudoRequest cannot be changed")
+	}
+	if spec.Revoked.User != userInfo.Username {
+		return admission.Denied(fmt.Sprintf("%s cannot revoke a SudoRequest as %s", userInfo.Username, spec.Revoked.User))
+	}
+	if spec.User == userInfo.Username {
+		return admission.Allowed("")
+	}
+	sar := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   userInfo.Username,
+			Groups: userInfo.Groups,
+			UID:    userInfo.UID,
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Verb:     "revoke",
+				Group:    k8sudov1alpha1.GroupVersion.Group,
+				Version:  k8sudov1alpha1.GroupVersion.Version,
+				Resource: k8sudov1alpha1.SudoRequestResourcePath,
+				Name:     name,
+			},
+		},
+	}
+	if err := h.Client.Create(ctx, sar); err != nil {
+		log.Error(err, "unable to create SubjectAccessReview")
+	}
+	if !sar.Status.Allowed || sar.Status.Denied {
+		return admission.Denied(fmt.Sprintf("%s is not allowed to revoke %s", userInfo.Username, name))
+	}
+	return admission.Allowed("")
+}
+
+// ValidateExtensions checks that extensions are only added to the end of
+// the list, and only once the request has been granted
+func ValidateExtensions(old *k8sudov1alpha1.SudoRequest, spec k8sudov1alpha1.SudoRequestSpec, log logr.Logger) admission.Response {
+	var oldExtensions []k8sudov1alpha1.SudoRequestExtension
+	if old != nil {
+		oldExtensions = old.Spec.Extensions
+	}
+	if len(spec.Extensions) < len(oldExtensions) {
+		return admission.Denied("Extensions can only be added")
+	}
+	for i := range oldExtensions {
+		if !reflect.DeepEqual(oldExtensions[i], spec.Extensions[i]) {
+			return admission.Denied("Extensions can only be added")
+		}
+	}
+	if len(spec.Extensions) == len(oldExtensions) {
+		return admission.Allowed("")
+	}
+	if old == nil || old.Status.Status != k8sudov1alpha1.SudoRequestStatusReady {
+		return admission.Denied("Extensions can only be added once the SudoRequest is Ready")
+	}
+	for _, extension := range spec.Extensions[len(oldExtensions):] {
+		if extension.Duration.Duration <= 0 {
+			return admission.Denied("Extension duration must be positive")
+		}
+	}
+	return admission.Allowed("")
+}
+
+// ValidateImmutable checks that an update doesn't change the spec other
+// than by adding extensions, so that the role, subject and namespaces
+// that were authorized can't be changed afterwards. Revocations are
+// checked separately.
+func ValidateImmutable(old, spec k8sudov1alpha1.SudoRequestSpec) admission.Response {
+	old.Extensions, spec.Extensions = nil, nil
+	if !reflect.DeepEqual(old, spec) {
+		return admission.Denied("A SudoRequest cannot be changed other than by revoking it or adding extensions")
+	}
+	return admission.Allowed("")
+}
+
+// isRevocation returns whether an update revokes the request. Any other
+// change to the spec is rejected alongside a revocation.
+func isRevocation(old, spec k8sudov1alpha1.SudoRequestSpec) (bool, admission.Response) {
+	if reflect.DeepEqual(old.Revoked, spec.Revoked) {
+		return false, admission.Allowed("")
+	}
+	old.Revoked, spec.Revoked = nil, nil
+	if !reflect.DeepEqual(old, spec) {
+		return true, admission.Denied("A SudoRequest cannot be changed while revoking it")
+	}
+	return true, admission.Allowed("")
+}
+
 func Validate(spec k8sudov1alpha1.SudoRequestSpec, log logr.Logger) admission.Response {
-	if spec.User == "" {
+	if spec.User == "" && spec.Group == "" {
 		return admission.Denied("User must be set")
 	}
+	if spec.User != "" && spec.Group != "" {
+		return admission.Denied("Only one of User and Group can be set")
+	}
 	if spec.Role == "" {
 		return admission.Denied("Role must be set")
 	}
+	if spec.Duration != nil && spec.Duration.Duration <= 0 {
+		return admission.Denied("Duration must be positive")
+	}
+	if spec.NotBefore != nil && spec.Expires != nil && !spec.NotBefore.Before(spec.Expires) {
+		return admission.Denied("NotBefore must be before Expires")
+	}
+	targets := 0
+	if spec.Namespace != "" {
+		targets++
+	}
+	if len(spec.Namespaces) > 0 {
+		targets++
+	}
+	if spec.NamespaceSelector != nil {
+		targets++
+		if _, err := metav1.LabelSelectorAsSelector(spec.NamespaceSelector); err != nil {
+			return admission.Denied(fmt.Sprintf("NamespaceSelector is invalid: %s", err))
+		}
+	}
+	if targets > 1 {
+		return admission.Denied("Only one of Namespace, Namespaces and NamespaceSelector can be set")
+	}
+	switch spec.RoleKind {
+	case "", k8sudov1alpha1.RoleKindClusterRole:
+	case k8sudov1alpha1.RoleKindRole:
+		if spec.Namespace == "" && targets > 0 {
+			return admission.Denied("A Role can only be granted in a single namespace")
+		}
+		if spec.Namespace == "" {
+			return admission.Denied("Namespace must be set for a Role")
+		}
+	default:
+		return admission.Denied(fmt.Sprintf("RoleKind must be %s or %s", k8sudov1alpha1.RoleKindClusterRole, k8sudov1alpha1.RoleKindRole))
+	}
 	return admission.Allowed("")
 }
 
+// Webhook denial reasons, naming the check that denied the request
+const (
+	denialReasonRevokedOnCreate = "revoked_on_create"
+	denialReasonRevocation      = "revocation"
+	denialReasonImmutable       = "immutable"
+	denialReasonInvalid         = "invalid"
+	denialReasonScheduled       = "scheduled"
+	denialReasonAccess          = "access"
+	denialReasonExtensions      = "extensions"
+	denialReasonPolicy          = "policy"
+	denialReasonDuration        = "duration"
+)
+
 func (h *SudoReqHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
 	sudoReq := &k8sudov1alpha1.SudoRequest{}
 	err := h.Decoder.Decode(req, sudoReq)
 	if err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	resp, reason := h.validate(ctx, req, sudoReq)
+	if !resp.Allowed && resp.Result != nil && resp.Result.Code == http.StatusForbidden {
+		webhookDenials.WithLabelValues(reason).Inc()
+	}
+	h.auditAdmission(sudoReq, req, resp)
+	return resp
+}
+
+// validate runs the checks on the request, returning the response and
+// the reason for a denial
+func (h *SudoReqHandler) validate(ctx context.Context, req admission.Request, sudoReq *k8sudov1alpha1.SudoRequest) (admission.Response, string) {
 	log := h.Log.WithValues("sudorequest", sudoReq.GetObjectMeta().GetName())
 	log.Info("Validating SudoRequest")
+	var old *k8sudov1alpha1.SudoRequest
+	if req.AdmissionRequest.Operation == v1beta1.Create && sudoReq.Spec.Revoked != nil {
+		return admission.Denied("Revoked cannot be set when creating a SudoRequest"), denialReasonRevokedOnCreate
+	}
+	if req.AdmissionRequest.Operation == v1beta1.Update {
+		old = &k8sudov1alpha1.SudoRequest{}
+		if err := h.Decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err), ""
+		}
+		if revoking, resp := isRevocation(old.Spec, sudoReq.Spec); revoking {
+			if !resp.Allowed {
+				return resp, denialReasonRevocation
+			}
+			return h.ValidateRevocation(ctx, sudoReq.Name, old.Spec, sudoReq.Spec, req.UserInfo, log), denialReasonRevocation
+		}
+		// Changes that don't touch the spec, such as the controller
+		// adding or removing its finalizer, don't need to be validated
+		if reflect.DeepEqual(old.Spec, sudoReq.Spec) {
+			return admission.Allowed(""), ""
+		}
+		if resp := ValidateImmutable(old.Spec, sudoReq.Spec); !resp.Allowed {
+			return resp, denialReasonImmutable
+		}
+	}
 	if req.AdmissionRequest.Operation == v1beta1.Create ||
 		req.AdmissionRequest.Operation == v1beta1.Update {
 		resp := Validate(sudoReq.Spec, log)
 		if !resp.Allowed {
-			return resp
+			return resp, denialReasonInvalid
+		}
+		// A request created for a SudoSchedule is checked against the
+		// schedule, and the policy against the user or group it grants
+		// access to, rather than against whoever created it
+		userInfo := req.UserInfo
+		reason := denialReasonAccess
+		if sched := scheduleOf(sudoReq); sched != "" {
+			owner := metav1.GetControllerOf(sudoReq)
+			resp = h.ValidateScheduled(ctx, sched, owner.UID, sudoReq.Spec, log)
+			userInfo = authv1.UserInfo{Username: sudoReq.Spec.User, Groups: subjectGroups(sudoReq)}
+			reason = denialReasonScheduled
+		} else {
+			resp = h.ValidateAccess(sudoReq.Spec, req.UserInfo, log)
+		}
+		if !resp.Allowed {
+			return resp, reason
 		}
-		return h.ValidateAccess(sudoReq.Spec, req.UserInfo, log)
+		resp = ValidateExtensions(old, sudoReq.Spec, log)
+		if !resp.Allowed {
+			return resp, denialReasonExtensions
+		}
+		settings := h.Policy.ForRole(sudoReq.Spec.Role)
+		resp = ValidatePolicy(sudoReq.Spec, userInfo, settings, log)
+		if !resp.Allowed {
+			return resp, denialReasonPolicy
+		}
+		return ValidateDuration(sudoReq.Spec, settings, time.Now(), log), denialReasonDuration
 	}
-	return admission.Allowed("")
+	return admission.Allowed(""), ""
 }
 
 func (h *SudoReqHandler) InjectDecoder(d *admission.Decoder) error {
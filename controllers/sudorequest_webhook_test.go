@@ -20,15 +20,21 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	testinglogr "github.com/go-logr/logr/testing"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/policy"
 )
 
 func TestValidate(t *testing.T) {
@@ -51,6 +57,34 @@ func TestValidate(t *testing.T) {
 			},
 			expected: admission.Denied("Role must be set"),
 		},
+		{
+			name: "user and group",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:  "user",
+				Group: "group",
+				Role:  "role",
+			},
+			expected: admission.Denied("Only one of User and Group can be set"),
+		},
+		{
+			name: "not before after expires",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:      "user",
+				Role:      "role",
+				Expires:   &metav1.Time{Time: time.Date(2020, 8, 1, 10, 0, 0, 0, time.UTC)},
+				NotBefore: &metav1.Time{Time: time.Date(2020, 8, 1, 11, 0, 0, 0, time.UTC)},
+			},
+			expected: admission.Denied("NotBefore must be before Expires"),
+		},
+		{
+			name: "negative duration",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:     "user",
+				Role:     "role",
+				Duration: &metav1.Duration{Duration: -time.Minute},
+			},
+			expected: admission.Denied("Duration must be positive"),
+		},
 		{
 			name: "valid",
 			spec: k8sudov1alpha1.SudoRequestSpec{
@@ -59,6 +93,74 @@ func TestValidate(t *testing.T) {
 			},
 			expected: admission.Allowed(""),
 		},
+		{
+			name: "role without namespace",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:     "user",
+				Role:     "role",
+				RoleKind: "Role",
+			},
+			expected: admission.Denied("Namespace must be set for a Role"),
+		},
+		{
+			name: "unknown role kind",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:      "user",
+				Role:      "role",
+				RoleKind:  "Group",
+				Namespace: "ns",
+			},
+			expected: admission.Denied("RoleKind must be ClusterRole or Role"),
+		},
+		{
+			name: "namespace and namespaces",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:       "user",
+				Role:       "role",
+				Namespace:  "ns",
+				Namespaces: []string{"ns"},
+			},
+			expected: admission.Denied("Only one of Namespace, Namespaces and NamespaceSelector can be set"),
+		},
+		{
+			name: "namespaces and namespace selector",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:              "user",
+				Role:              "role",
+				Namespaces:        []string{"ns"},
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+			},
+			expected: admission.Denied("Only one of Namespace, Namespaces and NamespaceSelector can be set"),
+		},
+		{
+			name: "invalid namespace selector",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:              "user",
+				Role:              "role",
+				NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Near"}}},
+			},
+			expected: admission.Denied("NamespaceSelector is invalid: \"Near\" is not a valid pod selector operator"),
+		},
+		{
+			name: "role in namespaces",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:       "user",
+				Role:       "role",
+				RoleKind:   "Role",
+				Namespaces: []string{"ns"},
+			},
+			expected: admission.Denied("A Role can only be granted in a single namespace"),
+		},
+		{
+			name: "valid role in namespace",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				User:      "user",
+				Role:      "role",
+				RoleKind:  "Role",
+				Namespace: "ns",
+			},
+			expected: admission.Allowed(""),
+		},
 	}
 
 	for _, test := range tests {
@@ -97,6 +199,14 @@ func TestValidateAccess(t *testing.T) {
 			username: user1,
 			expected: admission.Denied(fmt.Sprintf("%s cannot create a SudoRequest for %s", user1, user2)),
 		},
+		{
+			name: "group",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				Group: "group",
+			},
+			username: user1,
+			expected: admission.Denied("Only a SudoSchedule can create a SudoRequest for a group"),
+		},
 	}
 
 	for _, test := range tests {
@@ -113,10 +223,357 @@ func TestValidateAccess(t *testing.T) {
 	}
 }
 
+func TestValidateScheduled(t *testing.T) {
+	sched := &k8sudov1alpha1.SudoSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "maintenance", UID: "maintenance-uid"},
+		Spec: k8sudov1alpha1.SudoScheduleSpec{
+			Group:    "sre",
+			Role:     "role",
+			Days:     []string{"Tuesday"},
+			Start:    "02:00",
+			Duration: metav1.Duration{Duration: 2 * time.Hour},
+			TimeZone: "Europe/London",
+		},
+	}
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("error loading time zone: %v", err)
+	}
+	// A Tuesday in British Summer Time
+	start := time.Date(2020, time.June, 2, 2, 0, 0, 0, london).UTC()
+	end := start.Add(2 * time.Hour)
+	tests := []struct {
+		name     string
+		schedule string
+		uid      types.UID
+		spec     k8sudov1alpha1.SudoRequestSpec
+		expected admission.Response
+	}{
+		{
+			name:     "window",
+			schedule: "maintenance",
+			uid:      "maintenance-uid",
+			spec:     sudoRequestSpecForWindow(sched.Spec, start, end),
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "schedule not found",
+			schedule: "other",
+			uid:      "maintenance-uid",
+			spec:     sudoRequestSpecForWindow(sched.Spec, start, end),
+			expected: admission.Denied("SudoSchedule other not found"),
+		},
+		{
+			name:     "schedule recreated",
+			schedule: "maintenance",
+			uid:      "old-maintenance-uid",
+			spec:     sudoRequestSpecForWindow(sched.Spec, start, end),
+			expected: admission.Denied("SudoRequest is not owned by SudoSchedule maintenance"),
+		},
+		{
+			name:     "wrong day",
+			schedule: "maintenance",
+			uid:      "maintenance-uid",
+			spec:     sudoRequestSpecForWindow(sched.Spec, start.AddDate(0, 0, 1), end.AddDate(0, 0, 1)),
+			expected: admission.Denied("SudoRequest is not for a window of SudoSchedule maintenance"),
+		},
+		{
+			name:     "wrong time zone",
+			schedule: "maintenance",
+			uid:      "maintenance-uid",
+			spec:     sudoRequestSpecForWindow(sched.Spec, start.Add(time.Hour), end.Add(time.Hour)),
+			expected: admission.Denied("SudoRequest is not for a window of SudoSchedule maintenance"),
+		},
+		{
+			name:     "too long",
+			schedule: "maintenance",
+			uid:      "maintenance-uid",
+			spec:     sudoRequestSpecForWindow(sched.Spec, start, end.Add(time.Hour)),
+			expected: admission.Denied("SudoRequest is not for a window of SudoSchedule maintenance"),
+		},
+		{
+			name:     "different role",
+			schedule: "maintenance",
+			uid:      "maintenance-uid",
+			spec: func() k8sudov1alpha1.SudoRequestSpec {
+				spec := sudoRequestSpecForWindow(sched.Spec, start, end)
+				spec.Role = "cluster-admin"
+				return spec
+			}(),
+			expected: admission.Denied("SudoRequest does not match SudoSchedule maintenance"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			log := testinglogr.TestLogger{T: t}
+			h := &SudoReqHandler{
+				Client: fake.NewFakeClientWithScheme(scheme, sched),
+				Log:    log,
+			}
+			resp := h.ValidateScheduled(context.Background(), test.schedule, test.uid, test.spec, log)
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     k8sudov1alpha1.SudoRequestSpec
+		userInfo authv1.UserInfo
+		settings policy.Settings
+		expected admission.Response
+	}{
+		{
+			name:     "no policy",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+			userInfo: authv1.UserInfo{Username: "user"},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "reason required",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+			userInfo: authv1.UserInfo{Username: "user"},
+			settings: policy.Settings{RequireReason: true},
+			expected: admission.Denied("Reason must be set to request role"),
+		},
+		{
+			name:     "reason given",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role", Reason: "incident"},
+			userInfo: authv1.UserInfo{Username: "user"},
+			settings: policy.Settings{RequireReason: true},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "subject not allowed",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+			userInfo: authv1.UserInfo{Username: "user", Groups: []string{"devs"}},
+			settings: policy.Settings{AllowedSubjects: []policy.Subject{{Kind: "Group", Name: "sre"}}},
+			expected: admission.Denied("user is not allowed to request role"),
+		},
+		{
+			name:     "subject allowed by group",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "role"},
+			userInfo: authv1.UserInfo{Username: "user", Groups: []string{"sre"}},
+			settings: policy.Settings{AllowedSubjects: []policy.Subject{{Kind: "Group", Name: "sre"}}},
+			expected: admission.Allowed(""),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := testinglogr.TestLogger{T: t}
+			resp := ValidatePolicy(test.spec, test.userInfo, test.settings, log)
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateDuration(t *testing.T) {
+	now := time.Now()
+	settings := policy.Settings{DefaultDuration: policy.DefaultDuration, MaxDuration: time.Hour}
+
+	tests := []struct {
+		name     string
+		spec     k8sudov1alpha1.SudoRequestSpec
+		expected admission.Response
+	}{
+		{
+			name:     "default",
+			spec:     k8sudov1alpha1.SudoRequestSpec{Role: "role"},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "duration within max",
+			spec:     k8sudov1alpha1.SudoRequestSpec{Role: "role", Duration: &metav1.Duration{Duration: 30 * time.Minute}},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "duration over max",
+			spec:     k8sudov1alpha1.SudoRequestSpec{Role: "role", Duration: &metav1.Duration{Duration: 2 * time.Hour}},
+			expected: admission.Denied("Duration 2h0m0s is longer than the maximum of 1h0m0s for role"),
+		},
+		{
+			name:     "expires within max",
+			spec:     k8sudov1alpha1.SudoRequestSpec{Role: "role", Expires: &metav1.Time{Time: now.Add(time.Hour)}},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "expires over max",
+			spec:     k8sudov1alpha1.SudoRequestSpec{Role: "role", Expires: &metav1.Time{Time: now.Add(2 * time.Hour)}},
+			expected: admission.Denied("Expires is more than the maximum of 1h0m0s from the start for role"),
+		},
+		{
+			name: "expires within max of start",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				Role:      "role",
+				NotBefore: &metav1.Time{Time: now.Add(3 * time.Hour)},
+				Expires:   &metav1.Time{Time: now.Add(4 * time.Hour)},
+			},
+			expected: admission.Allowed(""),
+		},
+		{
+			name: "expires bounded by duration",
+			spec: k8sudov1alpha1.SudoRequestSpec{
+				Role:     "role",
+				Expires:  &metav1.Time{Time: now.Add(2 * time.Hour)},
+				Duration: &metav1.Duration{Duration: 30 * time.Minute},
+			},
+			expected: admission.Allowed(""),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := ValidateDuration(test.spec, settings, now, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateRevocation(t *testing.T) {
+	revocation := &k8sudov1alpha1.SudoRequestRevocation{User: "admin"}
+	tests := []struct {
+		name     string
+		old      k8sudov1alpha1.SudoRequestSpec
+		spec     k8sudov1alpha1.SudoRequestSpec
+		username string
+		expected admission.Response
+	}{
+		{
+			name:     "owner",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Revoked: &k8sudov1alpha1.SudoRequestRevocation{User: "user"}},
+			username: "user",
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "revoking as another user",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Revoked: &k8sudov1alpha1.SudoRequestRevocation{User: "user"}},
+			username: "admin",
+			expected: admission.Denied("admin cannot revoke a SudoRequest as user"),
+		},
+		{
+			// The fake client doesn't evaluate the SubjectAccessReview,
+			// so it is never allowed
+			name:     "not authorized",
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Revoked: revocation},
+			username: "admin",
+			expected: admission.Denied("admin is not allowed to revoke req"),
+		},
+		{
+			name:     "already revoked",
+			old:      k8sudov1alpha1.SudoRequestSpec{User: "user", Revoked: &k8sudov1alpha1.SudoRequestRevocation{User: "user"}},
+			spec:     k8sudov1alpha1.SudoRequestSpec{User: "user", Revoked: revocation},
+			username: "admin",
+			expected: admission.Denied("A revoked SudoRequest cannot be changed"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			authzv1.AddToScheme(scheme)
+			log := testinglogr.TestLogger{T: t}
+			h := &SudoReqHandler{
+				Client: fake.NewFakeClientWithScheme(scheme),
+				Log:    log,
+			}
+			resp := h.ValidateRevocation(context.Background(), "req", test.old, test.spec, authv1.UserInfo{Username: test.username}, log)
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateExtensions(t *testing.T) {
+	extension := k8sudov1alpha1.SudoRequestExtension{Duration: metav1.Duration{Duration: 10 * time.Minute}}
+	ready := k8sudov1alpha1.SudoRequestStatus{Status: k8sudov1alpha1.SudoRequestStatusReady}
+
+	tests := []struct {
+		name     string
+		old      *k8sudov1alpha1.SudoRequest
+		spec     k8sudov1alpha1.SudoRequestSpec
+		expected admission.Response
+	}{
+		{
+			name:     "create without extensions",
+			spec:     k8sudov1alpha1.SudoRequestSpec{},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "create with extensions",
+			spec:     k8sudov1alpha1.SudoRequestSpec{Extensions: []k8sudov1alpha1.SudoRequestExtension{extension}},
+			expected: admission.Denied("Extensions can only be added once the SudoRequest is Ready"),
+		},
+		{
+			name:     "added to ready",
+			old:      &k8sudov1alpha1.SudoRequest{Status: ready},
+			spec:     k8sudov1alpha1.SudoRequestSpec{Extensions: []k8sudov1alpha1.SudoRequestExtension{extension}},
+			expected: admission.Allowed(""),
+		},
+		{
+			name: "added to pending",
+			old: &k8sudov1alpha1.SudoRequest{
+				Status: k8sudov1alpha1.SudoRequestStatus{Status: k8sudov1alpha1.SudoRequestStatusPending},
+			},
+			spec:     k8sudov1alpha1.SudoRequestSpec{Extensions: []k8sudov1alpha1.SudoRequestExtension{extension}},
+			expected: admission.Denied("Extensions can only be added once the SudoRequest is Ready"),
+		},
+		{
+			name: "removed",
+			old: &k8sudov1alpha1.SudoRequest{
+				Spec:   k8sudov1alpha1.SudoRequestSpec{Extensions: []k8sudov1alpha1.SudoRequestExtension{extension}},
+				Status: ready,
+			},
+			spec:     k8sudov1alpha1.SudoRequestSpec{},
+			expected: admission.Denied("Extensions can only be added"),
+		},
+		{
+			name: "changed",
+			old: &k8sudov1alpha1.SudoRequest{
+				Spec:   k8sudov1alpha1.SudoRequestSpec{Extensions: []k8sudov1alpha1.SudoRequestExtension{extension}},
+				Status: ready,
+			},
+			spec: k8sudov1alpha1.SudoRequestSpec{Extensions: []k8sudov1alpha1.SudoRequestExtension{
+				{Duration: metav1.Duration{Duration: time.Hour}},
+			}},
+			expected: admission.Denied("Extensions can only be added"),
+		},
+		{
+			name: "negative",
+			old:  &k8sudov1alpha1.SudoRequest{Status: ready},
+			spec: k8sudov1alpha1.SudoRequestSpec{Extensions: []k8sudov1alpha1.SudoRequestExtension{
+				{Duration: metav1.Duration{Duration: -time.Minute}},
+			}},
+			expected: admission.Denied("Extension duration must be positive"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := ValidateExtensions(test.old, test.spec, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
 func TestHandle(t *testing.T) {
 	tests := []struct {
 		name      string
 		req       string
+		old       string
 		username  string
 		operation admissionv1beta1.Operation
 		expected  admission.Response
@@ -142,6 +599,68 @@ func TestHandle(t *testing.T) {
 			req:       "{\"spec\": {\"user\": \"user2\", \"role\": \"role\"}}",
 			expected:  admission.Denied("user1 cannot create a SudoRequest for user2"),
 		},
+		{
+			name:      "duration over max",
+			operation: admissionv1beta1.Create,
+			username:  "user",
+			req:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\", \"duration\": \"2h\"}}",
+			expected:  admission.Denied("Duration 2h0m0s is longer than the maximum of 1h0m0s for role"),
+		},
+		{
+			name:      "revoked on create",
+			operation: admissionv1beta1.Create,
+			username:  "user",
+			req:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\", \"revoked\": {\"user\": \"user\"}}}",
+			expected:  admission.Denied("Revoked cannot be set when creating a SudoRequest"),
+		},
+		{
+			name:      "revoked by owner",
+			operation: admissionv1beta1.Update,
+			username:  "user",
+			old:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\"}}",
+			req:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\", \"revoked\": {\"user\": \"user\"}}}",
+			expected:  admission.Allowed(""),
+		},
+		{
+			name:      "revoked with other changes",
+			operation: admissionv1beta1.Update,
+			username:  "user",
+			old:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\"}}",
+			req:       "{\"spec\": {\"user\": \"user\", \"role\": \"admin\", \"revoked\": {\"user\": \"user\"}}}",
+			expected:  admission.Denied("A SudoRequest cannot be changed while revoking it"),
+		},
+		{
+			name:      "finalizer added by the controller",
+			operation: admissionv1beta1.Update,
+			username:  "system:serviceaccount:k8sudo-system:default",
+			old:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\"}}",
+			req:       "{\"metadata\": {\"finalizers\": [\"k8sudo.jetstack.io/revoke-access\"]}, \"spec\": {\"user\": \"user\", \"role\": \"role\"}}",
+			expected:  admission.Allowed(""),
+		},
+		{
+			name:      "role changed",
+			operation: admissionv1beta1.Update,
+			username:  "user",
+			old:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\"}}",
+			req:       "{\"spec\": {\"user\": \"user\", \"role\": \"cluster-admin\"}}",
+			expected:  admission.Denied("A SudoRequest cannot be changed other than by revoking it or adding extensions"),
+		},
+		{
+			name:      "user changed",
+			operation: admissionv1beta1.Update,
+			username:  "user",
+			old:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\"}}",
+			req:       "{\"spec\": {\"user\": \"user2\", \"role\": \"role\"}}",
+			expected:  admission.Denied("A SudoRequest cannot be changed other than by revoking it or adding extensions"),
+		},
+		{
+			name:      "namespace changed",
+			operation: admissionv1beta1.Update,
+			username:  "user",
+			old:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\", \"namespace\": \"dev\"}}",
+			req:       "{\"spec\": {\"user\": \"user\", \"role\": \"role\", \"namespace\": \"kube-system\"}}",
+			expected:  admission.Denied("A SudoRequest cannot be changed other than by revoking it or adding extensions"),
+		},
 		{
 			name:     "malformed",
 			req:      "",
@@ -172,6 +691,9 @@ func TestHandle(t *testing.T) {
 				Object: runtime.RawExtension{
 					Raw: []byte(test.req),
 				},
+				OldObject: runtime.RawExtension{
+					Raw: []byte(test.old),
+				},
 				UserInfo: authv1.UserInfo{
 					Username: test.username,
 				},
@@ -0,0 +1,158 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"k8s.io/api/admission/v1beta1"
+	authv1 "k8s.io/api/authentication/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-k8sudo-jetstack-io-v1alpha1-sudorequestapproval,mutating=false,failurePolicy=fail,groups=k8sudo.jetstack.io,resources=sudorequestapprovals,versions=v1alpha1,name=vsudorequestapproval.kb.io
+
+const (
+	SudoRequestApprovalValidateWebhookPath = "/validate-k8sudo-jetstack-io-v1alpha1-sudorequestapproval"
+)
+
+func (h *SudoReqApprovalHandler) SetupWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(SudoRequestApprovalValidateWebhookPath, &webhook.Admission{Handler: h})
+	return nil
+}
+
+// SudoReqApprovalHandler validates SudoRequestApprovals. It ensures that
+// the approver and groups recorded are those of the user making the
+// approval, as the controller trusts them when checking whether the
+// approver is authorized.
+type SudoReqApprovalHandler struct {
+	Client  client.Client
+	Decoder *admission.Decoder
+	Log     logr.Logger
+}
+
+func ValidateApproval(spec k8sudov1alpha1.SudoRequestApprovalSpec, log logr.Logger) admission.Response {
+	if spec.SudoRequest == "" {
+		return admission.Denied("SudoRequest must be set")
+	}
+	if spec.SudoRequestUID == "" {
+		return admission.Denied("SudoRequestUID must be set")
+	}
+	if spec.Approver == "" {
+		return admission.Denied("Approver must be set")
+	}
+	switch spec.Decision {
+	case k8sudov1alpha1.SudoRequestApprovalDecisionApprove, k8sudov1alpha1.SudoRequestApprovalDecisionReject:
+	default:
+		return admission.Denied(fmt.Sprintf("Decision must be %s or %s", k8sudov1alpha1.SudoRequestApprovalDecisionApprove, k8sudov1alpha1.SudoRequestApprovalDecisionReject))
+	}
+	if spec.Extension != nil && *spec.Extension < 0 {
+		return admission.Denied("Extension must not be negative")
+	}
+	return admission.Allowed("")
+}
+
+func ValidateApprover(spec k8sudov1alpha1.SudoRequestApprovalSpec, userInfo authv1.UserInfo, log logr.Logger) admission.Response {
+	if spec.Approver != userInfo.Username {
+		return admission.Denied(fmt.Sprintf("%s cannot create a SudoRequestApproval for %s", userInfo.Username, spec.Approver))
+	}
+	if len(spec.Groups) > 0 || len(userInfo.Groups) > 0 {
+		if !reflect.DeepEqual(spec.Groups, userInfo.Groups) {
+			return admission.Denied("Groups must match the groups of the approver")
+		}
+	}
+	return admission.Allowed("")
+}
+
+// ValidateRequester checks that the approval is for the request with the
+// UID given, and that the approver isn't approving their own request,
+// a request for a group they belong to, or a request created by
+// a SudoSchedule they created
+func (h *SudoReqApprovalHandler) ValidateRequester(ctx context.Context, spec k8sudov1alpha1.SudoRequestApprovalSpec, log logr.Logger) admission.Response {
+	var sudoReq k8sudov1alpha1.SudoRequest
+	if err := h.Client.Get(ctx, types.NamespacedName{Name: spec.SudoRequest}, &sudoReq); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Denied(fmt.Sprintf("SudoRequest %s not found", spec.SudoRequest))
+		}
+		log.Error(err, "unable to get SudoRequest")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if spec.SudoRequestUID != sudoReq.UID {
+		return admission.Denied(fmt.Sprintf("SudoRequestUID does not match SudoRequest %s", spec.SudoRequest))
+	}
+	requester, err := scheduleRequester(ctx, h.Client, &sudoReq)
+	if err != nil {
+		log.Error(err, "unable to get SudoSchedule")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !isOwnApproval(&sudoReq, requester, spec) {
+		return admission.Allowed("")
+	}
+	switch {
+	case requester != "" && spec.Approver == requester:
+		return admission.Denied(fmt.Sprintf("%s cannot approve a SudoRequest created by their SudoSchedule %s", spec.Approver, scheduleOf(&sudoReq)))
+	case subjectKind(&sudoReq) == rbacv1.GroupKind:
+		return admission.Denied(fmt.Sprintf("%s cannot approve a SudoRequest for their group %s", spec.Approver, subjectName(&sudoReq)))
+	}
+	return admission.Denied(fmt.Sprintf("%s cannot approve their own SudoRequest", spec.Approver))
+}
+
+func (h *SudoReqApprovalHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	approval := &k8sudov1alpha1.SudoRequestApproval{}
+	err := h.Decoder.Decode(req, approval)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	log := h.Log.WithValues("sudorequestapproval", approval.GetObjectMeta().GetName())
+	log.Info("Validating SudoRequestApproval")
+	switch req.AdmissionRequest.Operation {
+	case v1beta1.Create:
+		resp := ValidateApproval(approval.Spec, log)
+		if !resp.Allowed {
+			return resp
+		}
+		resp = ValidateApprover(approval.Spec, req.UserInfo, log)
+		if !resp.Allowed {
+			return resp
+		}
+		return h.ValidateRequester(ctx, approval.Spec, log)
+	case v1beta1.Update:
+		old := &k8sudov1alpha1.SudoRequestApproval{}
+		if err := h.Decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !reflect.DeepEqual(old.Spec, approval.Spec) {
+			return admission.Denied("A SudoRequestApproval cannot be changed")
+		}
+	}
+	return admission.Allowed("")
+}
+
+func (h *SudoReqApprovalHandler) InjectDecoder(d *admission.Decoder) error {
+	h.Decoder = d
+	return nil
+}
@@ -0,0 +1,268 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+func TestValidateApproval(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     k8sudov1alpha1.SudoRequestApprovalSpec
+		expected admission.Response
+	}{
+		{
+			name: "valid",
+			spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest:    "req",
+				SudoRequestUID: "req-uid",
+				Approver:       "bob",
+				Decision:       k8sudov1alpha1.SudoRequestApprovalDecisionApprove,
+			},
+			expected: admission.Allowed(""),
+		},
+		{
+			name: "no request",
+			spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				Approver: "bob",
+				Decision: k8sudov1alpha1.SudoRequestApprovalDecisionApprove,
+			},
+			expected: admission.Denied("SudoRequest must be set"),
+		},
+		{
+			name: "no request UID",
+			spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest: "req",
+				Approver:    "bob",
+				Decision:    k8sudov1alpha1.SudoRequestApprovalDecisionApprove,
+			},
+			expected: admission.Denied("SudoRequestUID must be set"),
+		},
+		{
+			name: "no approver",
+			spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest:    "req",
+				SudoRequestUID: "req-uid",
+				Decision:       k8sudov1alpha1.SudoRequestApprovalDecisionReject,
+			},
+			expected: admission.Denied("Approver must be set"),
+		},
+		{
+			name: "unknown decision",
+			spec: k8sudov1alpha1.SudoRequestApprovalSpec{
+				SudoRequest:    "req",
+				SudoRequestUID: "req-uid",
+				Approver:       "bob",
+				Decision:       "Maybe",
+			},
+			expected: admission.Denied("Decision must be Approve or Reject"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := ValidateApproval(test.spec, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateApprover(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     k8sudov1alpha1.SudoRequestApprovalSpec
+		userInfo authv1.UserInfo
+		expected admission.Response
+	}{
+		{
+			name:     "same user",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{Approver: "bob", Groups: []string{"sre"}},
+			userInfo: authv1.UserInfo{Username: "bob", Groups: []string{"sre"}},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "no groups",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{Approver: "bob"},
+			userInfo: authv1.UserInfo{Username: "bob"},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "different user",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{Approver: "carol"},
+			userInfo: authv1.UserInfo{Username: "bob"},
+			expected: admission.Denied("bob cannot create a SudoRequestApproval for carol"),
+		},
+		{
+			name:     "claimed groups",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{Approver: "bob", Groups: []string{"system:masters"}},
+			userInfo: authv1.UserInfo{Username: "bob", Groups: []string{"sre"}},
+			expected: admission.Denied("Groups must match the groups of the approver"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := ValidateApprover(test.spec, test.userInfo, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateRequester(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	controller := true
+	client := fake.NewFakeClientWithScheme(scheme,
+		&k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "req", UID: "req-uid"},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{User: "alice", Role: "role"},
+		},
+		&k8sudov1alpha1.SudoSchedule{
+			ObjectMeta: metav1.ObjectMeta{Name: "weekly"},
+			Spec:       k8sudov1alpha1.SudoScheduleSpec{Group: "sre", Role: "role", Requester: "carol"},
+		},
+		&k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "weekly-1596502800",
+				UID:  "weekly-1596502800-uid",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: apiGVStr,
+					Kind:       sudoScheduleKind,
+					Name:       "weekly",
+					Controller: &controller,
+				}},
+			},
+			Spec: k8sudov1alpha1.SudoRequestSpec{Group: "sre", Role: "role"},
+		},
+	)
+
+	tests := []struct {
+		name     string
+		spec     k8sudov1alpha1.SudoRequestApprovalSpec
+		expected admission.Response
+	}{
+		{
+			name:     "other user",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{SudoRequest: "req", SudoRequestUID: "req-uid", Approver: "bob"},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "requester",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{SudoRequest: "req", SudoRequestUID: "req-uid", Approver: "alice"},
+			expected: admission.Denied("alice cannot approve their own SudoRequest"),
+		},
+		{
+			name:     "group member",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{SudoRequest: "weekly-1596502800", SudoRequestUID: "weekly-1596502800-uid", Approver: "dave", Groups: []string{"dev", "sre"}},
+			expected: admission.Denied("dave cannot approve a SudoRequest for their group sre"),
+		},
+		{
+			name:     "other group",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{SudoRequest: "weekly-1596502800", SudoRequestUID: "weekly-1596502800-uid", Approver: "bob", Groups: []string{"dev"}},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "schedule requester",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{SudoRequest: "weekly-1596502800", SudoRequestUID: "weekly-1596502800-uid", Approver: "carol"},
+			expected: admission.Denied("carol cannot approve a SudoRequest created by their SudoSchedule weekly"),
+		},
+		{
+			name:     "request recreated",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{SudoRequest: "req", SudoRequestUID: "old-req-uid", Approver: "bob"},
+			expected: admission.Denied("SudoRequestUID does not match SudoRequest req"),
+		},
+		{
+			name:     "missing request",
+			spec:     k8sudov1alpha1.SudoRequestApprovalSpec{SudoRequest: "missing", Approver: "bob"},
+			expected: admission.Denied("SudoRequest missing not found"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := testinglogr.TestLogger{T: t}
+			h := &SudoReqApprovalHandler{
+				Client: client,
+				Log:    log,
+			}
+			resp := h.ValidateRequester(context.Background(), test.spec, log)
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApprovalHandleUpdate(t *testing.T) {
+	approval := "{\"spec\": {\"sudoRequest\": \"req\", \"approver\": \"bob\", \"decision\": \"Approve\"}}"
+	tests := []struct {
+		name     string
+		old      string
+		expected admission.Response
+	}{
+		{
+			name:     "unchanged",
+			old:      approval,
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "changed decision",
+			old:      "{\"spec\": {\"sudoRequest\": \"req\", \"approver\": \"bob\", \"decision\": \"Reject\"}}",
+			expected: admission.Denied("A SudoRequestApproval cannot be changed"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			h := &SudoReqApprovalHandler{
+				Log: testinglogr.TestLogger{T: t},
+			}
+			decoder, err := admission.NewDecoder(scheme)
+			if err != nil {
+				t.Fatalf("error creating decoder: %s", err)
+			}
+			h.InjectDecoder(decoder)
+			req := admissionv1beta1.AdmissionRequest{
+				Operation: admissionv1beta1.Update,
+				Object:    runtime.RawExtension{Raw: []byte(approval)},
+				OldObject: runtime.RawExtension{Raw: []byte(test.old)},
+				UserInfo:  authv1.UserInfo{Username: "bob"},
+			}
+			resp := h.Handle(context.Background(), admission.Request{AdmissionRequest: req})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
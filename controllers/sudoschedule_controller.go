@@ -0,0 +1,247 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+const (
+	sudoScheduleKind = "SudoSchedule"
+
+	// maxScheduleWindow is the longest window a SudoSchedule can have,
+	// so that the window that is in progress can always be found by
+	// looking back a week.
+	maxScheduleWindow = 7 * 24 * time.Hour
+)
+
+// SudoScheduleReconciler creates a SudoRequest for each window of a
+// SudoSchedule as it starts
+type SudoScheduleReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	Clock
+}
+
+// schedule is a parsed SudoScheduleSpec
+type schedule struct {
+	// The days the window starts on, or nil for every day
+	days     map[time.Weekday]bool
+	hour     int
+	minute   int
+	duration time.Duration
+	location *time.Location
+}
+
+// parseSchedule checks that the spec is valid and parses the days,
+// start time and time zone
+func parseSchedule(spec k8sudov1alpha1.SudoScheduleSpec) (*schedule, error) {
+	if spec.User == "" && spec.Group == "" {
+		return nil, fmt.Errorf("user or group must be specified")
+	}
+	if spec.User != "" && spec.Group != "" {
+		return nil, fmt.Errorf("only one of user and group can be specified")
+	}
+	if spec.Role == "" {
+		return nil, fmt.Errorf("role must be specified")
+	}
+	start, err := time.Parse("15:04", spec.Start)
+	if err != nil {
+		return nil, fmt.Errorf("start %q is not a time of day as HH:MM", spec.Start)
+	}
+	if spec.Duration.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if spec.Duration.Duration > maxScheduleWindow {
+		return nil, fmt.Errorf("duration must be at most %s", maxScheduleWindow)
+	}
+	location, err := time.LoadLocation(spec.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", spec.TimeZone)
+	}
+	s := &schedule{
+		hour:     start.Hour(),
+		minute:   start.Minute(),
+		duration: spec.Duration.Duration,
+		location: location,
+	}
+	for _, day := range spec.Days {
+		weekday, ok := parseWeekday(day)
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", day)
+		}
+		if s.days == nil {
+			s.days = map[time.Weekday]bool{}
+		}
+		s.days[weekday] = true
+	}
+	return s, nil
+}
+
+func parseWeekday(day string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(day, weekday.String()) {
+			return weekday, true
+		}
+	}
+	return time.Sunday, false
+}
+
+// startOn returns the start of the window on the given day in the
+// schedule's time zone, and whether there is a window on that day
+func (s *schedule) startOn(year int, month time.Month, day int) (time.Time, bool) {
+	start := time.Date(year, month, day, s.hour, s.minute, 0, 0, s.location)
+	return start, s.days == nil || s.days[start.Weekday()]
+}
+
+// next returns the start and end of the earliest window that hasn't
+// ended by now, which may already be in progress
+func (s *schedule) next(now time.Time) (time.Time, time.Time) {
+	local := now.In(s.location)
+	for i := -8; i <= 8; i++ {
+		start, ok := s.startOn(local.Year(), local.Month(), local.Day()+i)
+		if !ok {
+			continue
+		}
+		if end := start.Add(s.duration); end.After(now) {
+			return start, end
+		}
+	}
+	// Every schedule has a window at least once a week, so this can't
+	// be reached
+	return time.Time{}, time.Time{}
+}
+
+// isStart returns whether a window of the schedule starts at t
+func (s *schedule) isStart(t time.Time) bool {
+	local := t.In(s.location)
+	start, ok := s.startOn(local.Year(), local.Month(), local.Day())
+	return ok && start.Equal(t)
+}
+
+// sudoRequestName returns the name of the SudoRequest for the window of
+// the schedule starting at start
+func sudoRequestName(sched *k8sudov1alpha1.SudoSchedule, start time.Time) string {
+	return fmt.Sprintf("%s-%d", sched.Name, start.Unix())
+}
+
+// sudoRequestSpecForWindow returns the spec of the SudoRequest that
+// grants the scheduled role between start and end
+func sudoRequestSpecForWindow(spec k8sudov1alpha1.SudoScheduleSpec, start, end time.Time) k8sudov1alpha1.SudoRequestSpec {
+	return k8sudov1alpha1.SudoRequestSpec{
+		User:      spec.User,
+		Group:     spec.Group,
+		Role:      spec.Role,
+		RoleKind:  spec.RoleKind,
+		Namespace: spec.Namespace,
+		Reason:    spec.Reason,
+		NotBefore: &metav1.Time{Time: start},
+		Expires:   &metav1.Time{Time: end},
+	}
+}
+
+// scheduleOf returns the name of the SudoSchedule that created the
+// request, if any
+func scheduleOf(sudoReq *k8sudov1alpha1.SudoRequest) string {
+	owner := metav1.GetControllerOf(sudoReq)
+	if owner == nil || owner.APIVersion != apiGVStr || owner.Kind != sudoScheduleKind {
+		return ""
+	}
+	return owner.Name
+}
+
+// +kubebuilder:rbac:groups=k8sudo.jetstack.io,resources=sudoschedules,verbs=get;list;watch
+// +kubebuilder:rbac:groups=k8sudo.jetstack.io,resources=sudoschedules/status,verbs=get;update;patch
+
+func (r *SudoScheduleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sudoschedule", req.NamespacedName)
+
+	var sched k8sudov1alpha1.SudoSchedule
+	if err := r.Get(ctx, req.NamespacedName, &sched); err != nil {
+		log.Error(err, "unable to fetch SudoSchedule")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	parsed, err := parseSchedule(sched.Spec)
+	if err != nil {
+		sched.Status.Reason = fmt.Sprintf("Invalid schedule: %s", err)
+		if err := r.Status().Update(ctx, &sched); err != nil {
+			log.Error(err, "unable to update SudoSchedule status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	now := r.Now()
+	start, end := parsed.next(now)
+	if start.After(now) {
+		if sched.Status.Reason != "" {
+			sched.Status.Reason = ""
+			if err := r.Status().Update(ctx, &sched); err != nil {
+				log.Error(err, "unable to update SudoSchedule status")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: start.Sub(now)}, nil
+	}
+
+	sudoReq := &k8sudov1alpha1.SudoRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: sudoRequestName(&sched, start),
+		},
+		Spec: sudoRequestSpecForWindow(sched.Spec, start, end),
+	}
+	if err := ctrl.SetControllerReference(&sched, sudoReq, r.Scheme); err != nil {
+		log.Error(err, "Error setting ownerReference")
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, sudoReq); IgnoreAlreadyExists(err) != nil {
+		log.Error(err, "unable to create SudoRequest", "sudorequest", sudoReq.Name)
+		return ctrl.Result{}, err
+	}
+
+	sched.Status.LastScheduled = &metav1.Time{Time: start}
+	sched.Status.SudoRequest = sudoReq.Name
+	sched.Status.Reason = ""
+	if err := r.Status().Update(ctx, &sched); err != nil {
+		log.Error(err, "unable to update SudoSchedule status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: end.Sub(now)}, nil
+}
+
+func (r *SudoScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Clock == nil {
+		r.Clock = realClock{}
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&k8sudov1alpha1.SudoSchedule{}).
+		Complete(r)
+}
@@ -0,0 +1,296 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+func TestParseSchedule(t *testing.T) {
+	valid := k8sudov1alpha1.SudoScheduleSpec{
+		User:     "user",
+		Role:     "role",
+		Days:     []string{"Tuesday", "thursday"},
+		Start:    "02:00",
+		Duration: metav1.Duration{Duration: 2 * time.Hour},
+		TimeZone: "Europe/London",
+	}
+	tests := []struct {
+		name        string
+		modify      func(spec *k8sudov1alpha1.SudoScheduleSpec)
+		expectError bool
+	}{
+		{
+			name:   "valid",
+			modify: func(spec *k8sudov1alpha1.SudoScheduleSpec) {},
+		},
+		{
+			name: "every day in UTC",
+			modify: func(spec *k8sudov1alpha1.SudoScheduleSpec) {
+				spec.Days = nil
+				spec.TimeZone = ""
+			},
+		},
+		{
+			name:        "no subject",
+			modify:      func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.User = "" },
+			expectError: true,
+		},
+		{
+			name:        "user and group",
+			modify:      func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.Group = "group" },
+			expectError: true,
+		},
+		{
+			name:        "no role",
+			modify:      func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.Role = "" },
+			expectError: true,
+		},
+		{
+			name:        "bad start",
+			modify:      func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.Start = "2am" },
+			expectError: true,
+		},
+		{
+			name:        "no duration",
+			modify:      func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.Duration = metav1.Duration{} },
+			expectError: true,
+		},
+		{
+			name: "duration over a week",
+			modify: func(spec *k8sudov1alpha1.SudoScheduleSpec) {
+				spec.Duration = metav1.Duration{Duration: 8 * 24 * time.Hour}
+			},
+			expectError: true,
+		},
+		{
+			name:        "unknown time zone",
+			modify:      func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.TimeZone = "Mars/Olympus_Mons" },
+			expectError: true,
+		},
+		{
+			name:        "unknown day",
+			modify:      func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.Days = []string{"Caturday"} },
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := *valid.DeepCopy()
+			test.modify(&spec)
+			_, err := parseSchedule(spec)
+			if got, want := (err != nil), test.expectError; got != want {
+				t.Errorf("unexpected error state: (got != want) %t != %t: %v", got, want, err)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("error loading time zone: %v", err)
+	}
+	weekly := k8sudov1alpha1.SudoScheduleSpec{
+		User:     "user",
+		Role:     "role",
+		Days:     []string{"Tuesday"},
+		Start:    "02:00",
+		Duration: metav1.Duration{Duration: 2 * time.Hour},
+		TimeZone: "Europe/London",
+	}
+	daily := k8sudov1alpha1.SudoScheduleSpec{
+		User:     "user",
+		Role:     "role",
+		Start:    "23:00",
+		Duration: metav1.Duration{Duration: 2 * time.Hour},
+	}
+	tests := []struct {
+		name          string
+		spec          k8sudov1alpha1.SudoScheduleSpec
+		now           time.Time
+		expectedStart time.Time
+	}{
+		{
+			name:          "before the window",
+			spec:          weekly,
+			now:           time.Date(2020, time.June, 1, 12, 0, 0, 0, london),
+			expectedStart: time.Date(2020, time.June, 2, 2, 0, 0, 0, london),
+		},
+		{
+			name:          "during the window",
+			spec:          weekly,
+			now:           time.Date(2020, time.June, 2, 3, 0, 0, 0, london),
+			expectedStart: time.Date(2020, time.June, 2, 2, 0, 0, 0, london),
+		},
+		{
+			name:          "after the window",
+			spec:          weekly,
+			now:           time.Date(2020, time.June, 2, 4, 0, 0, 0, london),
+			expectedStart: time.Date(2020, time.June, 9, 2, 0, 0, 0, london),
+		},
+		{
+			name:          "across a change to daylight saving time",
+			spec:          weekly,
+			now:           time.Date(2020, time.March, 25, 12, 0, 0, 0, london),
+			expectedStart: time.Date(2020, time.March, 31, 2, 0, 0, 0, london),
+		},
+		{
+			name:          "daily window spanning midnight",
+			spec:          daily,
+			now:           time.Date(2020, time.June, 2, 0, 30, 0, 0, time.UTC),
+			expectedStart: time.Date(2020, time.June, 1, 23, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sched, err := parseSchedule(test.spec)
+			if err != nil {
+				t.Fatalf("error parsing schedule: %v", err)
+			}
+			start, end := sched.next(test.now)
+			if got, want := start, test.expectedStart; !got.Equal(want) {
+				t.Errorf("wrong start: (got != want) %s != %s", got, want)
+			}
+			if got, want := end, test.expectedStart.Add(test.spec.Duration.Duration); !got.Equal(want) {
+				t.Errorf("wrong end: (got != want) %s != %s", got, want)
+			}
+			if !sched.isStart(start) {
+				t.Errorf("%s is not the start of a window", start)
+			}
+			if sched.isStart(start.Add(time.Minute)) {
+				t.Errorf("%s is the start of a window", start.Add(time.Minute))
+			}
+		})
+	}
+}
+
+func TestScheduleOf(t *testing.T) {
+	scheme := runtime.NewScheme()
+	k8sudov1alpha1.AddToScheme(scheme)
+	sched := &k8sudov1alpha1.SudoSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "maintenance"},
+	}
+	sudoReq := &k8sudov1alpha1.SudoRequest{}
+	if got, want := scheduleOf(sudoReq), ""; got != want {
+		t.Errorf("wrong schedule for a request without an owner: (got != want) %q != %q", got, want)
+	}
+	if err := ctrl.SetControllerReference(sched, sudoReq, scheme); err != nil {
+		t.Fatalf("error setting owner: %v", err)
+	}
+	if got, want := scheduleOf(sudoReq), "maintenance"; got != want {
+		t.Errorf("wrong schedule: (got != want) %q != %q", got, want)
+	}
+}
+
+func TestSudoScheduleReconcile(t *testing.T) {
+	sched := &k8sudov1alpha1.SudoSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "maintenance"},
+		Spec: k8sudov1alpha1.SudoScheduleSpec{
+			Group:    "sre",
+			Role:     "role",
+			Start:    "02:00",
+			Duration: metav1.Duration{Duration: 2 * time.Hour},
+		},
+	}
+	start := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name            string
+		now             time.Time
+		expectedRequeue time.Duration
+		expectedRequest bool
+	}{
+		{
+			name:            "before the window",
+			now:             start.Add(-time.Hour),
+			expectedRequeue: time.Hour,
+		},
+		{
+			name:            "during the window",
+			now:             start.Add(30 * time.Minute),
+			expectedRequeue: 90 * time.Minute,
+			expectedRequest: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			client := fake.NewFakeClientWithScheme(scheme, sched.DeepCopy())
+			r := &SudoScheduleReconciler{
+				Client: client,
+				Log:    testinglogr.TestLogger{T: t},
+				Scheme: scheme,
+				Clock:  FakeClock{CurrentTime: test.now},
+			}
+			res, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: sched.Name}})
+			if err != nil {
+				t.Fatalf("Reconcile returned an error: %v", err)
+			}
+			if got, want := res.RequeueAfter, test.expectedRequeue; got != want {
+				t.Errorf("wrong RequeueAfter: (got != want) %s != %s", got, want)
+			}
+
+			var sudoReqs k8sudov1alpha1.SudoRequestList
+			if err := client.List(context.Background(), &sudoReqs); err != nil {
+				t.Fatalf("error listing SudoRequests: %v", err)
+			}
+			if !test.expectedRequest {
+				if len(sudoReqs.Items) != 0 {
+					t.Errorf("unexpected SudoRequests: %+v", sudoReqs.Items)
+				}
+				return
+			}
+			if len(sudoReqs.Items) != 1 {
+				t.Fatalf("wrong number of SudoRequests: %d", len(sudoReqs.Items))
+			}
+			sudoReq := sudoReqs.Items[0]
+			if got, want := scheduleOf(&sudoReq), sched.Name; got != want {
+				t.Errorf("wrong owner: (got != want) %q != %q", got, want)
+			}
+			if got, want := sudoReq.Spec.Group, "sre"; got != want {
+				t.Errorf("wrong Group: (got != want) %q != %q", got, want)
+			}
+			if got, want := sudoReq.Spec.NotBefore.Time, start; !got.Equal(want) {
+				t.Errorf("wrong NotBefore: (got != want) %s != %s", got, want)
+			}
+			if got, want := sudoReq.Spec.Expires.Time, start.Add(2*time.Hour); !got.Equal(want) {
+				t.Errorf("wrong Expires: (got != want) %s != %s", got, want)
+			}
+
+			var updated k8sudov1alpha1.SudoSchedule
+			if err := client.Get(context.Background(), types.NamespacedName{Name: sched.Name}, &updated); err != nil {
+				t.Fatalf("error getting SudoSchedule: %v", err)
+			}
+			if got, want := updated.Status.SudoRequest, sudoReq.Name; got != want {
+				t.Errorf("wrong status SudoRequest: (got != want) %q != %q", got, want)
+			}
+		})
+	}
+}
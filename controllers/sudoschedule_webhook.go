@@ -0,0 +1,198 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"k8s.io/api/admission/v1beta1"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/policy"
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-k8sudo-jetstack-io-v1alpha1-sudoschedule,mutating=false,failurePolicy=fail,groups=k8sudo.jetstack.io,resources=sudoschedules,versions=v1alpha1,name=vsudoschedule.kb.io
+
+const (
+	SudoScheduleValidateWebhookPath = "/validate-k8sudo-jetstack-io-v1alpha1-sudoschedule"
+)
+
+func (h *SudoScheduleHandler) SetupWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(SudoScheduleValidateWebhookPath, &webhook.Admission{Handler: h})
+	return nil
+}
+
+// SudoScheduleHandler validates SudoSchedules. The SudoRequests that a
+// schedule creates are checked against the schedule rather than against
+// whoever created it, so the user or group that the schedule grants the
+// role to must be allowed to sudo it when the schedule is created.
+type SudoScheduleHandler struct {
+	Client  client.Client
+	Decoder *admission.Decoder
+	Log     logr.Logger
+	// The policy to apply to schedules. If nil the built-in defaults
+	// are used.
+	Policy *policy.Store
+}
+
+// ValidateSchedule checks that the spec is valid and its windows can be
+// worked out
+func ValidateSchedule(spec k8sudov1alpha1.SudoScheduleSpec, log logr.Logger) admission.Response {
+	if _, err := parseSchedule(spec); err != nil {
+		return admission.Denied(fmt.Sprintf("SudoSchedule is invalid: %s", err))
+	}
+	return admission.Allowed("")
+}
+
+// ValidateScheduleRequester checks that the requester recorded is the
+// user creating the schedule, as they can't approve the requests it
+// creates, and that it isn't changed afterwards
+func ValidateScheduleRequester(old *k8sudov1alpha1.SudoSchedule, spec k8sudov1alpha1.SudoScheduleSpec, userInfo authv1.UserInfo, log logr.Logger) admission.Response {
+	if old != nil {
+		if spec.Requester != old.Spec.Requester {
+			return admission.Denied("Requester cannot be changed")
+		}
+		return admission.Allowed("")
+	}
+	if spec.Requester != userInfo.Username {
+		return admission.Denied(fmt.Sprintf("%s cannot create a SudoSchedule as %s", userInfo.Username, spec.Requester))
+	}
+	return admission.Allowed("")
+}
+
+// ValidateScheduleSubject checks that the user changing the schedule is
+// the user it grants the role to or a member of the group, so that a
+// schedule can't be used to grant a role to someone else
+func ValidateScheduleSubject(spec k8sudov1alpha1.SudoScheduleSpec, userInfo authv1.UserInfo, log logr.Logger) admission.Response {
+	if spec.User != "" {
+		if spec.User != userInfo.Username {
+			return admission.Denied(fmt.Sprintf("%s cannot create a SudoSchedule for %s", userInfo.Username, spec.User))
+		}
+		return admission.Allowed("")
+	}
+	for _, group := range userInfo.Groups {
+		if group == spec.Group {
+			return admission.Allowed("")
+		}
+	}
+	return admission.Denied(fmt.Sprintf("%s cannot create a SudoSchedule for group %s", userInfo.Username, spec.Group))
+}
+
+// ValidateSchedulePolicy checks the schedule against the policy for the
+// role, as the user changing it would be checked if they requested the
+// role themselves. Each window is a request for its whole duration, so
+// it can't be longer than the policy allows.
+func ValidateSchedulePolicy(spec k8sudov1alpha1.SudoScheduleSpec, userInfo authv1.UserInfo, settings policy.Settings, log logr.Logger) admission.Response {
+	if settings.RequireReason && spec.Reason == "" {
+		return admission.Denied(fmt.Sprintf("Reason must be set to request %s", spec.Role))
+	}
+	if !settings.Allows(userInfo.Username, userInfo.Groups) {
+		return admission.Denied(fmt.Sprintf("%s is not allowed to request %s", userInfo.Username, spec.Role))
+	}
+	if spec.Duration.Duration > settings.MaxDuration {
+		return admission.Denied(fmt.Sprintf("Duration %s is longer than the maximum of %s for %s", spec.Duration.Duration, settings.MaxDuration, spec.Role))
+	}
+	return admission.Allowed("")
+}
+
+// ValidateSubjectAccess checks that the user or group the schedule grants
+// the role to is allowed to sudo it
+func (h *SudoScheduleHandler) ValidateSubjectAccess(ctx context.Context, spec k8sudov1alpha1.SudoScheduleSpec, log logr.Logger) admission.Response {
+	sar := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User: spec.User,
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace: spec.Namespace,
+				Verb:      "sudo",
+				Group:     "rbac.authorization.k8s.io",
+				Version:   "v1",
+				Resource:  "clusterroles",
+				Name:      spec.Role,
+			},
+		},
+	}
+	subject := spec.User
+	if spec.Group != "" {
+		sar.Spec.Groups = []string{spec.Group}
+		subject = spec.Group
+	}
+	if spec.RoleKind == k8sudov1alpha1.RoleKindRole {
+		sar.Spec.ResourceAttributes.Resource = "roles"
+	}
+	if err := h.Client.Create(ctx, sar); err != nil {
+		log.Error(err, "unable to create SubjectAccessReview")
+	}
+	if !sar.Status.Allowed || sar.Status.Denied {
+		return admission.Denied(fmt.Sprintf("%s is not allowed to sudo %s", subject, spec.Role))
+	}
+	return admission.Allowed("")
+}
+
+func (h *SudoScheduleHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sched := &k8sudov1alpha1.SudoSchedule{}
+	if err := h.Decoder.Decode(req, sched); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	log := h.Log.WithValues("sudoschedule", sched.GetObjectMeta().GetName())
+	log.Info("Validating SudoSchedule")
+	var old *k8sudov1alpha1.SudoSchedule
+	switch req.AdmissionRequest.Operation {
+	case v1beta1.Create:
+	case v1beta1.Update:
+		old = &k8sudov1alpha1.SudoSchedule{}
+		if err := h.Decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// Changes that don't touch the spec, such as to the status,
+		// don't need to be validated
+		if reflect.DeepEqual(old.Spec, sched.Spec) {
+			return admission.Allowed("")
+		}
+	default:
+		return admission.Allowed("")
+	}
+	resp := ValidateSchedule(sched.Spec, log)
+	if !resp.Allowed {
+		return resp
+	}
+	resp = ValidateScheduleRequester(old, sched.Spec, req.UserInfo, log)
+	if !resp.Allowed {
+		return resp
+	}
+	resp = ValidateScheduleSubject(sched.Spec, req.UserInfo, log)
+	if !resp.Allowed {
+		return resp
+	}
+	resp = ValidateSchedulePolicy(sched.Spec, req.UserInfo, h.Policy.ForRole(sched.Spec.Role), log)
+	if !resp.Allowed {
+		return resp
+	}
+	return h.ValidateSubjectAccess(ctx, sched.Spec, log)
+}
+
+func (h *SudoScheduleHandler) InjectDecoder(d *admission.Decoder) error {
+	h.Decoder = d
+	return nil
+}
@@ -0,0 +1,441 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	clientpkg "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/policy"
+)
+
+// accessReviewClient answers SubjectAccessReviews, which the fake client
+// doesn't evaluate, allowing the users and groups listed to sudo the
+// role, or approve the request, named
+type accessReviewClient struct {
+	clientpkg.Client
+	allowed map[string]string
+	reviews []authzv1.SubjectAccessReviewSpec
+}
+
+func (c *accessReviewClient) Create(ctx context.Context, obj runtime.Object, opts ...clientpkg.CreateOption) error {
+	sar, ok := obj.(*authzv1.SubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	c.reviews = append(c.reviews, sar.Spec)
+	attrs := sar.Spec.ResourceAttributes
+	if attrs.Verb != "sudo" && attrs.Verb != "approve" {
+		return nil
+	}
+	if c.allowed[sar.Spec.User] == attrs.Name {
+		sar.Status.Allowed = true
+	}
+	for _, group := range sar.Spec.Groups {
+		if c.allowed[group] == attrs.Name {
+			sar.Status.Allowed = true
+		}
+	}
+	return nil
+}
+
+func TestValidateSchedule(t *testing.T) {
+	valid := k8sudov1alpha1.SudoScheduleSpec{
+		Group:    "sre",
+		Role:     "role",
+		Start:    "02:00",
+		Duration: metav1.Duration{Duration: 2 * time.Hour},
+	}
+	tests := []struct {
+		name     string
+		modify   func(spec *k8sudov1alpha1.SudoScheduleSpec)
+		expected admission.Response
+	}{
+		{
+			name:     "valid",
+			modify:   func(spec *k8sudov1alpha1.SudoScheduleSpec) {},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "no subject",
+			modify:   func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.Group = "" },
+			expected: admission.Denied("SudoSchedule is invalid: user or group must be specified"),
+		},
+		{
+			name:     "invalid start",
+			modify:   func(spec *k8sudov1alpha1.SudoScheduleSpec) { spec.Start = "2am" },
+			expected: admission.Denied("SudoSchedule is invalid: start \"2am\" is not a time of day as HH:MM"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := valid
+			test.modify(&spec)
+			resp := ValidateSchedule(spec, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateScheduleRequester(t *testing.T) {
+	tests := []struct {
+		name      string
+		old       *k8sudov1alpha1.SudoSchedule
+		requester string
+		username  string
+		expected  admission.Response
+	}{
+		{
+			name:      "created by requester",
+			requester: "admin",
+			username:  "admin",
+			expected:  admission.Allowed(""),
+		},
+		{
+			name:      "created as another user",
+			requester: "admin",
+			username:  "alice",
+			expected:  admission.Denied("alice cannot create a SudoSchedule as admin"),
+		},
+		{
+			name:     "created without requester",
+			username: "alice",
+			expected: admission.Denied("alice cannot create a SudoSchedule as "),
+		},
+		{
+			name:      "updated by another user",
+			old:       &k8sudov1alpha1.SudoSchedule{Spec: k8sudov1alpha1.SudoScheduleSpec{Requester: "admin"}},
+			requester: "admin",
+			username:  "alice",
+			expected:  admission.Allowed(""),
+		},
+		{
+			name:      "requester changed",
+			old:       &k8sudov1alpha1.SudoSchedule{Spec: k8sudov1alpha1.SudoScheduleSpec{Requester: "admin"}},
+			requester: "alice",
+			username:  "alice",
+			expected:  admission.Denied("Requester cannot be changed"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := k8sudov1alpha1.SudoScheduleSpec{Requester: test.requester}
+			resp := ValidateScheduleRequester(test.old, spec, authv1.UserInfo{Username: test.username}, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateScheduleSubject(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     k8sudov1alpha1.SudoScheduleSpec
+		userInfo authv1.UserInfo
+		expected admission.Response
+	}{
+		{
+			name:     "user",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{User: "alice"},
+			userInfo: authv1.UserInfo{Username: "alice"},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "another user",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{User: "bob"},
+			userInfo: authv1.UserInfo{Username: "alice"},
+			expected: admission.Denied("alice cannot create a SudoSchedule for bob"),
+		},
+		{
+			name:     "member of group",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{Group: "sre"},
+			userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"devs", "sre"}},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "not a member of group",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{Group: "sre"},
+			userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"devs"}},
+			expected: admission.Denied("alice cannot create a SudoSchedule for group sre"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := ValidateScheduleSubject(test.spec, test.userInfo, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateSchedulePolicy(t *testing.T) {
+	hour := metav1.Duration{Duration: time.Hour}
+	tests := []struct {
+		name     string
+		spec     k8sudov1alpha1.SudoScheduleSpec
+		userInfo authv1.UserInfo
+		settings policy.Settings
+		expected admission.Response
+	}{
+		{
+			name:     "allowed",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{Group: "sre", Role: "role", Duration: hour},
+			userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"sre"}},
+			settings: policy.Settings{MaxDuration: time.Hour},
+			expected: admission.Allowed(""),
+		},
+		{
+			name:     "window too long",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{Group: "sre", Role: "role", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"sre"}},
+			settings: policy.Settings{MaxDuration: time.Hour},
+			expected: admission.Denied("Duration 2h0m0s is longer than the maximum of 1h0m0s for role"),
+		},
+		{
+			name:     "reason required",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{Group: "sre", Role: "role", Duration: hour},
+			userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"sre"}},
+			settings: policy.Settings{MaxDuration: time.Hour, RequireReason: true},
+			expected: admission.Denied("Reason must be set to request role"),
+		},
+		{
+			name:     "creator not allowed",
+			spec:     k8sudov1alpha1.SudoScheduleSpec{Group: "sre", Role: "role", Duration: hour},
+			userInfo: authv1.UserInfo{Username: "alice", Groups: []string{"sre"}},
+			settings: policy.Settings{MaxDuration: time.Hour, AllowedSubjects: []policy.Subject{{Kind: "User", Name: "bob"}}},
+			expected: admission.Denied("alice is not allowed to request role"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := ValidateSchedulePolicy(test.spec, test.userInfo, test.settings, testinglogr.TestLogger{T: t})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateSubjectAccess(t *testing.T) {
+	tests := []struct {
+		name             string
+		spec             k8sudov1alpha1.SudoScheduleSpec
+		expected         admission.Response
+		expectedUser     string
+		expectedGroups   []string
+		expectedResource string
+	}{
+		{
+			name:             "user allowed",
+			spec:             k8sudov1alpha1.SudoScheduleSpec{User: "alice", Role: "role"},
+			expected:         admission.Allowed(""),
+			expectedUser:     "alice",
+			expectedResource: "clusterroles",
+		},
+		{
+			name:             "group allowed",
+			spec:             k8sudov1alpha1.SudoScheduleSpec{Group: "sre", Role: "role"},
+			expected:         admission.Allowed(""),
+			expectedGroups:   []string{"sre"},
+			expectedResource: "clusterroles",
+		},
+		{
+			name:             "not allowed the role",
+			spec:             k8sudov1alpha1.SudoScheduleSpec{Group: "sre", Role: "cluster-admin"},
+			expected:         admission.Denied("sre is not allowed to sudo cluster-admin"),
+			expectedGroups:   []string{"sre"},
+			expectedResource: "clusterroles",
+		},
+		{
+			name:             "namespaced Role",
+			spec:             k8sudov1alpha1.SudoScheduleSpec{User: "bob", Role: "role", RoleKind: k8sudov1alpha1.RoleKindRole, Namespace: "dev"},
+			expected:         admission.Denied("bob is not allowed to sudo role"),
+			expectedUser:     "bob",
+			expectedResource: "roles",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &accessReviewClient{
+				Client:  fake.NewFakeClientWithScheme(runtime.NewScheme()),
+				allowed: map[string]string{"alice": "role", "sre": "role"},
+			}
+			log := testinglogr.TestLogger{T: t}
+			h := &SudoScheduleHandler{
+				Client: client,
+				Log:    log,
+			}
+			resp := h.ValidateSubjectAccess(context.Background(), test.spec, log)
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+			if got, want := len(client.reviews), 1; got != want {
+				t.Fatalf("wrong number of SubjectAccessReviews: (got != want) %d != %d", got, want)
+			}
+			review := client.reviews[0]
+			if got, want := review.User, test.expectedUser; got != want {
+				t.Errorf("wrong user: (got != want) %q != %q", got, want)
+			}
+			if got, want := review.Groups, test.expectedGroups; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong groups: (got != want) %v != %v", got, want)
+			}
+			if got, want := review.ResourceAttributes.Resource, test.expectedResource; got != want {
+				t.Errorf("wrong resource: (got != want) %s != %s", got, want)
+			}
+			if got, want := review.ResourceAttributes.Namespace, test.spec.Namespace; got != want {
+				t.Errorf("wrong namespace: (got != want) %s != %s", got, want)
+			}
+		})
+	}
+}
+
+func TestScheduleHandle(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       string
+		old       string
+		username  string
+		groups    []string
+		operation admissionv1beta1.Operation
+		expected  admission.Response
+	}{
+		{
+			name:      "allowed",
+			operation: admissionv1beta1.Create,
+			username:  "admin",
+			groups:    []string{"sre"},
+			req:       "{\"spec\": {\"group\": \"sre\", \"role\": \"role\", \"requester\": \"admin\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			expected:  admission.Allowed(""),
+		},
+		{
+			name:      "invalid",
+			operation: admissionv1beta1.Create,
+			username:  "admin",
+			groups:    []string{"sre"},
+			req:       "{\"spec\": {\"group\": \"sre\", \"role\": \"role\", \"requester\": \"admin\", \"start\": \"02:00\"}}",
+			expected:  admission.Denied("SudoSchedule is invalid: duration must be positive"),
+		},
+		{
+			name:      "requester isn't the creator",
+			operation: admissionv1beta1.Create,
+			username:  "alice",
+			req:       "{\"spec\": {\"group\": \"sre\", \"role\": \"role\", \"requester\": \"admin\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			expected:  admission.Denied("alice cannot create a SudoSchedule as admin"),
+		},
+		{
+			name:      "creator isn't in the group",
+			operation: admissionv1beta1.Create,
+			username:  "admin",
+			req:       "{\"spec\": {\"group\": \"sre\", \"role\": \"role\", \"requester\": \"admin\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			expected:  admission.Denied("admin cannot create a SudoSchedule for group sre"),
+		},
+		{
+			name:      "window longer than the policy allows",
+			operation: admissionv1beta1.Create,
+			username:  "admin",
+			groups:    []string{"sre"},
+			req:       "{\"spec\": {\"group\": \"sre\", \"role\": \"role\", \"requester\": \"admin\", \"start\": \"02:00\", \"duration\": \"2h\"}}",
+			expected:  admission.Denied("Duration 2h0m0s is longer than the maximum of 1h0m0s for role"),
+		},
+		{
+			name:      "subject not allowed",
+			operation: admissionv1beta1.Create,
+			username:  "bob",
+			req:       "{\"spec\": {\"user\": \"bob\", \"role\": \"role\", \"requester\": \"bob\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			expected:  admission.Denied("bob is not allowed to sudo role"),
+		},
+		{
+			name:      "role changed",
+			operation: admissionv1beta1.Update,
+			username:  "admin",
+			groups:    []string{"sre"},
+			old:       "{\"spec\": {\"group\": \"sre\", \"role\": \"role\", \"requester\": \"admin\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			req:       "{\"spec\": {\"group\": \"sre\", \"role\": \"cluster-admin\", \"requester\": \"admin\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			expected:  admission.Denied("sre is not allowed to sudo cluster-admin"),
+		},
+		{
+			name:      "spec unchanged",
+			operation: admissionv1beta1.Update,
+			username:  "system:serviceaccount:k8sudo-system:default",
+			old:       "{\"spec\": {\"group\": \"sre\", \"role\": \"role\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			req:       "{\"metadata\": {\"labels\": {\"team\": \"sre\"}}, \"spec\": {\"group\": \"sre\", \"role\": \"role\", \"start\": \"02:00\", \"duration\": \"1h\"}}",
+			expected:  admission.Allowed(""),
+		},
+		{
+			name:      "delete",
+			operation: admissionv1beta1.Delete,
+			req:       "{}",
+			expected:  admission.Allowed(""),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := testinglogr.TestLogger{T: t}
+			h := &SudoScheduleHandler{
+				Client: &accessReviewClient{
+					Client:  fake.NewFakeClientWithScheme(runtime.NewScheme()),
+					allowed: map[string]string{"sre": "role"},
+				},
+				Log: log,
+			}
+			decoder, err := admission.NewDecoder(scheme.Scheme)
+			if err != nil {
+				t.Fatalf("error creating decoder: %s", err)
+			}
+			h.InjectDecoder(decoder)
+			req := admissionv1beta1.AdmissionRequest{
+				Operation: test.operation,
+				Object: runtime.RawExtension{
+					Raw: []byte(test.req),
+				},
+				OldObject: runtime.RawExtension{
+					Raw: []byte(test.old),
+				},
+				UserInfo: authv1.UserInfo{
+					Username: test.username,
+					Groups:   test.groups,
+				},
+			}
+			resp := h.Handle(context.Background(), admission.Request{AdmissionRequest: req})
+			if got, want := resp, test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected response: (got != want) %v != %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/apiaudit"
+	"jetstack.io/k8sudo/pkg/audit"
+)
+
+// Why the sweeper deleted a binding
+const (
+	sweepReasonOrphaned = "orphaned"
+	sweepReasonExpired  = "expired"
+	sweepReasonRevoked  = "revoked"
+)
+
+// BindingSweeper deletes the bindings created by k8sudo that have
+// outlived the access they grant, because the request they were created
+// for is missing, or has expired or been revoked without the controller
+// deleting them, such as while it wasn't running. It sweeps when the
+// manager starts and then periodically.
+type BindingSweeper struct {
+	Client client.Client
+	Log    logr.Logger
+	Clock
+	// Records each binding that is deleted. If nil nothing is recorded.
+	Audit *audit.Logger
+	// How often to sweep after the sweep at start up
+	Interval time.Duration
+}
+
+func (s *BindingSweeper) SetupWithManager(mgr ctrl.Manager) error {
+	if s.Clock == nil {
+		s.Clock = realClock{}
+	}
+	return mgr.Add(s)
+}
+
+// Start sweeps straight away and then on each interval until stop is
+// closed. Only the leader sweeps.
+func (s *BindingSweeper) Start(stop <-chan struct{}) error {
+	if s.Interval <= 0 {
+		return fmt.Errorf("invalid sweep interval %s, must be greater than 0", s.Interval)
+	}
+	wait.Until(func() {
+		if err := s.Sweep(context.Background()); err != nil {
+			s.Log.Error(err, "unable to sweep bindings")
+		}
+	}, s.Interval, stop)
+	return nil
+}
+
+// Sweep deletes every ClusterRoleBinding and RoleBinding created by
+// k8sudo that no longer grants access. The bindings are listed before
+// the requests, so that a binding created for a request just after the
+// requests were listed isn't mistaken for an orphan.
+func (s *BindingSweeper) Sweep(ctx context.Context) error {
+	var bindings []runtime.Object
+	var crbs rbacv1.ClusterRoleBindingList
+	if err := s.Client.List(ctx, &crbs); err != nil {
+		return fmt.Errorf("unable to list ClusterRoleBindings: %v", err)
+	}
+	for i := range crbs.Items {
+		bindings = append(bindings, &crbs.Items[i])
+	}
+	var rbs rbacv1.RoleBindingList
+	if err := s.Client.List(ctx, &rbs); err != nil {
+		return fmt.Errorf("unable to list RoleBindings: %v", err)
+	}
+	for i := range rbs.Items {
+		bindings = append(bindings, &rbs.Items[i])
+	}
+
+	var sudoReqList k8sudov1alpha1.SudoRequestList
+	if err := s.Client.List(ctx, &sudoReqList); err != nil {
+		return fmt.Errorf("unable to list SudoRequests: %v", err)
+	}
+	sudoReqs := map[string]*k8sudov1alpha1.SudoRequest{}
+	for i := range sudoReqList.Items {
+		sudoReqs[sudoReqList.Items[i].Name] = &sudoReqList.Items[i]
+	}
+
+	now := s.Now()
+	for _, binding := range bindings {
+		if err := s.sweep(ctx, binding, sudoReqs, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweep deletes the binding if it was created by k8sudo and no longer
+// grants access
+func (s *BindingSweeper) sweep(ctx context.Context, binding runtime.Object, sudoReqs map[string]*k8sudov1alpha1.SudoRequest, now time.Time) error {
+	obj, err := meta.Accessor(binding)
+	if err != nil {
+		return err
+	}
+	name := bindingRequest(obj)
+	if name == "" {
+		return nil
+	}
+	// The cached requests may lag behind the bindings, so bindings are
+	// only swept once they are older than an interval
+	if now.Sub(obj.GetCreationTimestamp().Time) < s.Interval {
+		return nil
+	}
+	sudoReq := sudoReqs[name]
+	reason, message := sweepReason(obj, sudoReq, now)
+	if reason == "" {
+		return nil
+	}
+	log := s.Log.WithValues("binding", obj.GetName(), "namespace", obj.GetNamespace(), "sudorequest", name)
+	if err := s.Client.Delete(ctx, binding); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("unable to delete binding %s: %v", obj.GetName(), err)
+	}
+	log.Info("Deleted binding", "reason", message)
+	sweptBindings.WithLabelValues(reason).Inc()
+	s.auditSwept(name, sudoReq, obj, message, now)
+	return nil
+}
+
+// bindingRequest returns the name of the request that the binding was
+// created for, or "" if it wasn't created by k8sudo. Bindings created by
+// earlier versions of the controller only have an owner reference.
+func bindingRequest(obj metav1.Object) string {
+	if name := obj.GetAnnotations()[k8sudov1alpha1.SudoRequestAnnotation]; name != "" {
+		return name
+	}
+	return ownerOf(obj)
+}
+
+// sweepReason returns why a binding created for the request should be
+// deleted and a description of it, or "" if it still grants access. A
+// binding whose request was deleted and then created again with the same
+// name is orphaned.
+func sweepReason(obj metav1.Object, sudoReq *k8sudov1alpha1.SudoRequest, now time.Time) (string, string) {
+	if sudoReq == nil {
+		return sweepReasonOrphaned, "SudoRequest not found"
+	}
+	if owner := metav1.GetControllerOf(obj); owner != nil && owner.UID != sudoReq.UID {
+		return sweepReasonOrphaned, "SudoRequest was replaced"
+	}
+	switch sudoReq.Status.Status {
+	case k8sudov1alpha1.SudoRequestStatusRevoked:
+		return sweepReasonRevoked, "SudoRequest was revoked"
+	case k8sudov1alpha1.SudoRequestStatusExpired:
+		return sweepReasonExpired, "SudoRequest expired"
+	}
+	// The controller may not have updated the status
+	if end, ok := apiaudit.GrantedUntil(sudoReq); ok && !now.Before(end) {
+		if sudoReq.Spec.Revoked != nil {
+			return sweepReasonRevoked, "SudoRequest was revoked"
+		}
+		return sweepReasonExpired, fmt.Sprintf("SudoRequest expired at %s", end.UTC().Format(time.RFC3339))
+	}
+	return "", ""
+}
+
+// auditSwept records the sweeper deleting a binding
+func (s *BindingSweeper) auditSwept(name string, sudoReq *k8sudov1alpha1.SudoRequest, obj metav1.Object, message string, now time.Time) {
+	record := audit.Record{Event: audit.EventSweep, Decision: audit.DecisionRemoved, SudoRequest: name}
+	if sudoReq != nil {
+		record = auditRecord(sudoReq, audit.EventSweep, audit.DecisionRemoved)
+	}
+	record.Time = now
+	record.Message = message
+	if obj.GetNamespace() == "" {
+		record.ClusterRoleBinding = obj.GetName()
+	} else {
+		record.Namespace = obj.GetNamespace()
+		record.RoleBinding = obj.GetName()
+	}
+	s.Audit.Record(record)
+}
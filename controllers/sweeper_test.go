@@ -0,0 +1,184 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientpkg "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+	"jetstack.io/k8sudo/pkg/audit"
+)
+
+func TestSweep(t *testing.T) {
+	now := time.Date(2020, time.June, 2, 2, 30, 0, 0, time.UTC)
+	sudoReq := func(name string, status k8sudov1alpha1.SudoRequestStatusStatus, expires time.Time) *k8sudov1alpha1.SudoRequest {
+		return &k8sudov1alpha1.SudoRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name)},
+			Spec:       k8sudov1alpha1.SudoRequestSpec{User: "user", Role: "admin"},
+			Status: k8sudov1alpha1.SudoRequestStatus{
+				Status:    status,
+				GrantedAt: &metav1.Time{Time: now.Add(-time.Hour)},
+				Expires:   &metav1.Time{Time: expires},
+			},
+		}
+	}
+	crb := func(name, sudoReq string) *rbacv1.ClusterRoleBinding {
+		crb := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if sudoReq != "" {
+			crb.Annotations = map[string]string{k8sudov1alpha1.SudoRequestAnnotation: sudoReq}
+		}
+		return crb
+	}
+	controller := true
+	replaced := crb("replaced", "active")
+	replaced.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: apiGVStr,
+		Kind:       sudoRequestKind,
+		Name:       "active",
+		UID:        "old",
+		Controller: &controller,
+	}}
+	recent := crb("recent", "missing")
+	recent.CreationTimestamp = metav1.Time{Time: now.Add(-30 * time.Second)}
+	overdue := sudoReq("overdue", k8sudov1alpha1.SudoRequestStatusReady, now.Add(-time.Minute))
+	revoked := sudoReq("revoked", k8sudov1alpha1.SudoRequestStatusRevoked, now.Add(time.Hour))
+	tests := []struct {
+		name           string
+		binding        runtime.Object
+		expectDeleted  bool
+		expectedReason string
+	}{
+		{
+			name:    "active",
+			binding: crb("active", "active"),
+		},
+		{
+			name:    "not created by k8sudo",
+			binding: crb("cluster-admin", ""),
+		},
+		{
+			name:           "orphaned",
+			binding:        crb("orphaned", "missing"),
+			expectDeleted:  true,
+			expectedReason: sweepReasonOrphaned,
+		},
+		{
+			name:    "orphaned but only just created",
+			binding: recent,
+		},
+		{
+			name:           "orphaned RoleBinding",
+			binding:        &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "orphaned", Namespace: "ns", Annotations: map[string]string{k8sudov1alpha1.SudoRequestAnnotation: "missing"}}},
+			expectDeleted:  true,
+			expectedReason: sweepReasonOrphaned,
+		},
+		{
+			name:           "request replaced",
+			binding:        replaced,
+			expectDeleted:  true,
+			expectedReason: sweepReasonOrphaned,
+		},
+		{
+			name:           "past expiry",
+			binding:        crb("overdue", "overdue"),
+			expectDeleted:  true,
+			expectedReason: sweepReasonExpired,
+		},
+		{
+			name:           "revoked",
+			binding:        crb("revoked", "revoked"),
+			expectDeleted:  true,
+			expectedReason: sweepReasonRevoked,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			k8sudov1alpha1.AddToScheme(scheme)
+			rbacv1.AddToScheme(scheme)
+			client := fake.NewFakeClientWithScheme(scheme,
+				sudoReq("active", k8sudov1alpha1.SudoRequestStatusReady, now.Add(time.Hour)),
+				overdue, revoked, test.binding.DeepCopyObject())
+			var buf bytes.Buffer
+			s := &BindingSweeper{
+				Client:   client,
+				Log:      testinglogr.TestLogger{T: t},
+				Clock:    FakeClock{CurrentTime: now},
+				Audit:    audit.NewLogger(testinglogr.TestLogger{T: t}, nil, audit.NewWriterSink("test", &buf)),
+				Interval: time.Minute,
+			}
+			var before float64
+			if test.expectedReason != "" {
+				before = testutil.ToFloat64(sweptBindings.WithLabelValues(test.expectedReason))
+			}
+			if err := s.Sweep(context.Background()); err != nil {
+				t.Fatalf("Sweep returned an error: %v", err)
+			}
+
+			err := client.Get(context.Background(), mustObjectKey(t, test.binding), test.binding.DeepCopyObject())
+			if got, want := apierrors.IsNotFound(err), test.expectDeleted; got != want {
+				t.Errorf("wrong deleted state: (got != want) %t != %t: %v", got, want, err)
+			}
+			records := auditRecords(t, &buf)
+			if !test.expectDeleted {
+				if len(records) != 0 {
+					t.Errorf("unexpected audit records: %+v", records)
+				}
+				return
+			}
+			if got, want := testutil.ToFloat64(sweptBindings.WithLabelValues(test.expectedReason)), before+1; got != want {
+				t.Errorf("wrong count of swept bindings: (got != want) %v != %v", got, want)
+			}
+			if len(records) != 1 {
+				t.Fatalf("wrong number of audit records: %+v", records)
+			}
+			if got, want := records[0].Event, audit.EventSweep; got != want {
+				t.Errorf("wrong Event: (got != want) %q != %q", got, want)
+			}
+		})
+	}
+}
+
+// mustObjectKey returns the key of the object
+func mustObjectKey(t *testing.T, obj runtime.Object) types.NamespacedName {
+	key, err := clientpkg.ObjectKeyFromObject(obj)
+	if err != nil {
+		t.Fatalf("error getting key of object: %v", err)
+	}
+	return key
+}
+
+func TestSweeperStartInvalidInterval(t *testing.T) {
+	s := &BindingSweeper{Log: testinglogr.TestLogger{T: t}}
+	stop := make(chan struct{})
+	close(stop)
+	if err := s.Start(stop); err == nil {
+		t.Errorf("expected an error for an interval of 0")
+	}
+}
@@ -16,7 +16,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -26,6 +30,8 @@ import (
 
 	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
 	"jetstack.io/k8sudo/controllers"
+	"jetstack.io/k8sudo/pkg/audit"
+	"jetstack.io/k8sudo/pkg/policy"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -45,12 +51,49 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var policyFilename string
+	var policyReloadInterval time.Duration
+	var auditOpts audit.Options
+	var auditFileMaxSizeMB int64
+	var auditHMACKeyFile string
+	var auditSigningKeyFile string
+	var enableEscalationAnnotations bool
+	var sweepInterval time.Duration
+	var apiAuditAddr string
+	var apiAuditCertDir string
+	var apiAuditClientCAFile string
+	var apiAuditClientNames string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&policyFilename, "policy", "", "The file to read the policy from.")
+	flag.DurationVar(&policyReloadInterval, "policy-reload-interval", 30*time.Second,
+		"How often to check the policy file for changes.")
+	flag.BoolVar(&auditOpts.Stdout, "audit-stdout", false, "Write audit records to stdout.")
+	flag.StringVar(&auditOpts.File, "audit-file", "", "The file to write audit records to.")
+	flag.Int64Var(&auditFileMaxSizeMB, "audit-file-max-size", 100,
+		"The size in megabytes the audit file can reach before it is rotated. 0 disables rotation.")
+	flag.IntVar(&auditOpts.FileMaxBackups, "audit-file-max-backups", 5, "The number of rotated audit files to keep.")
+	flag.StringVar(&auditOpts.Syslog, "audit-syslog", "",
+		"The syslog server to send audit records to, as udp://host:port or tcp://host:port.")
+	flag.StringVar(&auditOpts.SyslogTag, "audit-syslog-tag", "k8sudo", "The tag to send audit records to syslog with.")
+	flag.StringVar(&auditHMACKeyFile, "audit-hmac-key-file", "", "The file holding the key to sign audit records with HMAC-SHA256.")
+	flag.StringVar(&auditSigningKeyFile, "audit-signing-key-file", "",
+		"The file holding the PEM encoded Ed25519 private key to sign audit records with.")
+	flag.BoolVar(&enableEscalationAnnotations, "enable-escalation-annotations", false,
+		"Serve the webhook that adds audit annotations to API requests made with escalated access.")
+	flag.DurationVar(&sweepInterval, "sweep-interval", 10*time.Minute,
+		"How often to delete bindings whose SudoRequest is missing, expired or revoked.")
+	flag.StringVar(&apiAuditAddr, "api-audit-addr", "",
+		"The address to serve the API server audit webhook on, such as :9444. If empty it isn't served.")
+	flag.StringVar(&apiAuditCertDir, "api-audit-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory holding the tls.crt and tls.key to serve the API server audit webhook with.")
+	flag.StringVar(&apiAuditClientCAFile, "api-audit-client-ca-file", "",
+		"The file holding the CA certificates that the API server's client certificate must be signed by.")
+	flag.StringVar(&apiAuditClientNames, "api-audit-client-names", "",
+		"A comma separated list of the common names allowed in the API server's client certificate. If empty any name is allowed.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.Parse()
+	auditOpts.FileMaxSize = auditFileMaxSizeMB * 1024 * 1024
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
@@ -66,34 +109,121 @@ func main() {
 		os.Exit(1)
 	}
 
-	// if policyFilename != "" {
-	// 	rawPolicy, err := ioutil.ReadFile(policyFilename)
-	// 	if err != nil {
-	// 		setupLog.Error(err, "unable to read policy from %s", policyFilename)
-	// 		os.Exit(1)
-	// 	}
-	// 	err = yaml.Unmarshal(rawPolicy, &policy)
-	// 	if err != nil {
-	// 		setupLog.Error(err, "error parsing policy from %s", policyFilename)
-	// 		os.Exit(1)
-	// 	}
-	// }
+	var policyStore *policy.Store
+	if policyFilename != "" {
+		watcher, err := policy.NewFileWatcher(policyFilename, policyReloadInterval, ctrl.Log.WithName("policy"))
+		if err != nil {
+			setupLog.Error(err, "unable to load policy", "filename", policyFilename)
+			os.Exit(1)
+		}
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch policy", "filename", policyFilename)
+			os.Exit(1)
+		}
+		policyStore = watcher.Store
+	}
+
+	auditSinks, err := audit.NewSinks(auditOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up audit sinks")
+		os.Exit(1)
+	}
+	var auditLogger *audit.Logger
+	if len(auditSinks) > 0 {
+		chain, err := newAuditChain(auditOpts.File, auditHMACKeyFile, auditSigningKeyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to set up audit chain")
+			os.Exit(1)
+		}
+		auditLogger = audit.NewLogger(ctrl.Log.WithName("audit"), chain, auditSinks...)
+		defer auditLogger.Close()
+		auditLogger.Start()
+	}
 
 	if err = (&controllers.SudoRequestReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("SudoRequest"),
 		Scheme: mgr.GetScheme(),
+		Policy: policyStore,
+		Audit:  auditLogger,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SudoRequest")
 		os.Exit(1)
 	}
+	if err = (&controllers.SudoScheduleReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SudoSchedule"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SudoSchedule")
+		os.Exit(1)
+	}
+	if err = (&controllers.BindingSweeper{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("BindingSweeper"),
+		Audit:    auditLogger,
+		Interval: sweepInterval,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create sweeper")
+		os.Exit(1)
+	}
 	if err = (&controllers.SudoReqHandler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("SudoRequestWebhook"),
+		Policy: policyStore,
+		Audit:  auditLogger,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "SudoRequest")
 		os.Exit(1)
 	}
+	if err = (&controllers.SudoReqApprovalHandler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SudoRequestApprovalWebhook"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "SudoRequestApproval")
+		os.Exit(1)
+	}
+	if err = (&controllers.SudoScheduleHandler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SudoScheduleWebhook"),
+		Policy: policyStore,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "SudoSchedule")
+		os.Exit(1)
+	}
+	if apiAuditAddr != "" {
+		if apiAuditClientCAFile == "" {
+			setupLog.Error(nil, "--api-audit-client-ca-file is required to serve the API server audit webhook")
+			os.Exit(1)
+		}
+		var clientNames []string
+		if apiAuditClientNames != "" {
+			clientNames = strings.Split(apiAuditClientNames, ",")
+		}
+		if err = (&controllers.APIAuditServer{
+			Addr:         apiAuditAddr,
+			CertFile:     filepath.Join(apiAuditCertDir, "tls.crt"),
+			KeyFile:      filepath.Join(apiAuditCertDir, "tls.key"),
+			ClientCAFile: apiAuditClientCAFile,
+			Handler: &controllers.APIAuditHandler{
+				Client:      mgr.GetClient(),
+				Log:         ctrl.Log.WithName("controllers").WithName("APIAuditWebhook"),
+				ClientNames: clientNames,
+			},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "APIAudit")
+			os.Exit(1)
+		}
+	}
+	if enableEscalationAnnotations {
+		if err = (&controllers.EscalationAnnotationHandler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("EscalationAnnotationWebhook"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "EscalationAnnotation")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -102,3 +232,41 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newAuditChain returns the chain for audit records, signed with the
+// key from one of the key files if given. If the records are written to
+// a file the chain continues from the last record in it.
+func newAuditChain(filename, hmacKeyFile, signingKeyFile string) (*audit.Chain, error) {
+	if hmacKeyFile != "" && signingKeyFile != "" {
+		return nil, fmt.Errorf("only one of --audit-hmac-key-file and --audit-signing-key-file can be set")
+	}
+	var signer audit.Signer
+	if hmacKeyFile != "" {
+		hmacSigner, err := audit.LoadHMACKey(hmacKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer = hmacSigner
+	}
+	if signingKeyFile != "" {
+		ed25519Signer, err := audit.LoadEd25519Key(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if !ed25519Signer.CanSign() {
+			return nil, fmt.Errorf("%s is a public key, the private key is needed to sign audit records", signingKeyFile)
+		}
+		signer = ed25519Signer
+	}
+	chain := audit.NewChain(signer)
+	if filename != "" {
+		last, err := audit.LastRecord(filename)
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			chain.Resume(*last)
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,141 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiaudit
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+// bindingReasonRegexp finds the binding named in the reason the RBAC
+// authorizer gives for allowing a request, such as
+// RBAC: allowed by ClusterRoleBinding "name" of ClusterRole "admin" to User "dev1"
+// RoleBindings are given as "name/namespace".
+var bindingReasonRegexp = regexp.MustCompile(`allowed by (?:ClusterRoleBinding|RoleBinding) "([^"/]+)(?:/[^"]*)?"`)
+
+// Complete returns whether the event is for the end of a request, so
+// that each request is only counted once
+func (e *Event) Complete() bool {
+	return e.Stage == StageResponseComplete || e.Stage == StagePanic
+}
+
+// Forbidden returns whether the authorizer denied the request
+func (e *Event) Forbidden() bool {
+	decision, ok := e.Annotations[DecisionAnnotation]
+	return ok && decision != DecisionAllow
+}
+
+// AllowedBy returns the name of the binding that the RBAC authorizer
+// says allowed the request, and whether the event says why the request
+// was allowed at all
+func (e *Event) AllowedBy() (string, bool) {
+	reason, ok := e.Annotations[ReasonAnnotation]
+	if !ok {
+		return "", false
+	}
+	if match := bindingReasonRegexp.FindStringSubmatch(reason); match != nil {
+		return match[1], true
+	}
+	return "", true
+}
+
+// Action describes the API request in the event
+func (e *Event) Action() k8sudov1alpha1.SudoRequestAction {
+	action := k8sudov1alpha1.SudoRequestAction{
+		Time:    metav1.Time{Time: e.RequestReceivedTimestamp.Time},
+		User:    e.EffectiveUser().Username,
+		Verb:    e.Verb,
+		AuditID: string(e.AuditID),
+	}
+	if ref := e.ObjectRef; ref != nil {
+		action.Resource = ref.Resource
+		if ref.APIGroup != "" {
+			action.Resource = strings.Join([]string{ref.Resource, ref.APIGroup}, ".")
+		}
+		action.Subresource = ref.Subresource
+		action.Namespace = ref.Namespace
+		action.Name = ref.Name
+	} else {
+		action.RequestURI = e.RequestURI
+	}
+	if e.ResponseStatus != nil {
+		action.Code = e.ResponseStatus.Code
+	}
+	return action
+}
+
+// SubjectMatches returns whether the request grants access to the user,
+// either directly or through one of their groups
+func SubjectMatches(sudoReq *k8sudov1alpha1.SudoRequest, user authnv1.UserInfo) bool {
+	if sudoReq.Spec.Group != "" {
+		for _, group := range user.Groups {
+			if group == sudoReq.Spec.Group {
+				return true
+			}
+		}
+		return false
+	}
+	return sudoReq.Spec.User != "" && sudoReq.Spec.User == user.Username
+}
+
+// GrantedUntil returns when the access granted by the request ended or
+// will end, which is when it was revoked if it was revoked before it
+// expired. It returns false if access was never granted.
+func GrantedUntil(sudoReq *k8sudov1alpha1.SudoRequest) (time.Time, bool) {
+	if sudoReq.Status.GrantedAt == nil || sudoReq.Status.Expires == nil {
+		return time.Time{}, false
+	}
+	end := sudoReq.Status.Expires.Time
+	for _, entry := range sudoReq.Status.History {
+		if entry.Status == k8sudov1alpha1.SudoRequestStatusRevoked && entry.Time.Time.Before(end) {
+			end = entry.Time.Time
+		}
+	}
+	return end, true
+}
+
+// ActiveAt returns whether the request granted access at t, from when
+// it was granted until it expired or was revoked
+func ActiveAt(sudoReq *k8sudov1alpha1.SudoRequest, t time.Time) bool {
+	end, ok := GrantedUntil(sudoReq)
+	if !ok {
+		return false
+	}
+	return !t.Before(sudoReq.Status.GrantedAt.Time) && t.Before(end)
+}
+
+// BindingNames returns the names of the bindings recorded in the status
+// of the request
+func BindingNames(sudoReq *k8sudov1alpha1.SudoRequest) []string {
+	var names []string
+	if sudoReq.Status.ClusterRoleBinding != "" {
+		names = append(names, sudoReq.Status.ClusterRoleBinding)
+	}
+	if sudoReq.Status.RoleBinding != "" {
+		names = append(names, sudoReq.Status.RoleBinding)
+	}
+	for _, nsStatus := range sudoReq.Status.Namespaces {
+		if nsStatus.RoleBinding != "" {
+			names = append(names, nsStatus.RoleBinding)
+		}
+	}
+	return names
+}
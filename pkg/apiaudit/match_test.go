@@ -0,0 +1,132 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiaudit
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sudov1alpha1 "jetstack.io/k8sudo/api/v1alpha1"
+)
+
+func TestAllowedBy(t *testing.T) {
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		expectedBinding string
+		expectedReason  bool
+	}{
+		{
+			name: "no reason",
+		},
+		{
+			name: "ClusterRoleBinding",
+			annotations: map[string]string{
+				ReasonAnnotation: `RBAC: allowed by ClusterRoleBinding "sudo-dev1-admin" of ClusterRole "admin" to User "dev1"`,
+			},
+			expectedBinding: "sudo-dev1-admin",
+			expectedReason:  true,
+		},
+		{
+			name: "RoleBinding",
+			annotations: map[string]string{
+				ReasonAnnotation: `RBAC: allowed by RoleBinding "sudo-dev1-edit/prod" of ClusterRole "edit" to User "dev1"`,
+			},
+			expectedBinding: "sudo-dev1-edit",
+			expectedReason:  true,
+		},
+		{
+			name: "not RBAC",
+			annotations: map[string]string{
+				ReasonAnnotation: "",
+			},
+			expectedReason: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := &Event{Annotations: test.annotations}
+			binding, ok := event.AllowedBy()
+			if got, want := binding, test.expectedBinding; got != want {
+				t.Errorf("wrong binding: (got != want) %q != %q", got, want)
+			}
+			if got, want := ok, test.expectedReason; got != want {
+				t.Errorf("wrong reason state: (got != want) %t != %t", got, want)
+			}
+		})
+	}
+}
+
+func TestActiveAt(t *testing.T) {
+	grantedAt := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.UTC)
+	expiring := &k8sudov1alpha1.SudoRequest{
+		Status: k8sudov1alpha1.SudoRequestStatus{
+			GrantedAt: &metav1.Time{Time: grantedAt},
+			Expires:   &metav1.Time{Time: grantedAt.Add(time.Hour)},
+		},
+	}
+	revoked := expiring.DeepCopy()
+	revoked.Status.History = []k8sudov1alpha1.SudoRequestHistoryEntry{{
+		Status: k8sudov1alpha1.SudoRequestStatusRevoked,
+		Time:   metav1.Time{Time: grantedAt.Add(10 * time.Minute)},
+	}}
+
+	tests := []struct {
+		name     string
+		sudoReq  *k8sudov1alpha1.SudoRequest
+		at       time.Duration
+		expected bool
+	}{
+		{name: "before granted", sudoReq: expiring, at: -time.Second},
+		{name: "when granted", sudoReq: expiring, at: 0, expected: true},
+		{name: "before expiry", sudoReq: expiring, at: 59 * time.Minute, expected: true},
+		{name: "at expiry", sudoReq: expiring, at: time.Hour},
+		{name: "before revoked", sudoReq: revoked, at: 9 * time.Minute, expected: true},
+		{name: "after revoked", sudoReq: revoked, at: 11 * time.Minute},
+		{name: "never granted", sudoReq: &k8sudov1alpha1.SudoRequest{}, at: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, want := ActiveAt(test.sudoReq, grantedAt.Add(test.at)), test.expected; got != want {
+				t.Errorf("wrong active state: (got != want) %t != %t", got, want)
+			}
+		})
+	}
+}
+
+func TestAction(t *testing.T) {
+	event := &Event{
+		AuditID:        "1",
+		Verb:           "delete",
+		ObjectRef:      &ObjectReference{Resource: "deployments", APIGroup: "apps", Namespace: "prod", Name: "web"},
+		ResponseStatus: &metav1.Status{Code: 200},
+	}
+	action := event.Action()
+	if got, want := action.Resource, "deployments.apps"; got != want {
+		t.Errorf("wrong Resource: (got != want) %q != %q", got, want)
+	}
+	if got, want := action.Code, int32(200); got != want {
+		t.Errorf("wrong Code: (got != want) %d != %d", got, want)
+	}
+
+	event = &Event{Verb: "get", RequestURI: "/healthz"}
+	if got, want := event.Action().RequestURI, "/healthz"; got != want {
+		t.Errorf("wrong RequestURI: (got != want) %q != %q", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package apiaudit contains the parts of the audit.k8s.io/v1 API that
+// the API server sends to audit webhooks. They are copied from
+// k8s.io/apiserver so as not to depend on all of it.
+package apiaudit
+
+import (
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	APIVersion    = "audit.k8s.io/v1"
+	EventListKind = "EventList"
+
+	// Annotations added to events by the API server's authorizer
+	DecisionAnnotation = "authorization.k8s.io/decision"
+	ReasonAnnotation   = "authorization.k8s.io/reason"
+
+	// DecisionAllow is the value of the decision annotation when the
+	// request was authorized
+	DecisionAllow = "allow"
+)
+
+// Stage is the stage of handling the request that an event was
+// generated at
+type Stage string
+
+const (
+	StageRequestReceived  Stage = "RequestReceived"
+	StageResponseStarted  Stage = "ResponseStarted"
+	StageResponseComplete Stage = "ResponseComplete"
+	StagePanic            Stage = "Panic"
+)
+
+// Event is an audit event for a single API request
+type Event struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Level      string    `json:"level"`
+	AuditID    types.UID `json:"auditID"`
+	Stage      Stage     `json:"stage"`
+	RequestURI string    `json:"requestURI"`
+	Verb       string    `json:"verb"`
+
+	// The user that made the request
+	User authnv1.UserInfo `json:"user"`
+	// The user being impersonated, if any
+	ImpersonatedUser *authnv1.UserInfo `json:"impersonatedUser,omitempty"`
+
+	SourceIPs []string `json:"sourceIPs,omitempty"`
+	UserAgent string   `json:"userAgent,omitempty"`
+
+	// The object the request was for, if it was for a resource
+	ObjectRef *ObjectReference `json:"objectRef,omitempty"`
+	// The status of the response, if it was sent
+	ResponseStatus *metav1.Status `json:"responseStatus,omitempty"`
+
+	RequestReceivedTimestamp metav1.MicroTime `json:"requestReceivedTimestamp"`
+	StageTimestamp           metav1.MicroTime `json:"stageTimestamp"`
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// EventList is the batch of events sent to an audit webhook
+type EventList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Event `json:"items"`
+}
+
+// ObjectReference identifies the object a request was for
+type ObjectReference struct {
+	Resource    string `json:"resource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+	APIGroup    string `json:"apiGroup,omitempty"`
+	APIVersion  string `json:"apiVersion,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// EffectiveUser returns the user whose permissions the request was
+// authorized with, which is the impersonated user if there is one
+func (e *Event) EffectiveUser() authnv1.UserInfo {
+	if e.ImpersonatedUser != nil {
+		return *e.ImpersonatedUser
+	}
+	return e.User
+}
@@ -0,0 +1,201 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records each decision made about a SudoRequest as a
+// JSON record, and writes the records to one or more sinks.
+package audit
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Event is the kind of decision that a record is for
+type Event string
+
+const (
+	// EventAdmission is the webhook allowing or denying a change to a
+	// SudoRequest
+	EventAdmission Event = "Admission"
+	// EventAccessReview is the result of checking whether the user is
+	// authorized to assume the role
+	EventAccessReview Event = "AccessReview"
+	// EventApproval is a request being approved or rejected
+	EventApproval Event = "Approval"
+	// EventGrant is a binding being created to grant access
+	EventGrant Event = "Grant"
+	// EventExtension is an extension being granted or denied
+	EventExtension Event = "Extension"
+	// EventRevocation is access being revoked before it expired
+	EventRevocation Event = "Revocation"
+	// EventExpiry is access expiring
+	EventExpiry Event = "Expiry"
+	// EventDeletion is a request being deleted, which removes any
+	// access it still grants
+	EventDeletion Event = "Deletion"
+	// EventSweep is a binding being deleted by the sweeper, as the
+	// request it was created for is missing or no longer grants access
+	EventSweep Event = "Sweep"
+	// EventChainStart is the manager starting a new chain as it has no
+	// earlier record to continue from, such as when records aren't
+	// written to a file
+	EventChainStart Event = "ChainStart"
+)
+
+// Decisions recorded in addition to the status of the request
+const (
+	DecisionAllowed = "Allowed"
+	DecisionDenied  = "Denied"
+	DecisionGranted = "Granted"
+	// DecisionRemoved is recorded when the bindings of an expired or
+	// revoked request are deleted
+	DecisionRemoved = "Removed"
+	// DecisionDeleted is recorded when a request that no longer grants
+	// access is deleted
+	DecisionDeleted = "Deleted"
+	// DecisionStarted is recorded when a new chain is started
+	DecisionStarted = "Started"
+)
+
+// Record is a single audit record
+type Record struct {
+	// The position of the record in the chain, starting from 1
+	Sequence uint64 `json:"seq"`
+	// The hash of the previous record in the chain
+	PrevHash string `json:"prevHash,omitempty"`
+	// When the decision was made
+	Time time.Time `json:"time"`
+	// The kind of decision
+	Event Event `json:"event"`
+	// The outcome of the decision
+	Decision string `json:"decision"`
+	// The name of the SudoRequest
+	SudoRequest string `json:"sudoRequest"`
+	// The operation the webhook was called for, for admission records
+	Operation string `json:"operation,omitempty"`
+	// Who made the change that led to the decision
+	Requester string `json:"requester,omitempty"`
+	// The user or group granted access
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+	// The role granted
+	Role     string `json:"role"`
+	RoleKind string `json:"roleKind,omitempty"`
+	// The namespace, or namespaces, access is granted in, if it isn't
+	// granted cluster-wide
+	Namespace  string   `json:"namespace,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// The reason given in the request
+	Reason string `json:"reason,omitempty"`
+	// When access expires
+	Expires *time.Time `json:"expires,omitempty"`
+	// The bindings granting access
+	ClusterRoleBinding string `json:"clusterRoleBinding,omitempty"`
+	RoleBinding        string `json:"roleBinding,omitempty"`
+	// Why the decision was made
+	Message string `json:"message,omitempty"`
+
+	// The SHA-256 hash of the record, excluding the hash and signature,
+	// as hex
+	Hash string `json:"hash,omitempty"`
+	// The signature of the hash, if the chain is signed, as base64
+	Signature string `json:"signature,omitempty"`
+}
+
+// Logger adds records to a chain and writes them to its sinks. A nil
+// Logger discards records.
+type Logger struct {
+	mu    sync.Mutex
+	chain *Chain
+	sinks []Sink
+	log   logr.Logger
+}
+
+// NewLogger returns a Logger that adds records to chain and writes them
+// to the given sinks. If chain is nil a new unsigned chain is started.
+// Errors writing to a sink are logged to log, as a decision can't be
+// undone once it has been made.
+func NewLogger(log logr.Logger, chain *Chain, sinks ...Sink) *Logger {
+	if chain == nil {
+		chain = NewChain(nil)
+	}
+	return &Logger{chain: chain, sinks: sinks, log: log}
+}
+
+// Record adds the record to the chain and writes it to each of the
+// sinks. The time is set to now if it isn't set.
+func (l *Logger) Record(record Record) {
+	if l == nil {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Time = record.Time.UTC()
+	if record.Expires != nil {
+		expires := record.Expires.UTC()
+		record.Expires = &expires
+	}
+	// The record is sealed while holding the lock so that records are
+	// written in the order of the chain
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.chain.Seal(&record); err != nil {
+		l.log.Error(err, "unable to seal audit record", "sudorequest", record.SudoRequest)
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		l.log.Error(err, "unable to encode audit record", "sudorequest", record.SudoRequest)
+		return
+	}
+	for _, sink := range l.sinks {
+		if err := sink.Write(data); err != nil {
+			l.log.Error(err, "unable to write audit record", "sink", sink.String(), "record", string(data))
+		}
+	}
+}
+
+// Start records the start of a new chain, unless the chain continues
+// from an earlier record. Without it a chain started again when the
+// manager restarts can't be told apart from records having been removed.
+func (l *Logger) Start() {
+	if l == nil || !l.chain.empty() {
+		return
+	}
+	l.Record(Record{
+		Event:    EventChainStart,
+		Decision: DecisionStarted,
+		Message:  "No earlier record to continue the chain from",
+	})
+}
+
+// Close closes each of the sinks
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
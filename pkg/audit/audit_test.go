@@ -0,0 +1,174 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+)
+
+func TestLoggerRecord(t *testing.T) {
+	var first, second bytes.Buffer
+	l := NewLogger(testinglogr.TestLogger{T: t}, nil, NewWriterSink("first", &first), NewWriterSink("second", &second))
+	now := time.Date(2020, time.June, 2, 2, 0, 0, 0, time.FixedZone("BST", 3600))
+	l.Record(Record{
+		Time:        now,
+		Event:       EventGrant,
+		Decision:    DecisionGranted,
+		SudoRequest: "fix-prod",
+		User:        "dev1",
+		Role:        "admin",
+	})
+
+	for _, buf := range []*bytes.Buffer{&first, &second} {
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("wrong number of lines: %q", buf.String())
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+			t.Fatalf("error decoding record: %v", err)
+		}
+		if got, want := record.Time, now.UTC(); !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("wrong Time: (got != want) %s != %s", got, want)
+		}
+		if got, want := record.SudoRequest, "fix-prod"; got != want {
+			t.Errorf("wrong SudoRequest: (got != want) %q != %q", got, want)
+		}
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Record(Record{SudoRequest: "fix-prod"})
+	if err := l.Close(); err != nil {
+		t.Errorf("unexpected error closing: %v", err)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	// No two records fit in the file together, so each write after the
+	// first rotates it
+	sink, err := NewFileSink(filename, 5, 2)
+	if err != nil {
+		t.Fatalf("error creating sink: %v", err)
+	}
+	for _, record := range []string{"one", "two", "three", "four"} {
+		if err := sink.Write([]byte(record)); err != nil {
+			t.Fatalf("error writing record: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("error closing sink: %v", err)
+	}
+
+	expected := map[string]string{
+		filename:        "four\n",
+		filename + ".1": "three\n",
+		filename + ".2": "two\n",
+	}
+	for name, want := range expected {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Errorf("error reading %s: %v", name, err)
+			continue
+		}
+		if got := string(data); got != want {
+			t.Errorf("wrong contents of %s: (got != want) %q != %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept: %v", err)
+	}
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	for _, record := range []string{"one", "two"} {
+		sink, err := NewFileSink(filename, 0, 0)
+		if err != nil {
+			t.Fatalf("error creating sink: %v", err)
+		}
+		if err := sink.Write([]byte(record)); err != nil {
+			t.Fatalf("error writing record: %v", err)
+		}
+		sink.Close()
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+	if got, want := string(data), "one\ntwo\n"; got != want {
+		t.Errorf("wrong contents: (got != want) %q != %q", got, want)
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogSink("udp://"+conn.LocalAddr().String(), "k8sudo")
+	if err != nil {
+		t.Fatalf("error creating sink: %v", err)
+	}
+	defer sink.Close()
+	if err := sink.Write([]byte(`{"sudoRequest":"fix-prod"}`)); err != nil {
+		t.Fatalf("error writing record: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("error reading message: %v", err)
+	}
+	message := string(buf[:n])
+	if !strings.Contains(message, `k8sudo`) || !strings.Contains(message, `{"sudoRequest":"fix-prod"}`) {
+		t.Errorf("unexpected message: %q", message)
+	}
+}
+
+func TestNewSyslogSinkInvalidAddress(t *testing.T) {
+	for _, address := range []string{"localhost:514", "http://localhost:514", "udp://"} {
+		if _, err := NewSyslogSink(address, "k8sudo"); err == nil {
+			t.Errorf("expected an error for %q", address)
+		}
+	}
+}
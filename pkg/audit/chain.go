@@ -0,0 +1,348 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Signer signs the hash of each record so that the chain can't be
+// rewritten by someone without the key
+type Signer interface {
+	Sign(hash []byte) ([]byte, error)
+	Verify(hash, signature []byte) bool
+}
+
+// HMACSigner signs records with HMAC-SHA256 using a shared key
+type HMACSigner struct {
+	key []byte
+}
+
+// NewHMACSigner returns a signer using the given key
+func NewHMACSigner(key []byte) *HMACSigner {
+	return &HMACSigner{key: key}
+}
+
+func (s *HMACSigner) Sign(hash []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(hash)
+	return mac.Sum(nil), nil
+}
+
+func (s *HMACSigner) Verify(hash, signature []byte) bool {
+	expected, _ := s.Sign(hash)
+	return hmac.Equal(expected, signature)
+}
+
+// Ed25519Signer signs records with an Ed25519 private key, so that they
+// can be verified with only the public key. A signer with only the
+// public key can verify but not sign.
+type Ed25519Signer struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func (s *Ed25519Signer) Sign(hash []byte) ([]byte, error) {
+	if s.private == nil {
+		return nil, fmt.Errorf("no private key to sign with")
+	}
+	return ed25519.Sign(s.private, hash), nil
+}
+
+// CanSign returns whether the signer has the private key
+func (s *Ed25519Signer) CanSign() bool {
+	return s.private != nil
+}
+
+func (s *Ed25519Signer) Verify(hash, signature []byte) bool {
+	return ed25519.Verify(s.public, hash, signature)
+}
+
+// LoadHMACKey reads an HMAC key from a file. Surrounding whitespace is
+// removed so that the file can end in a newline.
+func LoadHMACKey(filename string) (*HMACSigner, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read HMAC key from %s: %v", filename, err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("HMAC key in %s is empty", filename)
+	}
+	return NewHMACSigner(key), nil
+}
+
+// LoadEd25519Key reads a PEM encoded Ed25519 key from a file, either a
+// PKCS #8 private key, which can sign and verify, or a PKIX public key,
+// which can only verify
+func LoadEd25519Key(filename string) (*Ed25519Signer, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Ed25519 key from %s: %v", filename, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", filename)
+	}
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %s: %v", filename, err)
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return &Ed25519Signer{private: key, public: key.Public().(ed25519.PublicKey)}, nil
+	case ed25519.PublicKey:
+		return &Ed25519Signer{public: key}, nil
+	}
+	return nil, fmt.Errorf("key in %s is not an Ed25519 key", filename)
+}
+
+// Chain links each record to the one before it by including the hash
+// of the previous record, so that records can't be removed or changed
+// without breaking the chain.
+type Chain struct {
+	mu       sync.Mutex
+	signer   Signer
+	sequence uint64
+	last     string
+}
+
+// NewChain returns a chain starting from the first record. If signer
+// is nil the records aren't signed.
+func NewChain(signer Signer) *Chain {
+	return &Chain{signer: signer}
+}
+
+// Resume continues the chain after the given record
+func (c *Chain) Resume(record Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sequence = record.Sequence
+	c.last = record.Hash
+}
+
+// empty returns whether no records have been added to the chain, nor
+// has it been resumed
+func (c *Chain) empty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sequence == 0
+}
+
+// hashRecord returns the hash of the record, excluding its hash and
+// signature
+func hashRecord(record Record) ([]byte, error) {
+	record.Hash = ""
+	record.Signature = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// Seal adds the record to the end of the chain, setting its sequence
+// number, the hash of the previous record, its own hash, and its
+// signature
+func (c *Chain) Seal(record *Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	record.Sequence = c.sequence + 1
+	record.PrevHash = c.last
+	record.Hash = ""
+	record.Signature = ""
+	hash, err := hashRecord(*record)
+	if err != nil {
+		return err
+	}
+	if c.signer != nil {
+		signature, err := c.signer.Sign(hash)
+		if err != nil {
+			return err
+		}
+		record.Signature = base64.StdEncoding.EncodeToString(signature)
+	}
+	record.Hash = hex.EncodeToString(hash)
+	c.sequence = record.Sequence
+	c.last = record.Hash
+	return nil
+}
+
+// LastRecord returns the last record in the file, or nil if the file
+// doesn't exist or is empty, so that the chain can be resumed when the
+// manager restarts
+func LastRecord(filename string) (*Record, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxRecordSize)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", filename, err)
+	}
+	if last == nil {
+		return nil, nil
+	}
+	var record Record
+	if err := json.Unmarshal(last, &record); err != nil {
+		return nil, fmt.Errorf("last record in %s is invalid: %v", filename, err)
+	}
+	return &record, nil
+}
+
+// maxRecordSize is the longest line that is read as a record
+const maxRecordSize = 1024 * 1024
+
+// Problem is something wrong with the chain found by a Verifier
+type Problem struct {
+	// The file and line the problem was found at
+	File string
+	Line int
+	// The sequence number of the record, if it could be read
+	Sequence uint64
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: record %d: %s", p.File, p.Line, p.Sequence, p.Message)
+}
+
+// Verifier walks a chain of records, which may be split across several
+// files, and reports any records that are missing or have been changed
+type Verifier struct {
+	// If set, each record must have a valid signature
+	Signer Signer
+
+	// The number of records checked
+	Records int
+	// The sequence number of the first record checked
+	First uint64
+	// The number of times the manager started a new chain
+	Restarts int
+	Problems []Problem
+
+	sequence uint64
+	last     string
+}
+
+// Verify checks the records read from r, continuing from the last
+// record of any files already checked. An error is only returned if
+// r can't be read.
+func (v *Verifier) Verify(name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxRecordSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		v.verifyLine(name, lineNo, line)
+	}
+	return scanner.Err()
+}
+
+func (v *Verifier) verifyLine(name string, lineNo int, line []byte) {
+	problem := func(sequence uint64, format string, args ...interface{}) {
+		v.Problems = append(v.Problems, Problem{File: name, Line: lineNo, Sequence: sequence, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var record Record
+	if err := json.Unmarshal(line, &record); err != nil {
+		problem(0, "not a valid record: %v", err)
+		return
+	}
+	v.Records++
+	// Fields that aren't part of a record aren't covered by the hash
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&Record{}); err != nil {
+		problem(record.Sequence, "record has been modified: %v", err)
+	}
+
+	hash, err := hashRecord(record)
+	if err != nil {
+		problem(record.Sequence, "unable to hash record: %v", err)
+		return
+	}
+	if record.Hash != hex.EncodeToString(hash) {
+		problem(record.Sequence, "record has been modified, its hash doesn't match its contents")
+	}
+	if v.Signer != nil {
+		signature, err := base64.StdEncoding.DecodeString(record.Signature)
+		if err != nil || record.Signature == "" || !v.Signer.Verify(hash, signature) {
+			problem(record.Sequence, "signature is missing or invalid")
+		}
+	}
+
+	switch {
+	case v.Records == 1:
+		// The first record checked may follow records in a file that
+		// has been rotated away, so its link can't be checked
+		v.First = record.Sequence
+	case record.Sequence == 1 && record.PrevHash == "" && record.Event == EventChainStart:
+		// The manager had no record to continue from when it
+		// restarted. If the chain is signed the record can't be forged.
+		v.Restarts++
+	case record.Sequence == 1 && record.PrevHash == "":
+		problem(record.Sequence, "chain restarts after record %d, the records after it may have been removed", v.sequence)
+	case record.Sequence <= v.sequence:
+		problem(record.Sequence, "record is out of order, following record %d", v.sequence)
+	case record.Sequence == v.sequence+2:
+		problem(record.Sequence, "record %d is missing", v.sequence+1)
+	case record.Sequence > v.sequence+2:
+		problem(record.Sequence, "records %d to %d are missing", v.sequence+1, record.Sequence-1)
+	case record.PrevHash != v.last:
+		problem(record.Sequence, "previous hash doesn't match record %d, it has been modified or replaced", v.sequence)
+	}
+	v.sequence = record.Sequence
+	v.last = record.Hash
+}
@@ -0,0 +1,271 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+)
+
+// writeChain writes n records to a buffer using a chain with the given
+// signer, returning the lines written
+func writeChain(t *testing.T, signer Signer, n int) []string {
+	var buf bytes.Buffer
+	l := NewLogger(testinglogr.TestLogger{T: t}, NewChain(signer), NewWriterSink("test", &buf))
+	expires := time.Date(2020, time.June, 2, 3, 0, 0, 0, time.FixedZone("BST", 3600))
+	for i := 0; i < n; i++ {
+		l.Record(Record{
+			Event:       EventGrant,
+			Decision:    DecisionGranted,
+			SudoRequest: "fix-prod",
+			User:        "dev1",
+			Role:        "admin",
+			Expires:     &expires,
+		})
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// restartChain writes the records a manager restarting without an
+// earlier record to continue from would, using a chain with the given
+// signer
+func restartChain(t *testing.T, signer Signer) []string {
+	var buf bytes.Buffer
+	l := NewLogger(testinglogr.TestLogger{T: t}, NewChain(signer), NewWriterSink("test", &buf))
+	l.Start()
+	l.Record(Record{Event: EventGrant, Decision: DecisionGranted, SudoRequest: "fix-prod"})
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func verify(signer Signer, lines []string) *Verifier {
+	v := &Verifier{Signer: signer}
+	v.Verify("test", strings.NewReader(strings.Join(lines, "\n")))
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	ed25519Signer := &Ed25519Signer{private: private, public: public}
+	hmacSigner := NewHMACSigner([]byte("secret"))
+
+	tests := []struct {
+		name             string
+		signer           Signer
+		verifier         Signer
+		modify           func(lines []string) []string
+		expectedProblems int
+		expectedRestarts int
+	}{
+		{
+			name: "unmodified",
+		},
+		{
+			name:     "unmodified with HMAC",
+			signer:   hmacSigner,
+			verifier: hmacSigner,
+		},
+		{
+			name:     "unmodified with Ed25519",
+			signer:   ed25519Signer,
+			verifier: &Ed25519Signer{public: public},
+		},
+		{
+			name: "starting after rotation",
+			modify: func(lines []string) []string {
+				return lines[2:]
+			},
+		},
+		{
+			name: "modified record",
+			modify: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"role":"admin"`, `"role":"view"`, 1)
+				return lines
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "removed record",
+			modify: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "reordered records",
+			modify: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			// Each of the moved records is out of place, as is the
+			// record after them
+			expectedProblems: 3,
+		},
+		{
+			name: "added field",
+			modify: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `{`, `{"extra":true,`, 1)
+				return lines
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "not JSON",
+			modify: func(lines []string) []string {
+				lines[1] = "garbage"
+				return lines
+			},
+			// The record is reported, and the next record doesn't
+			// follow the one before
+			expectedProblems: 2,
+		},
+		{
+			name: "chain restarted",
+			modify: func(lines []string) []string {
+				return append(lines, writeChain(t, nil, 1)...)
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "chain started again by the manager",
+			modify: func(lines []string) []string {
+				return append(lines, restartChain(t, nil)...)
+			},
+			expectedRestarts: 1,
+		},
+		{
+			name:     "signed chain started again by the manager",
+			signer:   hmacSigner,
+			verifier: hmacSigner,
+			modify: func(lines []string) []string {
+				return append(lines, restartChain(t, hmacSigner)...)
+			},
+			expectedRestarts: 1,
+		},
+		{
+			name:     "forged start of chain",
+			signer:   hmacSigner,
+			verifier: hmacSigner,
+			modify: func(lines []string) []string {
+				return append(lines, restartChain(t, NewHMACSigner([]byte("other")))...)
+			},
+			expectedProblems: 2,
+			expectedRestarts: 1,
+		},
+		{
+			name:             "unsigned records",
+			verifier:         hmacSigner,
+			expectedProblems: 4,
+		},
+		{
+			name:             "signed with another key",
+			signer:           NewHMACSigner([]byte("other")),
+			verifier:         hmacSigner,
+			expectedProblems: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := writeChain(t, test.signer, 4)
+			if test.modify != nil {
+				lines = test.modify(lines)
+			}
+			v := verify(test.verifier, lines)
+			if got, want := len(v.Problems), test.expectedProblems; got != want {
+				t.Errorf("wrong number of problems: (got != want) %d != %d: %v", got, want, v.Problems)
+			}
+			if got, want := v.Restarts, test.expectedRestarts; got != want {
+				t.Errorf("wrong number of restarts: (got != want) %d != %d", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyRecomputedHash(t *testing.T) {
+	// Someone rewriting a record and its hash breaks the link from the
+	// next record
+	lines := writeChain(t, nil, 3)
+	v := &Verifier{}
+	v.Verify("test", strings.NewReader(lines[0]))
+
+	var buf bytes.Buffer
+	l := NewLogger(testinglogr.TestLogger{T: t}, nil, NewWriterSink("test", &buf))
+	l.Record(Record{SudoRequest: "forged"})
+	l.Record(Record{SudoRequest: "forged"})
+	forged := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	v.Verify("test", strings.NewReader(forged[1]+"\n"+lines[2]))
+	if len(v.Problems) != 2 {
+		t.Errorf("expected the forged record and the following record to be reported: %v", v.Problems)
+	}
+}
+
+func TestResumeFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	last, err := LastRecord(filename)
+	if err != nil || last != nil {
+		t.Fatalf("expected no record before the file exists: %v %v", last, err)
+	}
+
+	// Write records as if the manager restarted between each one
+	for i := 0; i < 3; i++ {
+		sink, err := NewFileSink(filename, 0, 0)
+		if err != nil {
+			t.Fatalf("error creating sink: %v", err)
+		}
+		chain := NewChain(nil)
+		last, err := LastRecord(filename)
+		if err != nil {
+			t.Fatalf("error reading last record: %v", err)
+		}
+		if last != nil {
+			chain.Resume(*last)
+		}
+		l := NewLogger(testinglogr.TestLogger{T: t}, chain, sink)
+		// Only the first run starts a new chain
+		l.Start()
+		l.Record(Record{SudoRequest: "fix-prod"})
+		l.Close()
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+	v := &Verifier{}
+	v.Verify(filename, bytes.NewReader(data))
+	if len(v.Problems) != 0 {
+		t.Errorf("unexpected problems: %v", v.Problems)
+	}
+	if got, want := v.Records, 4; got != want {
+		t.Errorf("wrong number of records: (got != want) %d != %d", got, want)
+	}
+}
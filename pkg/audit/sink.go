@@ -0,0 +1,235 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+	"os"
+)
+
+// Sink is somewhere that audit records are written to. Each record is
+// written as a single line of JSON, without the newline.
+type Sink interface {
+	Write(record []byte) error
+	Close() error
+	// String describes the sink for logging
+	String() string
+}
+
+// Options configures the sinks to write to
+type Options struct {
+	// Write records to stdout
+	Stdout bool
+	// The file to write records to
+	File string
+	// The size in bytes the file can reach before it is rotated. If
+	// zero the file isn't rotated.
+	FileMaxSize int64
+	// The number of rotated files to keep
+	FileMaxBackups int
+	// The syslog server to write records to, as udp://host:port or
+	// tcp://host:port
+	Syslog string
+	// The tag that syslog messages are sent with
+	SyslogTag string
+}
+
+// NewSinks creates the sinks configured by opts
+func NewSinks(opts Options) ([]Sink, error) {
+	var sinks []Sink
+	if opts.Stdout {
+		sinks = append(sinks, NewWriterSink("stdout", os.Stdout))
+	}
+	if opts.File != "" {
+		sink, err := NewFileSink(opts.File, opts.FileMaxSize, opts.FileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if opts.Syslog != "" {
+		sink, err := NewSyslogSink(opts.Syslog, opts.SyslogTag)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// line returns a copy of the record with a newline, as the record is
+// shared between sinks
+func line(record []byte) []byte {
+	return append(append(make([]byte, 0, len(record)+1), record...), '\n')
+}
+
+// WriterSink writes records to an io.Writer, one per line
+type WriterSink struct {
+	name string
+	w    io.Writer
+}
+
+// NewWriterSink returns a sink writing to w
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{name: name, w: w}
+}
+
+func (s *WriterSink) Write(record []byte) error {
+	_, err := s.w.Write(line(record))
+	return err
+}
+
+// Close does nothing, as the writer is owned by the caller
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+func (s *WriterSink) String() string {
+	return s.name
+}
+
+// FileSink appends records to a file, one per line. When the file
+// would grow beyond the maximum size it is renamed with a .1 suffix,
+// the previous backups are shifted up, and a new file is started.
+type FileSink struct {
+	filename   string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+// NewFileSink opens the file for appending, creating it if it doesn't
+// exist
+func NewFileSink(filename string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{
+		filename:   filename,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log %s: %v", s.filename, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to open audit log %s: %v", s.filename, err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) backup(n int) string {
+	return fmt.Sprintf("%s.%d", s.filename, n)
+}
+
+// rotate closes the file, shifts the backups up by one, dropping the
+// oldest, and opens a new file
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if s.maxBackups > 0 {
+		if err := os.Remove(s.backup(s.maxBackups)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for n := s.maxBackups - 1; n > 0; n-- {
+			if err := os.Rename(s.backup(n), s.backup(n+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(s.filename, s.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.filename); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) Write(record []byte) error {
+	line := line(record)
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("unable to rotate audit log: %v", err)
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+func (s *FileSink) String() string {
+	return s.filename
+}
+
+// SyslogSink sends records to a syslog server over UDP or TCP. The
+// connection is re-established if it is lost.
+type SyslogSink struct {
+	address string
+	writer  *syslog.Writer
+}
+
+// NewSyslogSink connects to the syslog server at address, given as
+// udp://host:port or tcp://host:port
+func NewSyslogSink(address, tag string) (*SyslogSink, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %v", address, err)
+	}
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return nil, fmt.Errorf("invalid syslog address %q: the scheme must be udp or tcp", address)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid syslog address %q: no host", address)
+	}
+	writer, err := syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to syslog: %v", err)
+	}
+	return &SyslogSink{address: address, writer: writer}, nil
+}
+
+func (s *SyslogSink) Write(record []byte) error {
+	return s.writer.Info(string(record))
+}
+
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
+
+func (s *SyslogSink) String() string {
+	return s.address
+}
@@ -0,0 +1,264 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy contains the policy that controls how SudoRequests are
+// granted, and the means to load it from a file.
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	APIVersion = "k8sudo.jetstack.io/v1alpha1"
+	Kind       = "Policy"
+
+	// DefaultDuration is how long a request is granted for if neither
+	// the request nor the policy says otherwise
+	DefaultDuration = 10 * time.Minute
+	// DefaultMaxDuration is the longest a request can be granted for
+	// if the policy doesn't say otherwise
+	DefaultMaxDuration = 1 * time.Hour
+
+	SubjectKindUser  = "User"
+	SubjectKindGroup = "Group"
+)
+
+// Policy is the versioned policy file
+type Policy struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// The settings that apply to any role without its own settings
+	Defaults RoleSettings `json:"defaults,omitempty"`
+
+	// The settings for individual roles. These override the defaults.
+	Roles []RolePolicy `json:"roles,omitempty"`
+}
+
+// RolePolicy is the settings for a single role
+type RolePolicy struct {
+	// The name of the role
+	Name string `json:"name"`
+
+	RoleSettings `json:",inline"`
+}
+
+// RoleSettings are the settings that can be applied to a role. Unset
+// values are inherited.
+type RoleSettings struct {
+	// How long the role is granted for if the request doesn't ask
+	// for a specific time
+	DefaultDuration *metav1.Duration `json:"defaultDuration,omitempty"`
+
+	// The longest the role can be granted for
+	MaxDuration *metav1.Duration `json:"maxDuration,omitempty"`
+
+	// The longest the role can be granted for including any extensions.
+	// Defaults to maxDuration.
+	MaxTotalDuration *metav1.Duration `json:"maxTotalDuration,omitempty"`
+
+	// Whether the request must give a reason
+	RequireReason *bool `json:"requireReason,omitempty"`
+
+	// The subjects that are allowed to request the role. If empty
+	// any subject can request it.
+	AllowedSubjects []Subject `json:"allowedSubjects,omitempty"`
+
+	// How many distinct users, other than the requester, must approve
+	// a request for the role before it is granted
+	RequiredApprovals *int `json:"requiredApprovals,omitempty"`
+}
+
+// Subject is a user or group that is allowed to request a role
+type Subject struct {
+	// Either User or Group
+	Kind string `json:"kind"`
+
+	// The name of the user or group
+	Name string `json:"name"`
+}
+
+// Settings are the effective settings for a role
+type Settings struct {
+	DefaultDuration   time.Duration
+	MaxDuration       time.Duration
+	MaxTotalDuration  time.Duration
+	RequireReason     bool
+	AllowedSubjects   []Subject
+	RequiredApprovals int
+}
+
+// Load parses and validates a policy
+func Load(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy: %v", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// LoadFile reads, parses and validates a policy from a file
+func LoadFile(filename string) (*Policy, []byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read policy from %s: %v", filename, err)
+	}
+	policy, err := Load(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid policy in %s: %v", filename, err)
+	}
+	return policy, data, nil
+}
+
+// Validate checks that the policy is well formed
+func (p *Policy) Validate() error {
+	if p.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported apiVersion %q, must be %q", p.APIVersion, APIVersion)
+	}
+	if p.Kind != Kind {
+		return fmt.Errorf("unsupported kind %q, must be %q", p.Kind, Kind)
+	}
+	if err := p.Defaults.validate(); err != nil {
+		return fmt.Errorf("defaults: %v", err)
+	}
+	if err := p.ForRole("").validate(); err != nil {
+		return fmt.Errorf("defaults: %v", err)
+	}
+	seen := map[string]bool{}
+	for i, role := range p.Roles {
+		if role.Name == "" {
+			return fmt.Errorf("roles[%d]: name must be set", i)
+		}
+		if seen[role.Name] {
+			return fmt.Errorf("roles[%d]: duplicate role %q", i, role.Name)
+		}
+		seen[role.Name] = true
+		if err := role.RoleSettings.validate(); err != nil {
+			return fmt.Errorf("role %q: %v", role.Name, err)
+		}
+		if err := p.ForRole(role.Name).validate(); err != nil {
+			return fmt.Errorf("role %q: %v", role.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s RoleSettings) validate() error {
+	if s.DefaultDuration != nil && s.DefaultDuration.Duration <= 0 {
+		return fmt.Errorf("defaultDuration must be positive")
+	}
+	if s.MaxDuration != nil && s.MaxDuration.Duration <= 0 {
+		return fmt.Errorf("maxDuration must be positive")
+	}
+	if s.MaxTotalDuration != nil && s.MaxTotalDuration.Duration <= 0 {
+		return fmt.Errorf("maxTotalDuration must be positive")
+	}
+	if s.RequiredApprovals != nil && *s.RequiredApprovals < 0 {
+		return fmt.Errorf("requiredApprovals must not be negative")
+	}
+	for i, subject := range s.AllowedSubjects {
+		if subject.Kind != SubjectKindUser && subject.Kind != SubjectKindGroup {
+			return fmt.Errorf("allowedSubjects[%d]: kind must be %s or %s", i, SubjectKindUser, SubjectKindGroup)
+		}
+		if subject.Name == "" {
+			return fmt.Errorf("allowedSubjects[%d]: name must be set", i)
+		}
+	}
+	return nil
+}
+
+func (s Settings) validate() error {
+	if s.DefaultDuration > s.MaxDuration {
+		return fmt.Errorf("defaultDuration %s is longer than maxDuration %s", s.DefaultDuration, s.MaxDuration)
+	}
+	if s.MaxDuration > s.MaxTotalDuration {
+		return fmt.Errorf("maxDuration %s is longer than maxTotalDuration %s", s.MaxDuration, s.MaxTotalDuration)
+	}
+	return nil
+}
+
+// ForRole returns the effective settings for the named role. A nil
+// policy gives the built-in defaults.
+func (p *Policy) ForRole(role string) Settings {
+	settings := Settings{
+		DefaultDuration: DefaultDuration,
+		MaxDuration:     DefaultMaxDuration,
+	}
+	if p != nil {
+		settings.apply(p.Defaults)
+		for _, rolePolicy := range p.Roles {
+			if rolePolicy.Name == role {
+				settings.apply(rolePolicy.RoleSettings)
+				break
+			}
+		}
+	}
+	if settings.MaxTotalDuration == 0 {
+		settings.MaxTotalDuration = settings.MaxDuration
+	}
+	return settings
+}
+
+func (s *Settings) apply(roleSettings RoleSettings) {
+	if roleSettings.DefaultDuration != nil {
+		s.DefaultDuration = roleSettings.DefaultDuration.Duration
+	}
+	if roleSettings.MaxDuration != nil {
+		s.MaxDuration = roleSettings.MaxDuration.Duration
+	}
+	if roleSettings.MaxTotalDuration != nil {
+		s.MaxTotalDuration = roleSettings.MaxTotalDuration.Duration
+	}
+	if roleSettings.RequireReason != nil {
+		s.RequireReason = *roleSettings.RequireReason
+	}
+	if len(roleSettings.AllowedSubjects) > 0 {
+		s.AllowedSubjects = roleSettings.AllowedSubjects
+	}
+	if roleSettings.RequiredApprovals != nil {
+		s.RequiredApprovals = *roleSettings.RequiredApprovals
+	}
+}
+
+// Allows returns whether a user with the given groups may request
+// the role
+func (s Settings) Allows(username string, groups []string) bool {
+	if len(s.AllowedSubjects) == 0 {
+		return true
+	}
+	for _, subject := range s.AllowedSubjects {
+		switch subject.Kind {
+		case SubjectKindUser:
+			if subject.Name == username {
+				return true
+			}
+		case SubjectKindGroup:
+			for _, group := range groups {
+				if subject.Name == group {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	testinglogr "github.com/go-logr/logr/testing"
+)
+
+const validPolicy = `
+apiVersion: k8sudo.jetstack.io/v1alpha1
+kind: Policy
+defaults:
+  defaultDuration: 5m
+  maxDuration: 30m
+roles:
+- name: cluster-admin
+  maxDuration: 15m
+  maxTotalDuration: 1h
+  requireReason: true
+  requiredApprovals: 2
+  allowedSubjects:
+  - kind: Group
+    name: sre
+`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		expectError bool
+	}{
+		{
+			name:   "valid",
+			policy: validPolicy,
+		},
+		{
+			name:   "empty",
+			policy: "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\n",
+		},
+		{
+			name:        "wrong version",
+			policy:      "apiVersion: k8sudo.jetstack.io/v2\nkind: Policy\n",
+			expectError: true,
+		},
+		{
+			name:        "wrong kind",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: SudoRequest\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown field",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\nmaxDuration: 1h\n",
+			expectError: true,
+		},
+		{
+			name:        "negative duration",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\ndefaults:\n  maxDuration: -1h\n",
+			expectError: true,
+		},
+		{
+			name:        "default longer than max",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\nroles:\n- name: role\n  defaultDuration: 2h\n",
+			expectError: true,
+		},
+		{
+			name:        "max longer than total",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\ndefaults:\n  maxDuration: 2h\n  maxTotalDuration: 1h\n",
+			expectError: true,
+		},
+		{
+			name:        "duplicate role",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\nroles:\n- name: role\n- name: role\n",
+			expectError: true,
+		},
+		{
+			name:        "negative approvals",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\ndefaults:\n  requiredApprovals: -1\n",
+			expectError: true,
+		},
+		{
+			name:        "bad subject kind",
+			policy:      "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\nroles:\n- name: role\n  allowedSubjects:\n  - kind: ServiceAccount\n    name: sa\n",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load([]byte(test.policy))
+			if got, want := (err != nil), test.expectError; got != want {
+				t.Errorf("unexpected error state: (got != want) %t != %t: %v", got, want, err)
+			}
+		})
+	}
+}
+
+func TestForRole(t *testing.T) {
+	policy, err := Load([]byte(validPolicy))
+	if err != nil {
+		t.Fatalf("error loading policy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		role     string
+		expected Settings
+	}{
+		{
+			name:   "no policy",
+			policy: nil,
+			role:   "cluster-admin",
+			expected: Settings{
+				DefaultDuration:  DefaultDuration,
+				MaxDuration:      DefaultMaxDuration,
+				MaxTotalDuration: DefaultMaxDuration,
+			},
+		},
+		{
+			name:   "defaults",
+			policy: policy,
+			role:   "view",
+			expected: Settings{
+				DefaultDuration:  5 * time.Minute,
+				MaxDuration:      30 * time.Minute,
+				MaxTotalDuration: 30 * time.Minute,
+			},
+		},
+		{
+			name:   "role",
+			policy: policy,
+			role:   "cluster-admin",
+			expected: Settings{
+				DefaultDuration:   5 * time.Minute,
+				MaxDuration:       15 * time.Minute,
+				MaxTotalDuration:  time.Hour,
+				RequireReason:     true,
+				AllowedSubjects:   []Subject{{Kind: SubjectKindGroup, Name: "sre"}},
+				RequiredApprovals: 2,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, want := test.policy.ForRole(test.role), test.expected; !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong settings: (got != want) %+v != %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	settings := Settings{
+		AllowedSubjects: []Subject{
+			{Kind: SubjectKindUser, Name: "alice"},
+			{Kind: SubjectKindGroup, Name: "sre"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		settings Settings
+		username string
+		groups   []string
+		expected bool
+	}{
+		{
+			name:     "no subjects",
+			settings: Settings{},
+			username: "bob",
+			expected: true,
+		},
+		{
+			name:     "allowed user",
+			settings: settings,
+			username: "alice",
+			expected: true,
+		},
+		{
+			name:     "allowed group",
+			settings: settings,
+			username: "bob",
+			groups:   []string{"devs", "sre"},
+			expected: true,
+		},
+		{
+			name:     "not allowed",
+			settings: settings,
+			username: "bob",
+			groups:   []string{"devs"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, want := test.settings.Allows(test.username, test.groups), test.expected; got != want {
+				t.Errorf("wrong result: (got != want) %t != %t", got, want)
+			}
+		})
+	}
+}
+
+func TestFileWatcherReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8sudo-policy-")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "policy.yaml")
+	if err := ioutil.WriteFile(filename, []byte(validPolicy), 0644); err != nil {
+		t.Fatalf("error writing policy: %v", err)
+	}
+
+	w, err := NewFileWatcher(filename, time.Second, testinglogr.TestLogger{T: t})
+	if err != nil {
+		t.Fatalf("error creating watcher: %v", err)
+	}
+	if got, want := w.Store.ForRole("view").MaxDuration, 30*time.Minute; got != want {
+		t.Errorf("wrong initial maxDuration: (got != want) %s != %s", got, want)
+	}
+
+	updated := "apiVersion: k8sudo.jetstack.io/v1alpha1\nkind: Policy\ndefaults:\n  maxDuration: 2h\n"
+	if err := ioutil.WriteFile(filename, []byte(updated), 0644); err != nil {
+		t.Fatalf("error writing policy: %v", err)
+	}
+	w.Reload()
+	if got, want := w.Store.ForRole("view").MaxDuration, 2*time.Hour; got != want {
+		t.Errorf("wrong reloaded maxDuration: (got != want) %s != %s", got, want)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("kind: Nonsense\n"), 0644); err != nil {
+		t.Fatalf("error writing policy: %v", err)
+	}
+	w.Reload()
+	if got, want := w.Store.ForRole("view").MaxDuration, 2*time.Hour; got != want {
+		t.Errorf("invalid policy was not ignored: (got != want) %s != %s", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Store holds the current policy so that it can be replaced while
+// it is in use. A nil Store gives the built-in defaults.
+type Store struct {
+	mu     sync.RWMutex
+	policy *Policy
+}
+
+// NewStore returns a Store holding the given policy
+func NewStore(policy *Policy) *Store {
+	return &Store{policy: policy}
+}
+
+// Get returns the current policy
+func (s *Store) Get() *Policy {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// Set replaces the current policy
+func (s *Store) Set(policy *Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+// ForRole returns the effective settings for the named role from
+// the current policy
+func (s *Store) ForRole(role string) Settings {
+	return s.Get().ForRole(role)
+}
+
+// FileWatcher reloads the policy in a Store whenever the file it was
+// read from changes. The file is polled rather than watched so that
+// changes to mounted ConfigMaps, which are made by swapping symlinks,
+// are seen.
+type FileWatcher struct {
+	Filename string
+	Interval time.Duration
+	Store    *Store
+	Log      logr.Logger
+
+	last []byte
+}
+
+// NewFileWatcher loads the policy from the file in to a new Store,
+// returning an error if it isn't valid.
+func NewFileWatcher(filename string, interval time.Duration, log logr.Logger) (*FileWatcher, error) {
+	policy, data, err := LoadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWatcher{
+		Filename: filename,
+		Interval: interval,
+		Store:    NewStore(policy),
+		Log:      log,
+		last:     data,
+	}, nil
+}
+
+// Start polls the file until stop is closed
+func (w *FileWatcher) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			w.Reload()
+		}
+	}
+}
+
+// NeedLeaderElection is false as every replica serving the webhook
+// needs the current policy
+func (w *FileWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Reload reads the file and replaces the policy in the Store if it has
+// changed. An invalid policy is logged and the previous policy is kept.
+func (w *FileWatcher) Reload() {
+	data, err := ioutil.ReadFile(w.Filename)
+	if err != nil {
+		w.Log.Error(err, "unable to read policy", "filename", w.Filename)
+		return
+	}
+	if bytes.Equal(data, w.last) {
+		return
+	}
+	policy, err := Load(data)
+	if err != nil {
+		w.Log.Error(err, "invalid policy, keeping the previous policy", "filename", w.Filename)
+		return
+	}
+	w.last = data
+	w.Store.Set(policy)
+	w.Log.Info("Reloaded policy", "filename", w.Filename)
+}